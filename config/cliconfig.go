@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
@@ -22,6 +23,14 @@ var (
 	errTruncatedConfigFile = errors.New("truncated config file")
 	// errMigrationSrcNotDir for error when migration source specified is not a directory
 	errMigrationSrcNotDir = errors.New("migration source not a dir")
+	// errMigrationSrcRequired for error when migration scaffolding is requested without a migration source
+	errMigrationSrcRequired = errors.New("migration source required")
+	// errSeedSrcNotDir for error when seed source specified is not a directory
+	errSeedSrcNotDir = errors.New("seed source not a dir")
+	// errBackupAndRestore for error when both backup and restore are requested
+	errBackupAndRestore = errors.New("backup and restore are mutually exclusive")
+	// errBackupDirNotDir for error when pre migration backup location is not a directory
+	errBackupDirNotDir = errors.New("pre migration backup location not a dir")
 )
 
 // CLIConfig represents the Command Line Args config
@@ -30,6 +39,15 @@ type CLIConfig struct {
 	MigrationSource        string
 	StopOnConfigChange     bool
 	DoNotWatchConfigChange bool
+	BackupPath             string
+	RestorePath            string
+	PreMigrationBackupDir  string
+	MigrationTimeout       time.Duration
+	SeedDir                string
+	CheckSchemaDrift       bool
+	NewMigrationName       string
+	TimestampMigration     bool
+	LintMigrations         bool
 	callbacks              []func()
 	watcherStarted         bool
 	watcherStarterMutex    sync.Mutex
@@ -41,6 +59,22 @@ func (conf *CLIConfig) IsMigrationEnabled() bool {
 	return len(conf.MigrationSource) > 0
 }
 
+// IsNewMigrationMode returns whether an up and down migration pair named NewMigrationName is to be created in MigrationSource
+// instead of running the application
+func (conf *CLIConfig) IsNewMigrationMode() bool {
+	return len(conf.NewMigrationName) > 0
+}
+
+// IsBackupMode returns whether the DB is to be backed up to BackupPath instead of running the application
+func (conf *CLIConfig) IsBackupMode() bool {
+	return len(conf.BackupPath) > 0
+}
+
+// IsRestoreMode returns whether the DB is to be restored from RestorePath instead of running the application
+func (conf *CLIConfig) IsRestoreMode() bool {
+	return len(conf.RestorePath) > 0
+}
+
 // NotifyOnConfigFileChange registers a callback function for changes to ConfigPath; it calls the `callback` when a change is detected
 func (conf *CLIConfig) NotifyOnConfigFileChange(callback func()) {
 	if conf.DoNotWatchConfigChange {
@@ -211,6 +245,15 @@ var (
 		flags.StringVar(&conf.MigrationSource, "migrate", "", "Migration source folder")
 		flags.BoolVar(&conf.StopOnConfigChange, "stop-on-conf-change", false, "Restart internally on -config change if this flag is absent")
 		flags.BoolVar(&conf.DoNotWatchConfigChange, "do-not-watch-conf-change", false, "Do not watch config change")
+		flags.StringVar(&conf.BackupPath, "backup", "", "Back up the SQLite DB to this file and exit")
+		flags.StringVar(&conf.RestorePath, "restore", "", "Restore the SQLite DB from this backup file and exit")
+		flags.StringVar(&conf.PreMigrationBackupDir, "backup-before-migrate", "", "Back up the SQLite DB into this folder before applying migrations")
+		flags.DurationVar(&conf.MigrationTimeout, "migration-timeout", 0, "Max wait for the migration lock or for another instance to migrate")
+		flags.StringVar(&conf.SeedDir, "seed", "", "Seed folder whose YAML, JSON and CSV files are upserted after -migrate")
+		flags.StringVar(&conf.NewMigrationName, "new-migration", "", "Create the next up and down migration with this name in -migrate and exit")
+		flags.BoolVar(&conf.TimestampMigration, "timestamp-migration", false, "Version -new-migration with the current UTC time instead of the next sequence")
+		flags.BoolVar(&conf.LintMigrations, "lint-migrations", false, "Check -migrate for gaps, duplicates and missing down files and exit")
+		flags.BoolVar(&conf.CheckSchemaDrift, "check-schema-drift", false, "Compare the DB schema, without migrating it, to that of -migrate and exit")
 
 		err = flags.Parse(args)
 		if err != nil {
@@ -231,6 +274,40 @@ var (
 			conf.MigrationSource = "file://" + conf.MigrationSource
 		}
 
+		if (conf.IsNewMigrationMode() || conf.LintMigrations) && !conf.IsMigrationEnabled() {
+			return nil, "Migration source required to create or lint migrations", errMigrationSrcRequired
+		}
+		if len(conf.SeedDir) > 0 {
+			if !conf.IsMigrationEnabled() {
+				return nil, "Migration source required to seed", errMigrationSrcRequired
+			}
+			fileInfo, err := os.Stat(conf.SeedDir)
+			if err != nil {
+				return nil, "Could not determine seed source details", err
+			}
+			if !fileInfo.IsDir() {
+				return nil, "Seed source must be a dir", errSeedSrcNotDir
+			}
+		}
+
+		if conf.IsBackupMode() && conf.IsRestoreMode() {
+			return nil, "Only one of backup and restore can be requested", errBackupAndRestore
+		}
+		if conf.IsRestoreMode() {
+			if _, err := os.Stat(conf.RestorePath); err != nil {
+				return nil, "Could not determine restore source details", err
+			}
+		}
+		if len(conf.PreMigrationBackupDir) > 0 {
+			fileInfo, err := os.Stat(conf.PreMigrationBackupDir)
+			if err != nil {
+				return nil, "Could not determine pre migration backup location details", err
+			}
+			if !fileInfo.IsDir() {
+				return nil, "Pre migration backup location must be a dir", errBackupDirNotDir
+			}
+		}
+
 		return &conf, buf.String(), nil
 	}
 )
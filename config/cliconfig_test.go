@@ -304,4 +304,67 @@ func TestParseCLIArgs(t *testing.T) {
 		assert.True(t, cliConfig.IsMigrationEnabled())
 		assert.Equal(t, "file://"+absPath, cliConfig.MigrationSource)
 	})
+	t.Run("Backup", func(t *testing.T) {
+		t.Parallel()
+		cliConfig, _, err := ParseCLIArgs("sample-app", []string{"-backup", "backup.sqlite3", "-backup-before-migrate", "../migration"})
+		assert.Nil(t, err)
+		assert.True(t, cliConfig.IsBackupMode())
+		assert.False(t, cliConfig.IsRestoreMode())
+		assert.Equal(t, "../migration", cliConfig.PreMigrationBackupDir)
+	})
+	t.Run("Restore", func(t *testing.T) {
+		t.Parallel()
+		cliConfig, _, err := ParseCLIArgs("sample-app", []string{"-restore", "../Makefile"})
+		assert.Nil(t, err)
+		assert.True(t, cliConfig.IsRestoreMode())
+		assert.False(t, cliConfig.IsBackupMode())
+		_, _, err = ParseCLIArgs("sample-app", []string{"-restore", "no such backup"})
+		assert.NotNil(t, err)
+	})
+	t.Run("BackupAndRestore", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := ParseCLIArgs("sample-app", []string{"-backup", "backup.sqlite3", "-restore", "../Makefile"})
+		assert.Equal(t, errBackupAndRestore, err)
+	})
+	t.Run("PreMigrationBackupDirInvalid", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := ParseCLIArgs("sample-app", []string{"-backup-before-migrate", "../Makefile"})
+		assert.Equal(t, errBackupDirNotDir, err)
+		_, _, err = ParseCLIArgs("sample-app", []string{"-backup-before-migrate", "no such path"})
+		assert.NotNil(t, err)
+	})
+	t.Run("MigrationScaffold", func(t *testing.T) {
+		t.Parallel()
+		cliConfig, _, err := ParseCLIArgs("sample-app", []string{"-migrate", "../migration", "-new-migration", "create_users", "-timestamp-migration",
+			"-lint-migrations"})
+		assert.Nil(t, err)
+		assert.True(t, cliConfig.IsNewMigrationMode())
+		assert.True(t, cliConfig.TimestampMigration)
+		assert.True(t, cliConfig.LintMigrations)
+		_, _, err = ParseCLIArgs("sample-app", []string{"-new-migration", "create_users"})
+		assert.Equal(t, errMigrationSrcRequired, err)
+		_, _, err = ParseCLIArgs("sample-app", []string{"-lint-migrations"})
+		assert.Equal(t, errMigrationSrcRequired, err)
+	})
+	t.Run("Seed", func(t *testing.T) {
+		t.Parallel()
+		cliConfig, _, err := ParseCLIArgs("sample-app", []string{"-migrate", "../migration", "-seed", "../migration"})
+		assert.Nil(t, err)
+		assert.Equal(t, "../migration", cliConfig.SeedDir)
+		_, _, err = ParseCLIArgs("sample-app", []string{"-seed", "../migration"})
+		assert.Equal(t, errMigrationSrcRequired, err)
+		_, _, err = ParseCLIArgs("sample-app", []string{"-migrate", "../migration", "-seed", "../Makefile"})
+		assert.Equal(t, errSeedSrcNotDir, err)
+		_, _, err = ParseCLIArgs("sample-app", []string{"-migrate", "../migration", "-seed", "no such path"})
+		assert.NotNil(t, err)
+	})
+	t.Run("CheckSchemaDrift", func(t *testing.T) {
+		t.Parallel()
+		cliConfig, _, err := ParseCLIArgs("sample-app", []string{"-check-schema-drift", "-migrate", "../migration"})
+		assert.Nil(t, err)
+		assert.True(t, cliConfig.CheckSchemaDrift)
+		cliConfig, _, err = ParseCLIArgs("sample-app", []string{})
+		assert.Nil(t, err)
+		assert.False(t, cliConfig.CheckSchemaDrift)
+	})
 }
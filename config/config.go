@@ -1,16 +1,20 @@
 package config
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net"
+	"net/url"
 	"os/user"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-ini/ini"
 
 	// MySQL DB Driver
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	// SQLite3 DB Driver
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -31,6 +35,60 @@ type RelationalDatabaseConfig interface {
 	GetMaxOpenDBConnections() uint16
 }
 
+// QueryLogConfig represents the configuration for slow query logging
+type QueryLogConfig interface {
+	GetSlowQueryThreshold() time.Duration
+	IsQueryArgLoggingEnabled() bool
+}
+
+// SQLiteConfig represents SQLite specific tuning; empty or zero values leave the driver defaults in effect
+type SQLiteConfig interface {
+	GetSQLiteJournalMode() string
+	GetSQLiteSynchronous() string
+	GetSQLiteBusyTimeout() time.Duration
+	GetSQLiteCacheSize() int
+	IsSQLiteWriteSerializationEnabled() bool
+}
+
+// MySQLSettings represents discrete MySQL connection settings which, if Host is set, are assembled into the connection URL
+type MySQLSettings struct {
+	Host           string
+	Port           uint16
+	User           string
+	Password       string
+	Database       string
+	TLSMode        string
+	Charset        string
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+}
+
+// IsConfigured checks whether the settings should be used instead of the raw connection URL
+func (settings *MySQLSettings) IsConfigured() bool {
+	return len(settings.Host) > 0
+}
+
+// FormatDSN assembles the settings into a driver DSN with `parseTime` on and UTC as the time zone
+func (settings *MySQLSettings) FormatDSN() string {
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = net.JoinHostPort(settings.Host, strconv.Itoa(int(settings.Port)))
+	mysqlConfig.User = settings.User
+	mysqlConfig.Passwd = settings.Password
+	mysqlConfig.DBName = settings.Database
+	mysqlConfig.TLSConfig = settings.TLSMode
+	mysqlConfig.Timeout = settings.ConnectTimeout
+	mysqlConfig.ReadTimeout = settings.ReadTimeout
+	mysqlConfig.WriteTimeout = settings.WriteTimeout
+	mysqlConfig.ParseTime = true
+	mysqlConfig.Loc = time.UTC
+	if len(settings.Charset) > 0 {
+		mysqlConfig.Params = map[string]string{"charset": settings.Charset}
+	}
+	return mysqlConfig.FormatDSN()
+}
+
 // HTTPConfig represents the HTTP configuration related behaviors
 type HTTPConfig interface {
 	GetHTTPListeningAddr() string
@@ -38,6 +96,12 @@ type HTTPConfig interface {
 	GetHTTPWriteTimeout() time.Duration
 }
 
+// HTTPProxyConfig represents the configuration for generating absolute links when running behind a proxy or load balancer
+type HTTPProxyConfig interface {
+	GetHTTPPublicBaseURL() string
+	IsForwardedHeaderTrusted() bool
+}
+
 // LogConfig represents the interface for log related configuration
 type LogConfig interface {
 	GetLogLevel() LogLevel
@@ -78,10 +142,29 @@ connxn-max-idle-time-seconds=0
 connxn-max-lifetime-seconds=0
 max-idle-connxns=30
 max-open-connxns=100
+slow-query-threshold-millis=0
+log-query-args=false
+sqlite-journal-mode=
+sqlite-synchronous=
+sqlite-busy-timeout-millis=0
+sqlite-cache-size=0
+sqlite-serialize-writes=false
+mysql-host=
+mysql-port=3306
+mysql-user=
+mysql-password=
+mysql-database=
+mysql-tls=false
+mysql-charset=utf8mb4
+mysql-connect-timeout-seconds=0
+mysql-read-timeout-seconds=0
+mysql-write-timeout-seconds=0
 [http]
 listener=:7050
 read-timeout=240
 write-timeout=240
+public-base-url=
+trust-forwarded-headers=false
 [log]
 filename=
 max-file-size-in-mb=200
@@ -95,6 +178,18 @@ log-level=debug
 	DefaultLoadFunc   = GetLoadFunc(DefaultConfiguration, ConfigFilename, "/etc/appconfig/", "/.appconfig/")
 	LoadConfiguration = DefaultLoadFunc
 	errDBDialect      = errors.New("DB Dialect not supported")
+	// errPublicBaseURL is returned when public-base-url is not an absolute URL
+	errPublicBaseURL = errors.New("public base URL must be absolute with scheme and host")
+	// errSQLiteJournalMode is returned when sqlite-journal-mode is not a SQLite journal mode
+	errSQLiteJournalMode = errors.New("sqlite journal mode must be one of DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF")
+	// errSQLiteSynchronous is returned when sqlite-synchronous is not a SQLite synchronous level
+	errSQLiteSynchronous = errors.New("sqlite synchronous must be one of OFF, NORMAL, FULL or EXTRA")
+	// errMySQLParseTime is returned when the MySQL connection URL does not enable `parseTime`, needed to scan timestamps into time.Time
+	errMySQLParseTime = errors.New("mysql connection url must have parseTime=true")
+	// errMySQLTimeZone is returned when the MySQL connection URL's `loc` is not UTC
+	errMySQLTimeZone   = errors.New("mysql connection url must use UTC as loc")
+	sqliteJournalModes = map[string]bool{"DELETE": true, "TRUNCATE": true, "PERSIST": true, "MEMORY": true, "WAL": true, "OFF": true}
+	sqliteSynchronous  = map[string]bool{"OFF": true, "NORMAL": true, "FULL": true, "EXTRA": true}
 	// ConfigInjector sets up configuration related bindings
 )
 
@@ -126,9 +221,19 @@ type Config struct {
 	DBConnectionMaxLifetime time.Duration
 	DBMaxIdleConnections    uint16
 	DBMaxOpenConnections    uint16
+	DBSlowQueryThreshold    time.Duration
+	DBLogQueryArgs          bool
+	DBMySQLSettings         MySQLSettings
+	SQLiteJournalMode       string
+	SQLiteSynchronous       string
+	SQLiteBusyTimeout       time.Duration
+	SQLiteCacheSize         int
+	SQLiteSerializeWrites   bool
 	HTTPListeningAddr       string
 	HTTPReadTimeout         time.Duration
 	HTTPWriteTimeout        time.Duration
+	HTTPPublicBaseURL       string
+	TrustForwardedHeaders   bool
 	LogFilename             string
 	MaxFileSize             uint
 	MaxBackups              uint
@@ -172,6 +277,41 @@ func (config *Config) GetMaxOpenDBConnections() uint16 {
 	return config.DBMaxOpenConnections
 }
 
+// GetSlowQueryThreshold returns the duration above which queries are logged as slow; 0 disables slow query logging
+func (config *Config) GetSlowQueryThreshold() time.Duration {
+	return config.DBSlowQueryThreshold
+}
+
+// IsQueryArgLoggingEnabled checks whether slow query logs include argument values instead of redacting them
+func (config *Config) IsQueryArgLoggingEnabled() bool {
+	return config.DBLogQueryArgs
+}
+
+// GetSQLiteJournalMode returns the SQLite journal mode, e.g. WAL; empty for the driver default
+func (config *Config) GetSQLiteJournalMode() string {
+	return config.SQLiteJournalMode
+}
+
+// GetSQLiteSynchronous returns the SQLite synchronous level, e.g. NORMAL; empty for the driver default
+func (config *Config) GetSQLiteSynchronous() string {
+	return config.SQLiteSynchronous
+}
+
+// GetSQLiteBusyTimeout returns how long SQLite waits on a locked database before failing; 0 for the driver default
+func (config *Config) GetSQLiteBusyTimeout() time.Duration {
+	return config.SQLiteBusyTimeout
+}
+
+// GetSQLiteCacheSize returns the SQLite page cache size, in pages if positive and in KiB if negative; 0 for the driver default
+func (config *Config) GetSQLiteCacheSize() int {
+	return config.SQLiteCacheSize
+}
+
+// IsSQLiteWriteSerializationEnabled checks whether write transactions are run one at a time
+func (config *Config) IsSQLiteWriteSerializationEnabled() bool {
+	return config.SQLiteSerializeWrites
+}
+
 // GetHTTPListeningAddr retrieves the connection string to listen to
 func (config *Config) GetHTTPListeningAddr() string {
 	return config.HTTPListeningAddr
@@ -187,6 +327,16 @@ func (config *Config) GetHTTPWriteTimeout() time.Duration {
 	return config.HTTPWriteTimeout
 }
 
+// GetHTTPPublicBaseURL retrieves the externally visible base URL used for absolute links; empty if not configured
+func (config *Config) GetHTTPPublicBaseURL() string {
+	return config.HTTPPublicBaseURL
+}
+
+// IsForwardedHeaderTrusted checks whether X-Forwarded-* and Forwarded headers are trusted for building links
+func (config *Config) IsForwardedHeaderTrusted() bool {
+	return config.TrustForwardedHeaders
+}
+
 // IsLoggerConfigAvailable checks is logger configuration is set since its optional
 func (config *Config) IsLoggerConfigAvailable() bool {
 	return len(config.LogFilename) > 0
@@ -233,6 +383,24 @@ func GetConfigurationFromCLIConfig(cliConfig *CLIConfig) (*Config, *ini.File, er
 	return GetAutoConfiguration()
 }
 
+// GetDBConfigurationFromCLIConfig loads only the `rdbms` configuration, e.g. for reconfiguring a running DB pool. Unlike
+// GetConfigurationFromCLIConfig it neither checks the HTTP listener nor connects to the DB.
+func GetDBConfigurationFromCLIConfig(cliConfig *CLIConfig) (*Config, error) {
+	cfg, err := LoadConfiguration(cliConfig.ConfigPath)
+	if err != nil {
+		return EmptyConfigurationForError, err
+	}
+	configuration := &Config{}
+	setupStorageConfiguration(cfg, configuration)
+	if !isSupportedDialect(configuration.DBDialect) {
+		return EmptyConfigurationForError, errDBDialect
+	}
+	if err := validateStorageConfiguration(configuration); err != nil {
+		return EmptyConfigurationForError, err
+	}
+	return configuration, nil
+}
+
 // GetConfiguration gets the current state of application configuration
 func GetConfiguration(configFilePath string) (*Config, *ini.File, error) {
 	cfg, err := LoadConfiguration(configFilePath)
@@ -259,6 +427,18 @@ func validateConfigurationState(configuration *Config) error {
 	if len(configuration.HTTPListeningAddr) <= 0 {
 		configuration.HTTPListeningAddr = ":8080"
 	}
+	if len(configuration.HTTPPublicBaseURL) > 0 {
+		publicURL, urlErr := url.Parse(configuration.HTTPPublicBaseURL)
+		if urlErr != nil {
+			return urlErr
+		}
+		if !publicURL.IsAbs() || len(publicURL.Host) <= 0 {
+			return errPublicBaseURL
+		}
+	}
+	if err := validateStorageConfiguration(configuration); err != nil {
+		return err
+	}
 	// Check Listener Address port is open
 	ln, netErr := net.Listen("tcp", configuration.HTTPListeningAddr)
 	if netErr != nil {
@@ -266,13 +446,7 @@ func validateConfigurationState(configuration *Config) error {
 	}
 	defer ln.Close()
 	// Check DB Connection is valid
-	var ping func(*sql.DB) error
-	switch configuration.DBDialect {
-	case SQLite3Dialect:
-		ping = pingSqlite3
-	case MySQLDialect:
-		ping = pingMysql
-	default:
+	if !isSupportedDialect(configuration.DBDialect) {
 		return errDBDialect
 	}
 	db, dbConnectionErr := sql.Open(string(configuration.DBDialect), configuration.DBConnectionURL)
@@ -285,33 +459,89 @@ func validateConfigurationState(configuration *Config) error {
 	db.SetMaxOpenConns(int(configuration.DBMaxOpenConnections))
 	db.SetConnMaxIdleTime(configuration.DBConnectionMaxIdleTime)
 	var typicalErr error
-	dbErr := ping(db)
+	dbErr := PingDB(configuration.DBDialect, db)
 	if dbErr != nil {
 		typicalErr = dbErr
 	}
 	return typicalErr
 }
 
+// PingDB checks the DB is reachable and usable with a dialect specific query
+func PingDB(dialect DBDialect, db *sql.DB) error {
+	switch dialect {
+	case SQLite3Dialect:
+		return pingSqlite3(db)
+	case MySQLDialect:
+		return pingMysql(db)
+	default:
+		return errDBDialect
+	}
+}
+
+// PingDBContext is same as PingDB but runs the query with ctx, so it is abandoned when ctx is done
+func PingDBContext(ctx context.Context, dialect DBDialect, db *sql.DB) error {
+	query, ok := pingQueries[dialect]
+	if !ok {
+		return errDBDialect
+	}
+	return pingWithQuery(ctx, db, query)
+}
+
+func validateStorageConfiguration(configuration *Config) error {
+	if len(configuration.SQLiteJournalMode) > 0 && !sqliteJournalModes[configuration.SQLiteJournalMode] {
+		return errSQLiteJournalMode
+	}
+	if len(configuration.SQLiteSynchronous) > 0 && !sqliteSynchronous[configuration.SQLiteSynchronous] {
+		return errSQLiteSynchronous
+	}
+	if configuration.DBDialect == MySQLDialect {
+		return validateMySQLConnectionURL(configuration.DBConnectionURL)
+	}
+	return nil
+}
+
+func validateMySQLConnectionURL(connectionURL string) error {
+	mysqlConfig, err := mysql.ParseDSN(connectionURL)
+	if err != nil {
+		return err
+	}
+	if !mysqlConfig.ParseTime {
+		return errMySQLParseTime
+	}
+	if mysqlConfig.Loc != time.UTC {
+		return errMySQLTimeZone
+	}
+	return nil
+}
+
+func isSupportedDialect(dialect DBDialect) bool {
+	return dialect == SQLite3Dialect || dialect == MySQLDialect
+}
+
 var (
+	pingQueries = map[DBDialect]string{
+		SQLite3Dialect: "SELECT name FROM sqlite_master WHERE type='table'",
+		MySQLDialect:   "SHOW Tables",
+	}
+
 	pingSqlite3 = func(db *sql.DB) error {
-		rows, queryErr := db.Query("SELECT name FROM sqlite_master WHERE type='table'")
-		if queryErr != nil {
-			return queryErr
-		}
-		defer rows.Close()
-		return nil
+		return pingWithQuery(context.Background(), db, pingQueries[SQLite3Dialect])
 	}
 
 	pingMysql = func(db *sql.DB) error {
-		rows, queryErr := db.Query("SHOW Tables")
-		if queryErr != nil {
-			return queryErr
-		}
-		defer rows.Close()
-		return nil
+		return pingWithQuery(context.Background(), db, pingQueries[MySQLDialect])
 	}
 )
 
+func pingWithQuery(ctx context.Context, db *sql.DB, query string) error {
+	rows, queryErr := db.QueryContext(ctx, query)
+	if queryErr != nil {
+		return queryErr
+	}
+	defer rows.Close()
+	return nil
+}
+
 func setupStorageConfiguration(cfg *ini.File, configuration *Config) {
 	dbSection, _ := cfg.GetSection("rdbms")
 	dbDialect, _ := dbSection.GetKey("dialect")
@@ -326,6 +556,28 @@ func setupStorageConfiguration(cfg *ini.File, configuration *Config) {
 	configuration.DBConnectionMaxLifetime = time.Duration(dbMaxLifetimeInSec.MustUint(0)) * time.Second
 	configuration.DBMaxIdleConnections = uint16(dbMaxIdleConnections.MustUint(10))
 	configuration.DBMaxOpenConnections = uint16(dbMaxOpenConnections.MustUint(50))
+	configuration.DBSlowQueryThreshold = time.Duration(dbSection.Key("slow-query-threshold-millis").MustUint(0)) * time.Millisecond
+	configuration.DBLogQueryArgs = dbSection.Key("log-query-args").MustBool(false)
+	configuration.SQLiteJournalMode = strings.ToUpper(strings.TrimSpace(dbSection.Key("sqlite-journal-mode").String()))
+	configuration.SQLiteSynchronous = strings.ToUpper(strings.TrimSpace(dbSection.Key("sqlite-synchronous").String()))
+	configuration.SQLiteBusyTimeout = time.Duration(dbSection.Key("sqlite-busy-timeout-millis").MustUint(0)) * time.Millisecond
+	configuration.SQLiteCacheSize = dbSection.Key("sqlite-cache-size").MustInt(0)
+	configuration.SQLiteSerializeWrites = dbSection.Key("sqlite-serialize-writes").MustBool(false)
+	configuration.DBMySQLSettings = MySQLSettings{
+		Host:           strings.TrimSpace(dbSection.Key("mysql-host").String()),
+		Port:           uint16(dbSection.Key("mysql-port").MustUint(3306)),
+		User:           dbSection.Key("mysql-user").String(),
+		Password:       dbSection.Key("mysql-password").String(),
+		Database:       dbSection.Key("mysql-database").String(),
+		TLSMode:        strings.TrimSpace(dbSection.Key("mysql-tls").String()),
+		Charset:        strings.TrimSpace(dbSection.Key("mysql-charset").String()),
+		ConnectTimeout: time.Duration(dbSection.Key("mysql-connect-timeout-seconds").MustUint(0)) * time.Second,
+		ReadTimeout:    time.Duration(dbSection.Key("mysql-read-timeout-seconds").MustUint(0)) * time.Second,
+		WriteTimeout:   time.Duration(dbSection.Key("mysql-write-timeout-seconds").MustUint(0)) * time.Second,
+	}
+	if configuration.DBDialect == MySQLDialect && configuration.DBMySQLSettings.IsConfigured() {
+		configuration.DBConnectionURL = configuration.DBMySQLSettings.FormatDSN()
+	}
 }
 
 func setupHTTPConfiguration(cfg *ini.File, configuration *Config) {
@@ -333,9 +585,13 @@ func setupHTTPConfiguration(cfg *ini.File, configuration *Config) {
 	httpListener, _ := httpSection.GetKey("listener")
 	httpReadTimeout, _ := httpSection.GetKey("read-timeout")
 	httpWriteTimeout, _ := httpSection.GetKey("write-timeout")
+	httpPublicBaseURL := httpSection.Key("public-base-url")
+	httpTrustForwarded := httpSection.Key("trust-forwarded-headers")
 	configuration.HTTPListeningAddr = httpListener.String()
 	configuration.HTTPReadTimeout = time.Duration(httpReadTimeout.MustUint(180)) * time.Second
 	configuration.HTTPWriteTimeout = time.Duration(httpWriteTimeout.MustUint(180)) * time.Second
+	configuration.HTTPPublicBaseURL = strings.TrimSpace(httpPublicBaseURL.String())
+	configuration.TrustForwardedHeaders = httpTrustForwarded.MustBool(false)
 }
 
 func setupLogConfiguration(cfg *ini.File, configuration *Config) {
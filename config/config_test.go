@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net"
@@ -63,9 +64,19 @@ func TestGetAutoConfiguration_Default(t *testing.T) {
 	assert.Equal(t, time.Duration(0), config.GetDBConnectionMaxLifetime())
 	assert.Equal(t, uint16(30), config.GetMaxIdleDBConnections())
 	assert.Equal(t, uint16(100), config.GetMaxOpenDBConnections())
+	assert.Equal(t, time.Duration(0), config.GetSlowQueryThreshold())
+	assert.Equal(t, false, config.IsQueryArgLoggingEnabled())
+	assert.Equal(t, "", config.GetSQLiteJournalMode())
+	assert.Equal(t, "", config.GetSQLiteSynchronous())
+	assert.Equal(t, time.Duration(0), config.GetSQLiteBusyTimeout())
+	assert.Equal(t, 0, config.GetSQLiteCacheSize())
+	assert.Equal(t, false, config.IsSQLiteWriteSerializationEnabled())
+	assert.Equal(t, MySQLSettings{Port: 3306, TLSMode: "false", Charset: "utf8mb4"}, config.DBMySQLSettings)
 	assert.Equal(t, ":7050", config.GetHTTPListeningAddr())
 	assert.Equal(t, toSecond(uint(240)), config.GetHTTPReadTimeout())
 	assert.Equal(t, toSecond(uint(240)), config.GetHTTPWriteTimeout())
+	assert.Equal(t, "", config.GetHTTPPublicBaseURL())
+	assert.Equal(t, false, config.IsForwardedHeaderTrusted())
 	assert.Equal(t, "", config.GetLogFilename())
 	assert.Equal(t, Debug, config.GetLogLevel())
 	assert.Equal(t, uint(200), config.GetMaxLogFileSize())
@@ -143,6 +154,13 @@ func TestGetConfiguration(t *testing.T) {
 	assert.Equal(t, toSecond(10), config.GetDBConnectionMaxLifetime())
 	assert.Equal(t, uint16(300), config.GetMaxIdleDBConnections())
 	assert.Equal(t, uint16(1000), config.GetMaxOpenDBConnections())
+	assert.Equal(t, 250*time.Millisecond, config.GetSlowQueryThreshold())
+	assert.Equal(t, true, config.IsQueryArgLoggingEnabled())
+	assert.Equal(t, "WAL", config.GetSQLiteJournalMode())
+	assert.Equal(t, "NORMAL", config.GetSQLiteSynchronous())
+	assert.Equal(t, 5*time.Second, config.GetSQLiteBusyTimeout())
+	assert.Equal(t, -2000, config.GetSQLiteCacheSize())
+	assert.Equal(t, true, config.IsSQLiteWriteSerializationEnabled())
 	assert.Equal(t, ":7080", config.GetHTTPListeningAddr())
 	assert.Equal(t, toSecond(uint(2401)), config.GetHTTPReadTimeout())
 	assert.Equal(t, toSecond(uint(2401)), config.GetHTTPWriteTimeout())
@@ -221,6 +239,77 @@ func TestGetConfigurationFromParseConfig_ValueError(t *testing.T) {
 		assert.Equal(t, EmptyConfigurationForError, config)
 		assert.NotNil(t, err)
 	})
+	t.Run("SQLiteJournalModeInvalid", func(t *testing.T) {
+		t.Parallel()
+		testConfig := `[rdbms]
+		sqlite-journal-mode=fast
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Equal(t, EmptyConfigurationForError, config)
+		assert.Equal(t, errSQLiteJournalMode, err)
+	})
+	t.Run("SQLiteSynchronousInvalid", func(t *testing.T) {
+		t.Parallel()
+		testConfig := `[rdbms]
+		sqlite-synchronous=sometimes
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Equal(t, EmptyConfigurationForError, config)
+		assert.Equal(t, errSQLiteSynchronous, err)
+	})
+	t.Run("MySQLParseTimeOff", func(t *testing.T) {
+		t.Parallel()
+		testConfig := `[rdbms]
+		dialect=mysql
+		connection-url=webhook_broker:zxc909zxc@tcp(mysql:3306)/webhook-broker?charset=utf8
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Equal(t, EmptyConfigurationForError, config)
+		assert.Equal(t, errMySQLParseTime, err)
+	})
+	t.Run("MySQLTimeZoneNotUTC", func(t *testing.T) {
+		t.Parallel()
+		testConfig := `[rdbms]
+		dialect=mysql
+		connection-url=webhook_broker:zxc909zxc@tcp(mysql:3306)/webhook-broker?parseTime=true&loc=America%2FNew_York
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Equal(t, EmptyConfigurationForError, config)
+		assert.Equal(t, errMySQLTimeZone, err)
+	})
+	t.Run("MySQLUnknownTLSMode", func(t *testing.T) {
+		t.Parallel()
+		testConfig := `[rdbms]
+		dialect=mysql
+		mysql-host=mysql
+		mysql-tls=custom
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Equal(t, EmptyConfigurationForError, config)
+		assert.NotNil(t, err)
+	})
+	t.Run("PublicBaseURLNotAbsolute", func(t *testing.T) {
+		t.Parallel()
+		testConfig := `[http]
+		listener=:48091
+		public-base-url=/relative/path
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Equal(t, EmptyConfigurationForError, config)
+		assert.Equal(t, errPublicBaseURL, err)
+	})
+	t.Run("PublicBaseURL", func(t *testing.T) {
+		t.Parallel()
+		testConfig := `[http]
+		listener=:48092
+		public-base-url=https://api.example.com/v1
+		trust-forwarded-headers=true
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Nil(t, err)
+		assert.Equal(t, "https://api.example.com/v1", config.GetHTTPPublicBaseURL())
+		assert.True(t, config.IsForwardedHeaderTrusted())
+	})
 	t.Run("HTTPListenerNotAvailable", func(t *testing.T) {
 		t.Parallel()
 		testConfig := `
@@ -251,6 +340,23 @@ func TestGetConfigurationFromParseConfig_ValueError(t *testing.T) {
 		err := pingMysql(db)
 		assert.Equal(t, mockedErr, err)
 	})
+	t.Run("PingDB", func(t *testing.T) {
+		t.Parallel()
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery("SHOW Tables").WillReturnRows(sqlmock.NewRows([]string{"Table Name"}))
+		assert.Nil(t, PingDB(MySQLDialect, db))
+		assert.Equal(t, errDBDialect, PingDB(DBDialect("mockdb"), db))
+	})
+	t.Run("PingDBContext", func(t *testing.T) {
+		t.Parallel()
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery("SELECT name FROM sqlite_master WHERE type='table'").WillReturnRows(sqlmock.NewRows([]string{"name"}))
+		assert.Nil(t, PingDBContext(context.Background(), SQLite3Dialect, db))
+		assert.Equal(t, errDBDialect, PingDBContext(context.Background(), DBDialect("mockdb"), db))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, context.Canceled, PingDBContext(ctx, MySQLDialect, db))
+	})
 	t.Run("DBPingMySQL", func(t *testing.T) {
 		t.Parallel()
 		db, mock, _ := sqlmock.New()
@@ -261,6 +367,44 @@ func TestGetConfigurationFromParseConfig_ValueError(t *testing.T) {
 	})
 }
 
+func TestMySQLSettings(t *testing.T) {
+	t.Run("Parsed", func(t *testing.T) {
+		oldPingMysql := pingMysql
+		defer func() { pingMysql = oldPingMysql }()
+		pingMysql = func(db *sql.DB) error { return nil }
+		testConfig := `[rdbms]
+		dialect=mysql
+		mysql-host=mysql
+		mysql-port=3307
+		mysql-user=webhook_broker
+		mysql-password=p@ss:word/1
+		mysql-database=webhook-broker
+		mysql-tls=skip-verify
+		mysql-connect-timeout-seconds=5
+		mysql-read-timeout-seconds=30
+		mysql-write-timeout-seconds=31
+		[http]
+		listener=:48093
+		`
+		config, err := GetConfigurationFromParseConfig(loadTestConfiguration(testConfig))
+		assert.Nil(t, err)
+		assert.Equal(t, MySQLSettings{Host: "mysql", Port: 3307, User: "webhook_broker", Password: "p@ss:word/1", Database: "webhook-broker",
+			TLSMode: "skip-verify", Charset: "utf8mb4", ConnectTimeout: 5 * time.Second, ReadTimeout: 30 * time.Second, WriteTimeout: 31 * time.Second},
+			config.DBMySQLSettings)
+		assert.Equal(t, "webhook_broker:p@ss:word/1@tcp(mysql:3307)/webhook-broker?parseTime=true&readTimeout=30s&timeout=5s&tls=skip-verify&writeTimeout=31s&charset=utf8mb4",
+			config.GetDBConnectionURL())
+	})
+	t.Run("FormatDSN", func(t *testing.T) {
+		t.Parallel()
+		settings := &MySQLSettings{Host: "::1", Port: 3306, User: "user", Database: "db"}
+		assert.True(t, settings.IsConfigured())
+		assert.False(t, (&MySQLSettings{}).IsConfigured())
+		dsn := settings.FormatDSN()
+		assert.Equal(t, "user@tcp([::1]:3306)/db?parseTime=true", dsn)
+		assert.Nil(t, validateMySQLConnectionURL(dsn))
+	})
+}
+
 func TestGetConfigurationFromCLIConfig(t *testing.T) {
 	t.Run("EmptyPath", func(t *testing.T) {
 		_, _, err := GetConfigurationFromCLIConfig(&CLIConfig{})
@@ -272,6 +416,32 @@ func TestGetConfigurationFromCLIConfig(t *testing.T) {
 	})
 }
 
+func TestGetDBConfigurationFromCLIConfig(t *testing.T) {
+	t.Run("WithPath", func(t *testing.T) {
+		config, err := GetDBConfigurationFromCLIConfig(&CLIConfig{ConfigPath: "./test-appconfig.cfg"})
+		assert.Nil(t, err)
+		assert.Equal(t, SQLite3Dialect, config.GetDBDialect())
+		assert.Equal(t, uint16(1000), config.GetMaxOpenDBConnections())
+		assert.Equal(t, "", config.GetHTTPListeningAddr())
+	})
+	t.Run("LoadError", func(t *testing.T) {
+		oldLoadConfiguration := LoadConfiguration
+		defer func() { LoadConfiguration = oldLoadConfiguration }()
+		expectedErr := errors.New("load error")
+		LoadConfiguration = func(string) (*ini.File, error) { return nil, expectedErr }
+		config, err := GetDBConfigurationFromCLIConfig(&CLIConfig{})
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, EmptyConfigurationForError, config)
+	})
+	t.Run("DialectError", func(t *testing.T) {
+		oldLoadConfiguration := LoadConfiguration
+		defer func() { LoadConfiguration = oldLoadConfiguration }()
+		LoadConfiguration = func(string) (*ini.File, error) { return loadTestConfiguration("[rdbms]\ndialect=oracle\n"), nil }
+		_, err := GetDBConfigurationFromCLIConfig(&CLIConfig{})
+		assert.Equal(t, errDBDialect, err)
+	})
+}
+
 func TestMigrationEnabled(t *testing.T) {
 	t.Run("MigrationEnabled", func(t *testing.T) {
 		t.Parallel()
@@ -287,6 +457,9 @@ func TestMigrationEnabled(t *testing.T) {
 
 func TestConfigInterfaces(t *testing.T) {
 	var _ RelationalDatabaseConfig = (*Config)(nil)
+	var _ QueryLogConfig = (*Config)(nil)
+	var _ SQLiteConfig = (*Config)(nil)
 	var _ HTTPConfig = (*Config)(nil)
+	var _ HTTPProxyConfig = (*Config)(nil)
 	var _ LogConfig = (*Config)(nil)
 }
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// entity headers that must not be sent with 304 Not Modified
+var notModifiedStrippedHeaders = []string{HeaderContentType, "Content-Length", "Content-Encoding"}
+
+// WriteValidators sets `ETag` and `Last-Modified` headers; empty eTag or zero lastModified are skipped. Must be called before writing the status.
+func WriteValidators(w http.ResponseWriter, eTag string, lastModified time.Time) {
+	if len(eTag) > 0 {
+		w.Header().Set(HeaderETag, eTag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set(HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// IsNotModified evaluates `If-None-Match` or, in its absence, `If-Modified-Since` of a GET/HEAD request against the validators
+func IsNotModified(req *http.Request, eTag string, lastModified time.Time) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch := req.Header.Get(HeaderIfNoneMatch); len(ifNoneMatch) > 0 {
+		for _, entityTag := range parseEntityTags(ifNoneMatch) {
+			if entityTag == anyEntityTag || (len(eTag) > 0 && weakETagValue(entityTag) == weakETagValue(eTag)) {
+				return true
+			}
+		}
+		return false
+	}
+	if ifModifiedSince := req.Header.Get(HeaderIfModifiedSince); len(ifModifiedSince) > 0 && !lastModified.IsZero() {
+		if since, err := http.ParseTime(ifModifiedSince); err == nil {
+			return !lastModified.Truncate(time.Second).After(since)
+		}
+	}
+	return false
+}
+
+// WriteNotModified writes 304 with the validators, allowing handlers to skip loading the body
+func WriteNotModified(w http.ResponseWriter, eTag string, lastModified time.Time) {
+	WriteValidators(w, eTag, lastModified)
+	for _, header := range notModifiedStrippedHeaders {
+		w.Header().Del(header)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// weakETagValue strips the weak indicator for weak comparison as per RFC 7232
+func weakETagValue(eTag string) string {
+	return strings.TrimPrefix(eTag, weakEntityPrefix)
+}
+
+// conditionalGetResponseWriter replaces a 200 response with 304 when the validators set by the handler satisfy request's conditions
+type conditionalGetResponseWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	wroteHeader bool
+	notModified bool
+}
+
+func (writer *conditionalGetResponseWriter) WriteHeader(code int) {
+	if writer.wroteHeader {
+		return
+	}
+	writer.wroteHeader = true
+	if code == http.StatusOK {
+		header := writer.Header()
+		eTag := header.Get(HeaderETag)
+		var lastModified time.Time
+		if lastModifiedValue := header.Get(HeaderLastModified); len(lastModifiedValue) > 0 {
+			lastModified, _ = http.ParseTime(lastModifiedValue)
+		}
+		if (len(eTag) > 0 || !lastModified.IsZero()) && IsNotModified(writer.request, eTag, lastModified) {
+			writer.notModified = true
+			WriteNotModified(writer.ResponseWriter, eTag, lastModified)
+			return
+		}
+	}
+	writer.ResponseWriter.WriteHeader(code)
+}
+
+func (writer *conditionalGetResponseWriter) Write(body []byte) (int, error) {
+	if !writer.wroteHeader {
+		writer.WriteHeader(http.StatusOK)
+	}
+	if writer.notModified {
+		return len(body), nil
+	}
+	return writer.ResponseWriter.Write(body)
+}
+
+// Flush passes through to underlying writer if it supports flushing
+func (writer *conditionalGetResponseWriter) Flush() {
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok && !writer.notModified {
+		flusher.Flush()
+	}
+}
+
+// ConditionalGetHandler answers GET/HEAD with 304 Not Modified, without the body, when the handler responds 200 with `ETag` or
+// `Last-Modified` header matching `If-None-Match` or `If-Modified-Since` of the request
+func ConditionalGetHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(r.Header.Get(HeaderIfNoneMatch)) <= 0 && len(r.Header.Get(HeaderIfModifiedSince)) <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&conditionalGetResponseWriter{ResponseWriter: w, request: r}, r)
+	})
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/data"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func getConditionalGetTestHandler(model *data.BasePaginateable) http.Handler {
+	apiRouter := httprouter.New()
+	apiRouter.GET("/model", func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		WriteValidators(rw, model.GetETag(), model.UpdatedAt)
+		WriteJSON(rw, map[string]string{"id": model.ID.String()})
+	})
+	apiRouter.GET("/no-validator", func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		rw.Write([]byte("body"))
+	})
+	return getHandler(apiRouter)
+}
+
+func serveConditionalGet(handler http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestConditionalGetHandler(t *testing.T) {
+	model := &data.BasePaginateable{}
+	model.QuickFix()
+	handler := getConditionalGetTestHandler(model)
+	t.Run("NoConditions", func(t *testing.T) {
+		t.Parallel()
+		resp := serveConditionalGet(handler, "GET", "/model", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, model.GetETag(), resp.Header().Get(HeaderETag))
+		assert.Equal(t, model.GetLastUpdatedHTTPTimeString(), resp.Header().Get(HeaderLastModified))
+		assert.Greater(t, resp.Body.Len(), 0)
+	})
+	t.Run("IfNoneMatch", func(t *testing.T) {
+		t.Parallel()
+		resp := serveConditionalGet(handler, "GET", "/model", map[string]string{HeaderIfNoneMatch: `"other", ` + model.GetWeakETag()})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+		assert.Equal(t, 0, resp.Body.Len())
+		assert.Equal(t, model.GetETag(), resp.Header().Get(HeaderETag))
+	})
+	t.Run("IfNoneMatchMismatchIgnoresIfModifiedSince", func(t *testing.T) {
+		t.Parallel()
+		resp := serveConditionalGet(handler, "GET", "/model", map[string]string{HeaderIfNoneMatch: `"other"`, HeaderIfModifiedSince: model.GetLastUpdatedHTTPTimeString()})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Greater(t, resp.Body.Len(), 0)
+	})
+	t.Run("IfModifiedSince", func(t *testing.T) {
+		t.Parallel()
+		resp := serveConditionalGet(handler, "GET", "/model", map[string]string{HeaderIfModifiedSince: model.GetLastUpdatedHTTPTimeString()})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+		earlier := model.UpdatedAt.Add(-1 * time.Hour).UTC().Format(http.TimeFormat)
+		resp = serveConditionalGet(handler, "GET", "/model", map[string]string{HeaderIfModifiedSince: earlier})
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+	t.Run("NoValidators", func(t *testing.T) {
+		t.Parallel()
+		resp := serveConditionalGet(handler, "GET", "/no-validator", map[string]string{HeaderIfNoneMatch: "*"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "body", resp.Body.String())
+	})
+}
+
+func TestIsNotModified(t *testing.T) {
+	now := time.Now()
+	putReq := httptest.NewRequest("PUT", "/model", nil)
+	putReq.Header.Set(HeaderIfNoneMatch, "*")
+	assert.False(t, IsNotModified(putReq, `"a"`, now))
+	getReq := httptest.NewRequest("GET", "/model", nil)
+	getReq.Header.Set(HeaderIfNoneMatch, "*")
+	assert.True(t, IsNotModified(getReq, `"a"`, now))
+	getReq = httptest.NewRequest("GET", "/model", nil)
+	getReq.Header.Set(HeaderIfModifiedSince, "invalid")
+	assert.False(t, IsNotModified(getReq, "", now))
+	resp := httptest.NewRecorder()
+	resp.Header().Set(HeaderContentType, JSONContentTypeHeaderValue)
+	WriteNotModified(resp, `"a"`, time.Time{})
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Equal(t, "", resp.Header().Get(HeaderContentType))
+	assert.Equal(t, "", resp.Header().Get(HeaderLastModified))
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/julienschmidt/httprouter"
+)
+
+// PoolHealthProvider supplies the DB pool health, e.g. *storage.PoolMonitor
+type PoolHealthProvider interface {
+	GetHealth() *dbcore.PoolHealth
+}
+
+// WritePoolHealth writes the pool health as JSON; 200 if the pool is healthy or degraded and 503 if it is unhealthy
+func WritePoolHealth(w http.ResponseWriter, health *dbcore.PoolHealth) {
+	var buf bytes.Buffer
+	if err := getJSON(&buf, health); err != nil {
+		WriteErr(w, err)
+		return
+	}
+	status := http.StatusOK
+	if !health.IsAvailable() {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set(HeaderContentType, JSONContentTypeHeaderValue)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// HealthCheckHandler returns a handler, e.g. for `GET /_status`, writing the latest pool health
+func HealthCheckHandler(provider PoolHealthProvider) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		WritePoolHealth(w, provider.GetHealth())
+	}
+}
+
+// MigrationReadinessHandler returns a handler, e.g. for `GET /_ready`, writing the startup migration state as JSON; 200 once migration
+// is complete and 503 until then
+func MigrationReadinessHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var buf bytes.Buffer
+		state := dbcore.GetMigrationState()
+		if err := getJSON(&buf, map[string]dbcore.MigrationState{"migrationState": state}); err != nil {
+			WriteErr(w, err)
+			return
+		}
+		status := http.StatusOK
+		if state != dbcore.MigrationComplete {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set(HeaderContentType, JSONContentTypeHeaderValue)
+		w.WriteHeader(status)
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/stretchr/testify/assert"
+)
+
+type poolHealthStub struct {
+	health *dbcore.PoolHealth
+}
+
+func (stub *poolHealthStub) GetHealth() *dbcore.PoolHealth { return stub.health }
+
+func TestHealthCheckHandler(t *testing.T) {
+	statuses := map[dbcore.PoolHealthStatus]int{dbcore.PoolHealthy: http.StatusOK, dbcore.PoolDegraded: http.StatusOK,
+		dbcore.PoolUnhealthy: http.StatusServiceUnavailable}
+	for status, expectedCode := range statuses {
+		stub := &poolHealthStub{health: &dbcore.PoolHealth{Status: status, Stats: dbcore.PoolStats{InUse: 3}, Reasons: []string{"reason"}}}
+		resp := httptest.NewRecorder()
+		HealthCheckHandler(stub)(resp, httptest.NewRequest(http.MethodGet, "/_status", nil), nil)
+		assert.Equal(t, expectedCode, resp.Code)
+		assert.Equal(t, JSONContentTypeHeaderValue, resp.Header().Get(HeaderContentType))
+		var body dbcore.PoolHealth
+		assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		assert.Equal(t, status, body.Status)
+		assert.Equal(t, 3, body.Stats.InUse)
+		assert.Equal(t, []string{"reason"}, body.Reasons)
+	}
+}
+
+func TestMigrationReadinessHandler(t *testing.T) {
+	resp := httptest.NewRecorder()
+	MigrationReadinessHandler()(resp, httptest.NewRequest(http.MethodGet, "/_ready", nil), nil)
+	var body map[string]dbcore.MigrationState
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, dbcore.MigrationPending, body["migrationState"])
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+}
@@ -1,54 +1,359 @@
 package controller
 
 import (
+	"bytes"
+	"errors"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/imyousuf/appcommons/config"
 	"github.com/imyousuf/appcommons/data"
+	"github.com/rs/xid"
 )
 
+var (
+	// ErrInvalidPaginationCursor is the sentinel wrapped by every InvalidCursorError so callers can test with errors.Is
+	ErrInvalidPaginationCursor = errors.New("invalid pagination cursor")
+	// ErrInvalidPageParam is the sentinel wrapped by every InvalidPageParamError so callers can test with errors.Is
+	ErrInvalidPageParam     = errors.New("invalid page number pagination param")
+	errPageParamNotPositive = errors.New("must be a positive integer")
+)
+
+// InvalidCursorError is returned when a pagination query param could not be parsed into a cursor
+type InvalidCursorError struct {
+	Param string
+	Value string
+	Err   error
+}
+
+func (e *InvalidCursorError) Error() string {
+	return ErrInvalidPaginationCursor.Error() + " in query param `" + e.Param + "`"
+}
+
+// Unwrap returns the underlying parse error
+func (e *InvalidCursorError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows errors.Is(err, ErrInvalidPaginationCursor) to match
+func (e *InvalidCursorError) Is(target error) bool {
+	return target == ErrInvalidPaginationCursor
+}
+
+// InvalidPageParamError is returned when `page` or `per_page` query param is not a positive integer
+type InvalidPageParamError struct {
+	Param string
+	Value string
+	Err   error
+}
+
+func (e *InvalidPageParamError) Error() string {
+	return ErrInvalidPageParam.Error() + " `" + e.Param + "`"
+}
+
+// Unwrap returns the underlying parse error
+func (e *InvalidPageParamError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows errors.Is(err, ErrInvalidPageParam) to match
+func (e *InvalidPageParamError) Is(target error) bool {
+	return target == ErrInvalidPageParam
+}
+
+// invalidCursorResponse is the structured body written for bad pagination params
+type invalidCursorResponse struct {
+	Error     string `json:"error"`
+	Parameter string `json:"parameter"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// GetPagination is the lenient pagination parser; invalid `previous`/`next` params are ignored. Prefer GetPaginationStrict for new endpoints.
 func GetPagination(req *http.Request) *data.Pagination {
+	result, _ := parsePagination(req, false)
+	return result
+}
+
+// GetPaginationStrict parses `previous`/`next` query params and returns an *InvalidCursorError for the first param that fails to parse
+func GetPaginationStrict(req *http.Request) (*data.Pagination, error) {
+	return parsePagination(req, true)
+}
+
+func parsePagination(req *http.Request, strict bool) (*data.Pagination, error) {
 	result := &data.Pagination{}
-	originalURL := req.URL
-	previous := originalURL.Query().Get(PreviousPaginationQueryParamKey)
+	queries := req.URL.Query()
+	previous := queries.Get(PreviousPaginationQueryParamKey)
 	if len(previous) > 0 {
-		prevCursor, err := data.ParseCursor(previous)
+		prevCursor, err := parseCursor(previous, strict)
 		if err == nil {
 			result.Previous = prevCursor
+		} else if strict {
+			return &data.Pagination{}, &InvalidCursorError{Param: PreviousPaginationQueryParamKey, Value: previous, Err: err}
 		}
 	}
-	next := originalURL.Query().Get(NextPaginationQueryParamKey)
+	next := queries.Get(NextPaginationQueryParamKey)
 	if len(next) > 0 {
-		nextCursor, err := data.ParseCursor(next)
+		nextCursor, err := parseCursor(next, strict)
 		if err == nil {
 			result.Next = nextCursor
+		} else if strict {
+			return &data.Pagination{}, &InvalidCursorError{Param: NextPaginationQueryParamKey, Value: next, Err: err}
 		}
 	}
-	return result
+	return result, nil
+}
+
+// parseCursor parses the cursor; in strict mode its ID must also be an xid, as generated by data.BasePaginateable
+func parseCursor(encodedCursor string, strict bool) (*data.Cursor, error) {
+	cursor, err := data.ParseCursor(encodedCursor)
+	if err == nil && strict {
+		_, err = xid.FromString(cursor.ID)
+	}
+	return cursor, err
+}
+
+// GetOffsetPagination parses `page` and `per_page` query params; absent params fallback to first page and data.DefaultPerPage
+func GetOffsetPagination(req *http.Request) (*data.OffsetPagination, error) {
+	queries := req.URL.Query()
+	page, err := parsePositiveQueryParam(queries, PageQueryParamKey, 1)
+	if err != nil {
+		return data.NewOffsetPagination(1, data.DefaultPerPage), err
+	}
+	perPage, err := parsePositiveQueryParam(queries, PerPageQueryParamKey, data.DefaultPerPage)
+	if err != nil {
+		return data.NewOffsetPagination(1, data.DefaultPerPage), err
+	}
+	return data.NewOffsetPagination(page, perPage), nil
+}
+
+func parsePositiveQueryParam(queries url.Values, key string, defaultValue uint) (uint, error) {
+	value := queries.Get(key)
+	if len(value) <= 0 {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err == nil && parsed < 1 {
+		err = errPageParamNotPositive
+	}
+	if err != nil {
+		return defaultValue, &InvalidPageParamError{Param: key, Value: value, Err: err}
+	}
+	return uint(parsed), nil
+}
+
+// WriteInvalidPagination writes a 400 JSON response naming the offending pagination param. Other errors are written as plain bad request.
+func WriteInvalidPagination(w http.ResponseWriter, err error) {
+	var cursorErr *InvalidCursorError
+	var pageErr *InvalidPageParamError
+	var body *invalidCursorResponse
+	var cause error
+	switch {
+	case errors.As(err, &cursorErr):
+		body = &invalidCursorResponse{Error: ErrInvalidPaginationCursor.Error(), Parameter: cursorErr.Param}
+		cause = cursorErr.Err
+	case errors.As(err, &pageErr):
+		body = &invalidCursorResponse{Error: ErrInvalidPageParam.Error(), Parameter: pageErr.Param}
+		cause = pageErr.Err
+	default:
+		WriteStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if cause != nil {
+		body.Detail = cause.Error()
+	}
+	var buf bytes.Buffer
+	if jsonErr := getJSON(&buf, body); jsonErr != nil {
+		WriteErr(w, jsonErr)
+		return
+	}
+	w.Header().Set(HeaderContentType, JSONContentTypeHeaderValue)
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(buf.Bytes())
+}
+
+// PaginationLinkOptions determines how pagination links are made absolute
+type PaginationLinkOptions struct {
+	// PublicBaseURL if set is used as scheme, host and path prefix of every link
+	PublicBaseURL *url.URL
+	// TrustForwardedHeaders allows `Forwarded` and `X-Forwarded-*` headers to determine scheme and host
+	TrustForwardedHeaders bool
+}
+
+// NewPaginationLinkOptions creates link options from the proxy configuration
+func NewPaginationLinkOptions(proxyConfig config.HTTPProxyConfig) (*PaginationLinkOptions, error) {
+	options := &PaginationLinkOptions{TrustForwardedHeaders: proxyConfig.IsForwardedHeaderTrusted()}
+	if baseURL := proxyConfig.GetHTTPPublicBaseURL(); len(baseURL) > 0 {
+		publicURL, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		options.PublicBaseURL = publicURL
+	}
+	return options, nil
 }
 
+// GetPaginationLinks generates `previous` and `next` links relative to the request, retaining non pagination query params
 func GetPaginationLinks(req *http.Request, pagination *data.Pagination) map[string]string {
+	return GetPaginationLinksWithOptions(req, pagination, nil)
+}
+
+// GetPaginationLinksWithOptions is same as GetPaginationLinks but links are made absolute as per the options provided
+func GetPaginationLinksWithOptions(req *http.Request, pagination *data.Pagination, options *PaginationLinkOptions) map[string]string {
 	links := make(map[string]string)
 	if pagination != nil {
-		originalURL := req.URL
+		baseURL := getLinkBaseURL(req, options)
 		if pagination.Previous != nil {
-			previous := cloneBaseURL(originalURL)
-			prevQueries := make(url.Values)
-			prevQueries.Set(PreviousPaginationQueryParamKey, pagination.Previous.String())
-			previous.RawQuery = prevQueries.Encode()
-			links[PreviousPaginationQueryParamKey] = previous.String()
+			links[PreviousPaginationQueryParamKey] = buildPaginationLink(req, baseURL, url.Values{PreviousPaginationQueryParamKey: {pagination.Previous.String()}})
 		}
 		if pagination.Next != nil {
-			next := cloneBaseURL(originalURL)
-			nextQueries := make(url.Values)
-			nextQueries.Set(NextPaginationQueryParamKey, pagination.Next.String())
-			next.RawQuery = nextQueries.Encode()
-			links[NextPaginationQueryParamKey] = next.String()
+			links[NextPaginationQueryParamKey] = buildPaginationLink(req, baseURL, url.Values{NextPaginationQueryParamKey: {pagination.Next.String()}})
+		}
+	}
+	return links
+}
+
+// GetOffsetPaginationLinks generates `first`, `previous`, `next` and `last` links for page number pagination. `last` is only generated
+// when exact total count is known and `next` relies on rowsInPage when it is not.
+func GetOffsetPaginationLinks(req *http.Request, page *data.OffsetPagination, rowsInPage int, options *PaginationLinkOptions) map[string]string {
+	links := make(map[string]string)
+	if page != nil {
+		baseURL := getLinkBaseURL(req, options)
+		pageLink := func(pageNumber uint) string {
+			return buildPaginationLink(req, baseURL, url.Values{
+				PageQueryParamKey:    {strconv.FormatUint(uint64(pageNumber), 10)},
+				PerPageQueryParamKey: {strconv.FormatUint(uint64(page.PerPage), 10)},
+			})
+		}
+		if page.HasPrevious() {
+			links[FirstPaginationLinkKey] = pageLink(1)
+			links[PreviousPaginationQueryParamKey] = pageLink(page.Page - 1)
+		}
+		if page.HasNext(rowsInPage) {
+			links[NextPaginationQueryParamKey] = pageLink(page.Page + 1)
+		}
+		if page.IsTotalKnown() && !page.TotalIsEstimate && page.TotalPages() > 0 {
+			links[LastPaginationLinkKey] = pageLink(page.TotalPages())
 		}
 	}
 	return links
 }
 
+// WriteTotalCountHeader sets `X-Total-Count` header if total count is known for the page
+func WriteTotalCountHeader(w http.ResponseWriter, page *data.OffsetPagination) {
+	if page != nil && page.IsTotalKnown() {
+		w.Header().Set(HeaderTotalCount, strconv.FormatInt(page.TotalCount, 10))
+	}
+}
+
+// WritePaginationLinkHeader sets RFC 8288 `Link` header for the links generated by GetPaginationLinks or GetOffsetPaginationLinks
+func WritePaginationLinkHeader(w http.ResponseWriter, links map[string]string) {
+	linkValues := make([]string, 0, len(links))
+	for _, key := range linkRelationOrder {
+		if link, ok := links[key]; ok {
+			linkValues = append(linkValues, "<"+link+">; rel=\""+linkRelations[key]+"\"")
+		}
+	}
+	if len(linkValues) > 0 {
+		w.Header().Set(HeaderLink, strings.Join(linkValues, ", "))
+	}
+}
+
+var (
+	// paginationQueryParamKeys are stripped from the original query before a link is generated
+	paginationQueryParamKeys = []string{PreviousPaginationQueryParamKey, NextPaginationQueryParamKey, PageQueryParamKey, PerPageQueryParamKey}
+	linkRelationOrder        = []string{FirstPaginationLinkKey, PreviousPaginationQueryParamKey, NextPaginationQueryParamKey, LastPaginationLinkKey}
+	linkRelations            = map[string]string{
+		FirstPaginationLinkKey:          "first",
+		PreviousPaginationQueryParamKey: "prev",
+		NextPaginationQueryParamKey:     "next",
+		LastPaginationLinkKey:           "last",
+	}
+)
+
+func buildPaginationLink(req *http.Request, baseURL *url.URL, paginationQueries url.Values) string {
+	link := cloneBaseURL(baseURL)
+	queries := req.URL.Query()
+	for _, paginationKey := range paginationQueryParamKeys {
+		queries.Del(paginationKey)
+	}
+	for key, values := range paginationQueries {
+		queries[key] = values
+	}
+	link.RawQuery = queries.Encode()
+	return link.String()
+}
+
+func getLinkBaseURL(req *http.Request, options *PaginationLinkOptions) *url.URL {
+	baseURL := cloneBaseURL(req.URL)
+	if options == nil {
+		return baseURL
+	}
+	if options.PublicBaseURL != nil {
+		baseURL.Scheme = options.PublicBaseURL.Scheme
+		baseURL.Host = options.PublicBaseURL.Host
+		prefix := strings.TrimSuffix(options.PublicBaseURL.Path, "/")
+		if len(prefix) > 0 {
+			baseURL.Path = prefix + baseURL.Path
+			if len(baseURL.RawPath) > 0 {
+				baseURL.RawPath = strings.TrimSuffix(options.PublicBaseURL.EscapedPath(), "/") + baseURL.RawPath
+			}
+		}
+		return baseURL
+	}
+	if len(baseURL.Host) <= 0 {
+		baseURL.Host = req.Host
+	}
+	if len(baseURL.Scheme) <= 0 {
+		baseURL.Scheme = "http"
+		if req.TLS != nil {
+			baseURL.Scheme = "https"
+		}
+	}
+	if options.TrustForwardedHeaders {
+		proto, host := getForwardedProtoAndHost(req)
+		if len(proto) > 0 {
+			baseURL.Scheme = proto
+		}
+		if len(host) > 0 {
+			baseURL.Host = host
+		}
+	}
+	return baseURL
+}
+
+// getForwardedProtoAndHost reads the closest client's proto and host from RFC 7239 `Forwarded` header, falling back to `X-Forwarded-*` headers
+func getForwardedProtoAndHost(req *http.Request) (proto, host string) {
+	if forwarded := req.Header.Get(HeaderForwarded); len(forwarded) > 0 {
+		firstHop := strings.Split(forwarded, ",")[0]
+		for _, pair := range strings.Split(firstHop, ";") {
+			keyValue := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(keyValue) != 2 {
+				continue
+			}
+			value := strings.Trim(keyValue[1], "\"")
+			switch strings.ToLower(keyValue[0]) {
+			case "proto":
+				proto = strings.ToLower(value)
+			case "host":
+				host = value
+			}
+		}
+	}
+	if len(proto) <= 0 {
+		proto = strings.ToLower(firstHeaderValue(req, HeaderForwardedProto))
+	}
+	if len(host) <= 0 {
+		host = firstHeaderValue(req, HeaderForwardedHost)
+	}
+	return proto, host
+}
+
+func firstHeaderValue(req *http.Request, header string) string {
+	return strings.TrimSpace(strings.Split(req.Header.Get(header), ",")[0])
+}
+
 func cloneBaseURL(originalURL *url.URL) *url.URL {
 	newURL := &url.URL{}
 	newURL.Scheme = originalURL.Scheme
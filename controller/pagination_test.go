@@ -1,7 +1,12 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -85,3 +90,227 @@ func TestGetPagination(t *testing.T) {
 		assert.Nil(t, pagination.Previous)
 	})
 }
+
+func TestGetPaginationStrict(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+		paginateable := data.BasePaginateable{}
+		paginateable.QuickFix()
+		pagination := data.NewPagination(&paginateable, nil)
+		getReq, _ := http.NewRequest("GET", "/client", nil)
+		links := GetPaginationLinks(getReq, pagination)
+		pageReq, _ := http.NewRequest("GET", links[NextPaginationQueryParamKey], nil)
+		pagination, err := GetPaginationStrict(pageReq)
+		assert.Nil(t, err)
+		assert.NotNil(t, pagination.Next)
+		assert.Nil(t, pagination.Previous)
+	})
+	t.Run("InvalidNext", func(t *testing.T) {
+		t.Parallel()
+		pageReq, _ := http.NewRequest("GET", "/client?next=corrupted", nil)
+		pagination, err := GetPaginationStrict(pageReq)
+		assert.NotNil(t, pagination)
+		assert.True(t, errors.Is(err, ErrInvalidPaginationCursor))
+		var cursorErr *InvalidCursorError
+		assert.True(t, errors.As(err, &cursorErr))
+		assert.Equal(t, NextPaginationQueryParamKey, cursorErr.Param)
+		assert.Equal(t, "corrupted", cursorErr.Value)
+		lenient := GetPagination(pageReq)
+		assert.Nil(t, lenient.Next)
+	})
+	t.Run("InvalidPrevious", func(t *testing.T) {
+		t.Parallel()
+		pageReq, _ := http.NewRequest("GET", "/client?previous=Zm9v", nil)
+		_, err := GetPaginationStrict(pageReq)
+		var cursorErr *InvalidCursorError
+		assert.True(t, errors.As(err, &cursorErr))
+		assert.Equal(t, PreviousPaginationQueryParamKey, cursorErr.Param)
+	})
+	t.Run("InvalidID", func(t *testing.T) {
+		t.Parallel()
+		cursor := &data.Cursor{ID: "' OR 1=1 --", Timestamp: time.Now()}
+		pageReq, _ := http.NewRequest("GET", "/client?next="+url.QueryEscape(cursor.String()), nil)
+		_, err := GetPaginationStrict(pageReq)
+		var cursorErr *InvalidCursorError
+		assert.True(t, errors.As(err, &cursorErr))
+		assert.Equal(t, NextPaginationQueryParamKey, cursorErr.Param)
+		resp := httptest.NewRecorder()
+		WriteInvalidPagination(resp, err)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		body := make(map[string]string)
+		assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		assert.Equal(t, ErrInvalidPaginationCursor.Error(), body["error"])
+	})
+}
+
+func TestWriteInvalidPagination(t *testing.T) {
+	t.Run("CursorError", func(t *testing.T) {
+		t.Parallel()
+		pageReq, _ := http.NewRequest("GET", "/client?next=corrupted", nil)
+		_, err := GetPaginationStrict(pageReq)
+		resp := httptest.NewRecorder()
+		WriteInvalidPagination(resp, err)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Equal(t, JSONContentTypeHeaderValue, resp.Header().Get(HeaderContentType))
+		body := make(map[string]string)
+		assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		assert.Equal(t, NextPaginationQueryParamKey, body["parameter"])
+		assert.Equal(t, ErrInvalidPaginationCursor.Error(), body["error"])
+	})
+	t.Run("OtherError", func(t *testing.T) {
+		t.Parallel()
+		resp := httptest.NewRecorder()
+		WriteInvalidPagination(resp, errors.New("other"))
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Equal(t, "other", resp.Body.String())
+	})
+}
+
+type proxyConfigStub struct {
+	baseURL string
+	trusted bool
+}
+
+func (stub *proxyConfigStub) GetHTTPPublicBaseURL() string   { return stub.baseURL }
+func (stub *proxyConfigStub) IsForwardedHeaderTrusted() bool { return stub.trusted }
+
+func TestGetPaginationLinksWithOptions(t *testing.T) {
+	paginateable := data.BasePaginateable{}
+	paginateable.QuickFix()
+	pagination := data.NewPagination(&paginateable, &paginateable)
+	t.Run("RetainsFilters", func(t *testing.T) {
+		t.Parallel()
+		getReq, _ := http.NewRequest("GET", "/client?status=active&sort=name&next=old", nil)
+		links := GetPaginationLinks(getReq, pagination)
+		nextURL, err := url.Parse(links[NextPaginationQueryParamKey])
+		assert.Nil(t, err)
+		assert.Equal(t, "/client", nextURL.Path)
+		assert.Equal(t, "active", nextURL.Query().Get("status"))
+		assert.Equal(t, "name", nextURL.Query().Get("sort"))
+		assert.Equal(t, pagination.Next.String(), nextURL.Query().Get(NextPaginationQueryParamKey))
+		prevURL, _ := url.Parse(links[PreviousPaginationQueryParamKey])
+		assert.Equal(t, "", prevURL.Query().Get(NextPaginationQueryParamKey))
+		assert.Equal(t, "active", prevURL.Query().Get("status"))
+	})
+	t.Run("PublicBaseURL", func(t *testing.T) {
+		t.Parallel()
+		options, err := NewPaginationLinkOptions(&proxyConfigStub{baseURL: "https://api.example.com/v1/"})
+		assert.Nil(t, err)
+		getReq := httptest.NewRequest("GET", "/client?status=active", nil)
+		getReq.Header.Set(HeaderForwardedHost, "ignored.example.com")
+		links := GetPaginationLinksWithOptions(getReq, pagination, options)
+		nextURL, _ := url.Parse(links[NextPaginationQueryParamKey])
+		assert.Equal(t, "https", nextURL.Scheme)
+		assert.Equal(t, "api.example.com", nextURL.Host)
+		assert.Equal(t, "/v1/client", nextURL.Path)
+		assert.Equal(t, "active", nextURL.Query().Get("status"))
+	})
+	t.Run("InvalidPublicBaseURL", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewPaginationLinkOptions(&proxyConfigStub{baseURL: "http://[::1"})
+		assert.NotNil(t, err)
+	})
+	t.Run("XForwarded", func(t *testing.T) {
+		t.Parallel()
+		options, _ := NewPaginationLinkOptions(&proxyConfigStub{trusted: true})
+		getReq := httptest.NewRequest("GET", "/client", nil)
+		getReq.Header.Set(HeaderForwardedProto, "https, http")
+		getReq.Header.Set(HeaderForwardedHost, "public.example.com, internal")
+		links := GetPaginationLinksWithOptions(getReq, pagination, options)
+		assert.True(t, strings.HasPrefix(links[NextPaginationQueryParamKey], "https://public.example.com/client?"))
+	})
+	t.Run("Forwarded", func(t *testing.T) {
+		t.Parallel()
+		options := &PaginationLinkOptions{TrustForwardedHeaders: true}
+		getReq := httptest.NewRequest("GET", "/client", nil)
+		getReq.Header.Set(HeaderForwarded, `for=192.0.2.60;proto=HTTPS;host="rfc.example.com", for=10.0.0.1`)
+		getReq.Header.Set(HeaderForwardedHost, "ignored.example.com")
+		links := GetPaginationLinksWithOptions(getReq, pagination, options)
+		assert.True(t, strings.HasPrefix(links[NextPaginationQueryParamKey], "https://rfc.example.com/client?"))
+	})
+	t.Run("UntrustedForwarded", func(t *testing.T) {
+		t.Parallel()
+		options := &PaginationLinkOptions{}
+		getReq := httptest.NewRequest("GET", "/client", nil)
+		getReq.Header.Set(HeaderForwardedHost, "evil.example.com")
+		links := GetPaginationLinksWithOptions(getReq, pagination, options)
+		assert.True(t, strings.HasPrefix(links[NextPaginationQueryParamKey], "http://example.com/client?"))
+	})
+}
+
+func TestWritePaginationLinkHeader(t *testing.T) {
+	paginateable := data.BasePaginateable{}
+	paginateable.QuickFix()
+	getReq, _ := http.NewRequest("GET", "/client", nil)
+	links := GetPaginationLinks(getReq, data.NewPagination(&paginateable, &paginateable))
+	resp := httptest.NewRecorder()
+	WritePaginationLinkHeader(resp, links)
+	expected := "<" + links[PreviousPaginationQueryParamKey] + ">; rel=\"prev\", <" + links[NextPaginationQueryParamKey] + ">; rel=\"next\""
+	assert.Equal(t, expected, resp.Header().Get(HeaderLink))
+	emptyResp := httptest.NewRecorder()
+	WritePaginationLinkHeader(emptyResp, map[string]string{})
+	assert.Equal(t, "", emptyResp.Header().Get(HeaderLink))
+}
+
+func TestGetOffsetPagination(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		t.Parallel()
+		getReq, _ := http.NewRequest("GET", "/client", nil)
+		page, err := GetOffsetPagination(getReq)
+		assert.Nil(t, err)
+		assert.Equal(t, uint(1), page.Page)
+		assert.Equal(t, data.DefaultPerPage, page.PerPage)
+	})
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+		getReq, _ := http.NewRequest("GET", "/client?page=7&per_page=10", nil)
+		page, err := GetOffsetPagination(getReq)
+		assert.Nil(t, err)
+		assert.Equal(t, uint(7), page.Page)
+		assert.Equal(t, uint(10), page.PerPage)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, query := range []string{"page=0", "page=abc", "per_page=-1", "per_page=0"} {
+			getReq, _ := http.NewRequest("GET", "/client?"+query, nil)
+			_, err := GetOffsetPagination(getReq)
+			assert.True(t, errors.Is(err, ErrInvalidPageParam), query)
+			resp := httptest.NewRecorder()
+			WriteInvalidPagination(resp, err)
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			body := make(map[string]string)
+			assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			assert.Equal(t, strings.Split(query, "=")[0], body["parameter"])
+		}
+	})
+}
+
+func TestGetOffsetPaginationLinks(t *testing.T) {
+	t.Run("MiddlePageWithTotal", func(t *testing.T) {
+		t.Parallel()
+		getReq, _ := http.NewRequest("GET", "/client?page=7&per_page=10&status=active&next=stale", nil)
+		page, _ := GetOffsetPagination(getReq)
+		page.SetTotalCount(415, false)
+		links := GetOffsetPaginationLinks(getReq, page, 10, nil)
+		assert.Equal(t, "/client?page=1&per_page=10&status=active", links[FirstPaginationLinkKey])
+		assert.Equal(t, "/client?page=6&per_page=10&status=active", links[PreviousPaginationQueryParamKey])
+		assert.Equal(t, "/client?page=8&per_page=10&status=active", links[NextPaginationQueryParamKey])
+		assert.Equal(t, "/client?page=42&per_page=10&status=active", links[LastPaginationLinkKey])
+		resp := httptest.NewRecorder()
+		WritePaginationLinkHeader(resp, links)
+		WriteTotalCountHeader(resp, page)
+		assert.Equal(t, "415", resp.Header().Get(HeaderTotalCount))
+		assert.True(t, strings.HasPrefix(resp.Header().Get(HeaderLink), "<"+links[FirstPaginationLinkKey]+">; rel=\"first\", "))
+		assert.True(t, strings.HasSuffix(resp.Header().Get(HeaderLink), "<"+links[LastPaginationLinkKey]+">; rel=\"last\""))
+	})
+	t.Run("FirstPageWithoutTotal", func(t *testing.T) {
+		t.Parallel()
+		getReq, _ := http.NewRequest("GET", "/client", nil)
+		page, _ := GetOffsetPagination(getReq)
+		links := GetOffsetPaginationLinks(getReq, page, 3, nil)
+		assert.Empty(t, links)
+		resp := httptest.NewRecorder()
+		WriteTotalCountHeader(resp, page)
+		assert.Equal(t, "", resp.Header().Get(HeaderTotalCount))
+	})
+}
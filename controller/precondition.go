@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imyousuf/appcommons/data"
+	"github.com/imyousuf/appcommons/storage/dbcore"
+)
+
+const (
+	anyEntityTag     = "*"
+	weakEntityPrefix = "W/"
+)
+
+// Precondition represents the conditional headers of a write request
+type Precondition struct {
+	// UnmodifiedSince is nil when `If-Unmodified-Since` is absent or not a valid HTTP date
+	UnmodifiedSince *time.Time
+	// IfMatch holds the entity tags listed in `If-Match` including their quotes
+	IfMatch []string
+}
+
+// GetPrecondition parses `If-Match` and `If-Unmodified-Since` headers of the request; an invalid date is ignored as per RFC 7232
+func GetPrecondition(req *http.Request) *Precondition {
+	precondition := &Precondition{IfMatch: parseEntityTags(req.Header.Get(HeaderIfMatch))}
+	if unmodifiedSince := req.Header.Get(HeaderUnmodifiedSince); len(unmodifiedSince) > 0 {
+		if parsed, err := http.ParseTime(unmodifiedSince); err == nil {
+			precondition.UnmodifiedSince = &parsed
+		}
+	}
+	return precondition
+}
+
+// IsEmpty returns true when neither `If-Match` nor a valid `If-Unmodified-Since` was sent
+func (precondition *Precondition) IsEmpty() bool {
+	return len(precondition.IfMatch) <= 0 && precondition.UnmodifiedSince == nil
+}
+
+// Evaluate checks the precondition against current state of resource; `If-Match` takes precedence over `If-Unmodified-Since` and
+// uses strong comparison. Pass empty currentETag if resource does not support ETag. Returns ErrConditionalFailed on mismatch.
+func (precondition *Precondition) Evaluate(lastModified time.Time, currentETag string) error {
+	if len(precondition.IfMatch) > 0 {
+		for _, entityTag := range precondition.IfMatch {
+			if entityTag == anyEntityTag || (len(currentETag) > 0 && !strings.HasPrefix(entityTag, weakEntityPrefix) && entityTag == currentETag) {
+				return nil
+			}
+		}
+		return ErrConditionalFailed
+	}
+	if precondition.UnmodifiedSince != nil && lastModified.Truncate(time.Second).After(*precondition.UnmodifiedSince) {
+		return ErrConditionalFailed
+	}
+	return nil
+}
+
+// CheckPrecondition evaluates the request's precondition against the current model. If required is true and the request has no
+// precondition ErrPreconditionRequired is returned. On success the model can be updated via storage conditional update helpers
+// which will detect any concurrent change since the model was read.
+func CheckPrecondition(req *http.Request, current *data.BasePaginateable, currentETag string, required bool) error {
+	precondition := GetPrecondition(req)
+	if precondition.IsEmpty() {
+		if required {
+			return ErrPreconditionRequired
+		}
+		return nil
+	}
+	return precondition.Evaluate(current.UpdatedAt, currentETag)
+}
+
+// WritePreconditionError writes 428 for ErrPreconditionRequired, 412 for ErrConditionalFailed or dbcore.ErrStaleModel and delegates
+// any other error to WriteDBError
+func WritePreconditionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPreconditionRequired):
+		WritePreconditionRequired(w)
+	case errors.Is(err, ErrConditionalFailed), errors.Is(err, dbcore.ErrStaleModel):
+		WritePreconditionFailed(w)
+	default:
+		WriteDBError(w, err)
+	}
+}
+
+// WriteLastModified sets `Last-Modified` header from the model's last update time
+func WriteLastModified(w http.ResponseWriter, paginateable *data.BasePaginateable) {
+	w.Header().Set(HeaderLastModified, paginateable.GetLastUpdatedHTTPTimeString())
+}
+
+func parseEntityTags(headerValue string) []string {
+	entityTags := make([]string, 0)
+	for _, entityTag := range strings.Split(headerValue, ",") {
+		if entityTag = strings.TrimSpace(entityTag); len(entityTag) > 0 {
+			entityTags = append(entityTags, entityTag)
+		}
+	}
+	return entityTags
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/data"
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/stretchr/testify/assert"
+)
+
+func getPreconditionRequest(headers map[string]string) *http.Request {
+	req := httptest.NewRequest("PUT", "/client", nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return req
+}
+
+func TestGetPrecondition(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		t.Parallel()
+		precondition := GetPrecondition(getPreconditionRequest(nil))
+		assert.True(t, precondition.IsEmpty())
+	})
+	t.Run("InvalidDateIgnored", func(t *testing.T) {
+		t.Parallel()
+		precondition := GetPrecondition(getPreconditionRequest(map[string]string{HeaderUnmodifiedSince: "yesterday"}))
+		assert.True(t, precondition.IsEmpty())
+	})
+	t.Run("Both", func(t *testing.T) {
+		t.Parallel()
+		now := time.Now().UTC().Truncate(time.Second)
+		precondition := GetPrecondition(getPreconditionRequest(map[string]string{HeaderUnmodifiedSince: now.Format(http.TimeFormat), HeaderIfMatch: `"abc", W/"def"`}))
+		assert.False(t, precondition.IsEmpty())
+		assert.True(t, now.Equal(*precondition.UnmodifiedSince))
+		assert.Equal(t, []string{`"abc"`, `W/"def"`}, precondition.IfMatch)
+	})
+}
+
+func TestCheckPrecondition(t *testing.T) {
+	current := &data.BasePaginateable{}
+	current.QuickFix()
+	lastModified := current.GetLastUpdatedHTTPTimeString()
+	t.Run("Required", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, ErrPreconditionRequired, CheckPrecondition(getPreconditionRequest(nil), current, "", true))
+		assert.Nil(t, CheckPrecondition(getPreconditionRequest(nil), current, "", false))
+	})
+	t.Run("UnmodifiedSince", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, CheckPrecondition(getPreconditionRequest(map[string]string{HeaderUnmodifiedSince: lastModified}), current, "", true))
+		earlier := current.UpdatedAt.Add(-1 * time.Minute).UTC().Format(http.TimeFormat)
+		assert.Equal(t, ErrConditionalFailed, CheckPrecondition(getPreconditionRequest(map[string]string{HeaderUnmodifiedSince: earlier}), current, "", true))
+	})
+	t.Run("IfMatch", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, CheckPrecondition(getPreconditionRequest(map[string]string{HeaderIfMatch: `"other", "current"`}), current, `"current"`, true))
+		assert.Nil(t, CheckPrecondition(getPreconditionRequest(map[string]string{HeaderIfMatch: "*"}), current, "", true))
+		assert.Equal(t, ErrConditionalFailed, CheckPrecondition(getPreconditionRequest(map[string]string{HeaderIfMatch: `W/"current"`}), current, `"current"`, true))
+		assert.Equal(t, ErrConditionalFailed, CheckPrecondition(getPreconditionRequest(map[string]string{HeaderIfMatch: `"other"`}), current, "", true))
+	})
+	t.Run("IfMatchTakesPrecedence", func(t *testing.T) {
+		t.Parallel()
+		earlier := current.UpdatedAt.Add(-1 * time.Minute).UTC().Format(http.TimeFormat)
+		req := getPreconditionRequest(map[string]string{HeaderIfMatch: `"current"`, HeaderUnmodifiedSince: earlier})
+		assert.Nil(t, CheckPrecondition(req, current, `"current"`, true))
+	})
+}
+
+func TestWritePreconditionError(t *testing.T) {
+	testCases := map[error]int{
+		ErrPreconditionRequired: http.StatusPreconditionRequired,
+		ErrConditionalFailed:    http.StatusPreconditionFailed,
+		dbcore.ErrStaleModel:    http.StatusPreconditionFailed,
+		errors.New("other"):     http.StatusInternalServerError,
+	}
+	for err, code := range testCases {
+		resp := httptest.NewRecorder()
+		WritePreconditionError(resp, err)
+		assert.Equal(t, code, resp.Code, err.Error())
+	}
+	resp := httptest.NewRecorder()
+	current := &data.BasePaginateable{}
+	current.QuickFix()
+	WriteLastModified(resp, current)
+	assert.Equal(t, current.GetLastUpdatedHTTPTimeString(), resp.Header().Get(HeaderLastModified))
+}
@@ -9,10 +9,12 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/storage/dbcore"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
@@ -24,26 +26,47 @@ import (
 const (
 	PreviousPaginationQueryParamKey = "previous"
 	NextPaginationQueryParamKey     = "next"
+	PageQueryParamKey               = "page"
+	PerPageQueryParamKey            = "per_page"
+	FirstPaginationLinkKey          = "first"
+	LastPaginationLinkKey           = "last"
 	FormDataContentTypeHeaderValue  = "application/x-www-form-urlencoded"
 	JSONContentTypeHeaderValue      = "application/json"
 	HeaderContentType               = "Content-Type"
 	HeaderUnmodifiedSince           = "If-Unmodified-Since"
+	HeaderIfMatch                   = "If-Match"
 	HeaderLastModified              = "Last-Modified"
+	HeaderETag                      = "ETag"
+	HeaderIfNoneMatch               = "If-None-Match"
+	HeaderIfModifiedSince           = "If-Modified-Since"
 	HeaderRequestID                 = "X-Request-ID"
+	HeaderLink                      = "Link"
+	HeaderTotalCount                = "X-Total-Count"
+	HeaderForwarded                 = "Forwarded"
+	HeaderForwardedProto            = "X-Forwarded-Proto"
+	HeaderForwardedHost             = "X-Forwarded-Host"
 	requestIDLogFieldKey            = "requestId"
 )
 
 var (
-	listener ServerLifecycleListener
-	server   *http.Server
+	listener           ServerLifecycleListener
+	server             *http.Server
+	shutdownHooks      []ShutdownHook
+	shutdownHooksMutex sync.Mutex
 	// ErrUnsupportedMediaType is returned when client does not provide appropriate `Content-Type` header
 	ErrUnsupportedMediaType = errors.New("media type not supported")
 	// ErrConditionalFailed is returned when update is missing `If-Unmodified-Since` header
 	ErrConditionalFailed = errors.New("update failed due to mismatch of `If-Unmodified-Since` header value")
+	// ErrPreconditionRequired is returned when an update requires `If-Unmodified-Since` or `If-Match` header but neither is present
+	ErrPreconditionRequired = errors.New("precondition required: update is missing `If-Unmodified-Since` or `If-Match` header")
 	// ErrNotFound is returned when resource is not found
 	ErrNotFound = errors.New("request resource not found")
 	// ErrBadRequest is returned when protocol for a PUT/POST/DELETE request is not met
 	ErrBadRequest = errors.New("bad request: Update is missing `If-Unmodified-Since` header ")
+	// ErrConflict is returned when a write conflicts with existing state, e.g. duplicate key or constraint violation
+	ErrConflict = errors.New("request conflicts with current state of the resource")
+	// ErrServiceUnavailable is returned when storage is temporarily unable to serve the request
+	ErrServiceUnavailable = errors.New("service temporarily unavailable, retry later")
 	// ErrBadRequestForRequeue is returned when requeue form param does not match consumer token
 	ErrBadRequestForRequeue = errors.New("`requeue` form param must match consumer token")
 	getJSON                 = func(buf *bytes.Buffer, data interface{}) error {
@@ -52,6 +75,10 @@ var (
 )
 
 type (
+	// ShutdownHook is called on graceful shutdown after the server stops accepting requests, e.g. to drain background workers; ctx
+	// expires when the shutdown timeout elapses
+	ShutdownHook func(ctx context.Context) error
+
 	// ServerLifecycleListener listens to key server lifecycle error
 	ServerLifecycleListener interface {
 		StartingServer()
@@ -102,7 +129,7 @@ func getRequestID(r *http.Request) (requestID string, request *http.Request) {
 		if len(requestID) < 1 {
 			requestID = xid.New().String()
 		}
-		ctx = context.WithValue(ctx, idKey{}, requestID)
+		ctx = dbcore.WithRequestID(context.WithValue(ctx, idKey{}, requestID), requestID)
 		request = r.WithContext(ctx)
 	}
 	return requestID, request
@@ -139,8 +166,8 @@ func logAccess(r *http.Request, status, size int, duration time.Duration) {
 }
 
 func getHandler(apiRouter *httprouter.Router) http.Handler {
-	// Chain handlers - new handler to attach logger to request context, request id handler and lastly access log handler all ending with the our routes
-	return hlog.NewHandler(log.Logger)(getRequestIDHandler(requestIDLogFieldKey, HeaderRequestID)(hlog.AccessHandler(logAccess)(apiRouter)))
+	// Chain handlers - new handler to attach logger to request context, request id handler, access log handler and lastly conditional GET handler all ending with the our routes
+	return hlog.NewHandler(log.Logger)(getRequestIDHandler(requestIDLogFieldKey, HeaderRequestID)(hlog.AccessHandler(logAccess)(ConditionalGetHandler(apiRouter))))
 }
 
 // ConfigureAPI configures API Server with interrupt handling
@@ -175,10 +202,30 @@ func handleExit() {
 	serverShutdownContext, shutdownTimeoutCancelFunc := context.WithTimeout(context.Background(), 15*time.Second)
 	defer shutdownTimeoutCancelFunc()
 	server.Shutdown(serverShutdownContext)
+	runShutdownHooks(serverShutdownContext)
 	log.Print("Server gracefully stopped!")
 	listener.ServerShutdownCompleted()
 }
 
+// AddShutdownHook registers hooks to be run, in order of registration, on graceful shutdown before the listener is notified of completion
+func AddShutdownHook(hooks ...ShutdownHook) {
+	shutdownHooksMutex.Lock()
+	defer shutdownHooksMutex.Unlock()
+	shutdownHooks = append(shutdownHooks, hooks...)
+}
+
+func runShutdownHooks(ctx context.Context) {
+	shutdownHooksMutex.Lock()
+	hooks := make([]ShutdownHook, len(shutdownHooks))
+	copy(hooks, shutdownHooks)
+	shutdownHooksMutex.Unlock()
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			log.Error().Err(err).Msg("shutdown hook error")
+		}
+	}
+}
+
 func SetupAPIRoutes(apiRouter *httprouter.Router, endpoints ...EndpointController) {
 	for _, endpoint := range endpoints {
 		getEndpoint, ok := endpoint.(Get)
@@ -204,6 +251,22 @@ func WriteErr(w http.ResponseWriter, err error) {
 	WriteStatus(w, http.StatusInternalServerError, err)
 }
 
+// WriteDBError maps errors classified by storage.ClassifyError to 404, 409 or 503 and dbcore.ErrStaleModel to 412; others are written as 500
+func WriteDBError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, dbcore.ErrNotFound):
+		WriteNotFound(w)
+	case errors.Is(err, dbcore.ErrStaleModel):
+		WritePreconditionFailed(w)
+	case errors.Is(err, dbcore.ErrDuplicateKey), errors.Is(err, dbcore.ErrForeignKeyViolation), errors.Is(err, dbcore.ErrCheckViolation):
+		WriteStatus(w, http.StatusConflict, ErrConflict)
+	case errors.Is(err, dbcore.ErrDeadlock), errors.Is(err, dbcore.ErrLockTimeout), errors.Is(err, dbcore.ErrReadOnly):
+		WriteStatus(w, http.StatusServiceUnavailable, ErrServiceUnavailable)
+	default:
+		WriteErr(w, err)
+	}
+}
+
 func WriteNotFound(w http.ResponseWriter) {
 	WriteStatus(w, http.StatusNotFound, ErrNotFound)
 }
@@ -217,7 +280,11 @@ func WriteUnsupportedMediaType(w http.ResponseWriter) {
 }
 
 func WritePreconditionFailed(w http.ResponseWriter) {
-	WriteStatus(w, http.StatusPreconditionFailed, ErrUnsupportedMediaType)
+	WriteStatus(w, http.StatusPreconditionFailed, ErrConditionalFailed)
+}
+
+func WritePreconditionRequired(w http.ResponseWriter) {
+	WriteStatus(w, http.StatusPreconditionRequired, ErrPreconditionRequired)
 }
 
 func WriteStatus(w http.ResponseWriter, code int, err error) {
@@ -2,6 +2,8 @@ package controller
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +14,8 @@ import (
 	"time"
 
 	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/storage"
+	"github.com/imyousuf/appcommons/storage/dbcore"
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -68,6 +72,21 @@ func TestConfigureAPI(t *testing.T) {
 	defer func() { NotifyOnInterrupt = oldNotify }()
 }
 
+func TestShutdownHooks(t *testing.T) {
+	defer func() { shutdownHooks = nil }()
+	calls := make([]string, 0, 2)
+	AddShutdownHook(func(ctx context.Context) error {
+		calls = append(calls, "first")
+		return errors.New("hook error is only logged")
+	})
+	AddShutdownHook(func(ctx context.Context) error {
+		calls = append(calls, "second")
+		return nil
+	})
+	runShutdownHooks(context.Background())
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
 func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
 	c := make(chan struct{})
 	go func() {
@@ -199,3 +218,43 @@ func TestFormatURL(t *testing.T) {
 	resultURL := FormatURL(params, "/s/:test1/:test2/:test3", paramKeys...)
 	assert.Equal(t, "/s/one/two/three", resultURL)
 }
+
+func TestWriteDBError(t *testing.T) {
+	testCases := map[error]int{
+		&dbcore.DBError{Kind: dbcore.ErrNotFound, Err: sql.ErrNoRows}:               http.StatusNotFound,
+		&dbcore.DBError{Kind: dbcore.ErrDuplicateKey, Err: errors.New("dup")}:       http.StatusConflict,
+		&dbcore.DBError{Kind: dbcore.ErrForeignKeyViolation, Err: errors.New("fk")}: http.StatusConflict,
+		&dbcore.DBError{Kind: dbcore.ErrCheckViolation, Err: errors.New("check")}:   http.StatusConflict,
+		&dbcore.DBError{Kind: dbcore.ErrDeadlock, Err: errors.New("deadlock")}:      http.StatusServiceUnavailable,
+		&dbcore.DBError{Kind: dbcore.ErrLockTimeout, Err: errors.New("busy")}:       http.StatusServiceUnavailable,
+		&dbcore.DBError{Kind: dbcore.ErrReadOnly, Err: errors.New("ro")}:            http.StatusServiceUnavailable,
+		errors.New("other"): http.StatusInternalServerError,
+	}
+	for err, code := range testCases {
+		resp := httptest.NewRecorder()
+		WriteDBError(resp, err)
+		assert.Equal(t, code, resp.Code, err.Error())
+	}
+	t.Run("QuerySingleRowNotFound", func(t *testing.T) {
+		db, err := sql.Open(string(config.SQLite3Dialect), ":memory:")
+		assert.Nil(t, err)
+		defer db.Close()
+		var value int
+		err = storage.QuerySingleRow(db, "SELECT 1 WHERE 1 = 0", storage.NilArgs, storage.Args2SliceFnWrapper(&value))
+		assert.True(t, errors.Is(err, sql.ErrNoRows))
+		resp := httptest.NewRecorder()
+		WriteDBError(resp, err)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
+
+func TestRequestIDHandlerSetsStorageRequestID(t *testing.T) {
+	var storageRequestID string
+	handler := getRequestIDHandler(requestIDLogFieldKey, HeaderRequestID)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storageRequestID = dbcore.GetRequestID(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(HeaderRequestID, "request-id-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "request-id-1", storageRequestID)
+}
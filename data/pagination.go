@@ -1,9 +1,13 @@
 package data
 
 import (
+	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +20,8 @@ var (
 
 const (
 	cursorSeparator = "|"
+	weakETagPrefix  = "W/"
+	eTagHashLength  = 16
 )
 
 // Cursor represents a string used for pagination
@@ -49,16 +55,39 @@ func ParseCursor(encodedCursorString string) (cursor *Cursor, err error) {
 	return cursor, err
 }
 
-// BasePaginateable provides common functionalities around paginateable objects
+// BasePaginateable provides common functionalities around paginateable objects. The `db` tags are used by storage struct mapper.
 type BasePaginateable struct {
-	ID        xid.ID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        xid.ID    `db:"id"`
+	CreatedAt time.Time `db:"createdAt"`
+	UpdatedAt time.Time `db:"updatedAt"`
 }
 
-// GetLastUpdatedHTTPTimeString exposes the string rep of the last modified timestamp for the object
+// GetLastUpdatedHTTPTimeString exposes the string rep of the last modified timestamp for the object; http.TimeFormat requires UTC
 func (paginateable *BasePaginateable) GetLastUpdatedHTTPTimeString() string {
-	return paginateable.UpdatedAt.Format(http.TimeFormat)
+	return paginateable.UpdatedAt.UTC().Format(http.TimeFormat)
+}
+
+// GetBasePaginateable exposes the base attributes for models embedding BasePaginateable
+func (paginateable *BasePaginateable) GetBasePaginateable() *BasePaginateable {
+	return paginateable
+}
+
+// GetETag returns a strong entity tag derived from ID and UpdatedAt
+func (paginateable *BasePaginateable) GetETag() string {
+	return "\"" + paginateable.getVersionHash() + "\""
+}
+
+// GetWeakETag returns the weak form of GetETag
+func (paginateable *BasePaginateable) GetWeakETag() string {
+	return weakETagPrefix + paginateable.GetETag()
+}
+
+func (paginateable *BasePaginateable) getVersionHash() string {
+	hasher := sha256.New()
+	hasher.Write([]byte(paginateable.ID.String()))
+	hasher.Write([]byte(cursorSeparator))
+	hasher.Write([]byte(strconv.FormatInt(paginateable.UpdatedAt.UnixNano(), 10)))
+	return hex.EncodeToString(hasher.Sum(nil)[:eTagHashLength])
 }
 
 // GetCursor returns the cursor value for this producer
@@ -102,6 +131,48 @@ type ValidateableModel interface {
 	IsInValidState() bool
 }
 
+// BaseModel is implemented by models that embed BasePaginateable
+type BaseModel interface {
+	GetBasePaginateable() *BasePaginateable
+}
+
+// SoftDeletable is an optional mixin for models whose rows are marked deleted instead of being removed
+type SoftDeletable struct {
+	DeletedAt sql.NullTime `db:"deletedAt"`
+}
+
+// GetSoftDeletable exposes the soft delete attributes for models embedding SoftDeletable
+func (softDeletable *SoftDeletable) GetSoftDeletable() *SoftDeletable {
+	return softDeletable
+}
+
+// IsDeleted returns whether the model has been soft deleted
+func (softDeletable *SoftDeletable) IsDeleted() bool {
+	return softDeletable.DeletedAt.Valid
+}
+
+// MarkDeleted sets the deletion timestamp
+func (softDeletable *SoftDeletable) MarkDeleted(deletedAt time.Time) {
+	softDeletable.DeletedAt = sql.NullTime{Time: deletedAt, Valid: true}
+}
+
+// Restore clears the deletion timestamp
+func (softDeletable *SoftDeletable) Restore() {
+	softDeletable.DeletedAt = sql.NullTime{}
+}
+
+// SoftDeletableModel is implemented by models that embed SoftDeletable
+type SoftDeletableModel interface {
+	GetSoftDeletable() *SoftDeletable
+}
+
+// PaginateableModel is implemented by validateable models that embed BasePaginateable
+type PaginateableModel interface {
+	ValidateableModel
+	Paginateable
+	BaseModel
+}
+
 // NewPagination returns a new pagination wrapper
 func NewPagination(after Paginateable, before Paginateable) *Pagination {
 	var next, previous *Cursor
@@ -120,3 +191,124 @@ func NewPagination(after Paginateable, before Paginateable) *Pagination {
 	}
 	return &Pagination{Next: next, Previous: previous}
 }
+
+// CountMode determines how total row count is computed for offset pagination
+type CountMode uint8
+
+const (
+	// NoCount skips computing total count
+	NoCount CountMode = iota
+	// ExactCount computes total with a COUNT(*) query
+	ExactCount
+	// EstimatedCount reads the approximate row count from table statistics
+	EstimatedCount
+)
+
+const (
+	// DefaultPerPage is the page size used when one is not specified for offset pagination
+	DefaultPerPage uint = 25
+	// MaxPerPage is the largest page size allowed for offset pagination
+	MaxPerPage uint = 500
+)
+
+// OffsetPagination represents page number based traversal of a list
+type OffsetPagination struct {
+	Page            uint
+	PerPage         uint
+	CountMode       CountMode
+	TotalCount      int64
+	TotalIsEstimate bool
+	totalKnown      bool
+}
+
+// NewOffsetPagination returns a page number pagination with page starting at 1 and per page capped to MaxPerPage
+func NewOffsetPagination(page, perPage uint) *OffsetPagination {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = DefaultPerPage
+	}
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+	return &OffsetPagination{Page: page, PerPage: perPage}
+}
+
+// Offset returns the number of rows to skip to reach the current page
+func (page *OffsetPagination) Offset() uint64 {
+	if page.Page < 1 {
+		return 0
+	}
+	return uint64(page.Page-1) * uint64(page.PerPage)
+}
+
+// SetTotalCount records the total count of rows, exact or estimated
+func (page *OffsetPagination) SetTotalCount(total int64, estimate bool) {
+	if total < 0 {
+		total = 0
+	}
+	page.TotalCount = total
+	page.TotalIsEstimate = estimate
+	page.totalKnown = true
+}
+
+// IsTotalKnown returns whether total count has been set
+func (page *OffsetPagination) IsTotalKnown() bool {
+	return page.totalKnown
+}
+
+// TotalPages returns the number of pages if total is known, else 0
+func (page *OffsetPagination) TotalPages() uint {
+	if !page.totalKnown || page.PerPage < 1 || page.TotalCount <= 0 {
+		return 0
+	}
+	return uint((uint64(page.TotalCount) + uint64(page.PerPage) - 1) / uint64(page.PerPage))
+}
+
+// HasPrevious returns whether there is a page before the current one
+func (page *OffsetPagination) HasPrevious() bool {
+	return page.Page > 1
+}
+
+// HasNext returns whether there is a page after current one; if total is unknown it relies on the number of rows read in current page
+func (page *OffsetPagination) HasNext(rowsInPage int) bool {
+	if page.totalKnown && !page.TotalIsEstimate {
+		return page.Page < page.TotalPages()
+	}
+	return rowsInPage >= int(page.PerPage)
+}
+
+// GetListETag returns an entity tag for a page of a list, derived from versions of the items in order and the adjacent page cursors
+func GetListETag(weak bool, pagination *Pagination, items ...BaseModel) string {
+	hasher := sha256.New()
+	for _, item := range items {
+		hasher.Write([]byte(item.GetBasePaginateable().getVersionHash()))
+		hasher.Write([]byte(cursorSeparator))
+	}
+	if pagination != nil {
+		if pagination.Previous != nil {
+			hasher.Write([]byte(pagination.Previous.String()))
+		}
+		hasher.Write([]byte(cursorSeparator))
+		if pagination.Next != nil {
+			hasher.Write([]byte(pagination.Next.String()))
+		}
+	}
+	eTag := "\"" + hex.EncodeToString(hasher.Sum(nil)[:eTagHashLength]) + "\""
+	if weak {
+		return weakETagPrefix + eTag
+	}
+	return eTag
+}
+
+// GetListLastModified returns the latest UpdatedAt among the items; zero time if there are none
+func GetListLastModified(items ...BaseModel) time.Time {
+	var lastModified time.Time
+	for _, item := range items {
+		if updatedAt := item.GetBasePaginateable().UpdatedAt; updatedAt.After(lastModified) {
+			lastModified = updatedAt
+		}
+	}
+	return lastModified
+}
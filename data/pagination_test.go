@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,7 +91,9 @@ func TestNewPagination(t *testing.T) {
 func TestGetLastUpdatedHTTPTimeString(t *testing.T) {
 	currentTime := time.Now()
 	base := BasePaginateable{UpdatedAt: currentTime}
-	assert.Equal(t, currentTime.Format(http.TimeFormat), base.GetLastUpdatedHTTPTimeString())
+	assert.Equal(t, currentTime.UTC().Format(http.TimeFormat), base.GetLastUpdatedHTTPTimeString())
+	nonUTC := BasePaginateable{UpdatedAt: currentTime.In(time.FixedZone("UTC+5", 5*60*60))}
+	assert.Equal(t, base.GetLastUpdatedHTTPTimeString(), nonUTC.GetLastUpdatedHTTPTimeString())
 }
 
 func TestCursorString(t *testing.T) {
@@ -161,3 +164,79 @@ func TestDefaultQuickFix(t *testing.T) {
 	paginateable.ID = xid.New()
 	assert.Equal(t, false, paginateable.QuickFix())
 }
+
+func TestNewOffsetPagination(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		t.Parallel()
+		page := NewOffsetPagination(0, 0)
+		assert.Equal(t, uint(1), page.Page)
+		assert.Equal(t, DefaultPerPage, page.PerPage)
+		assert.Equal(t, uint64(0), page.Offset())
+		assert.False(t, page.HasPrevious())
+		assert.False(t, page.IsTotalKnown())
+		assert.Equal(t, uint(0), page.TotalPages())
+	})
+	t.Run("CappedPerPage", func(t *testing.T) {
+		t.Parallel()
+		page := NewOffsetPagination(7, 1000)
+		assert.Equal(t, MaxPerPage, page.PerPage)
+		assert.Equal(t, uint64(3000), page.Offset())
+		assert.True(t, page.HasPrevious())
+	})
+	t.Run("ExactTotal", func(t *testing.T) {
+		t.Parallel()
+		page := NewOffsetPagination(7, 10)
+		page.SetTotalCount(415, false)
+		assert.True(t, page.IsTotalKnown())
+		assert.Equal(t, uint(42), page.TotalPages())
+		assert.True(t, page.HasNext(0))
+		page.Page = 42
+		assert.False(t, page.HasNext(10))
+	})
+	t.Run("EstimatedTotal", func(t *testing.T) {
+		t.Parallel()
+		page := NewOffsetPagination(2, 10)
+		page.SetTotalCount(-5, true)
+		assert.Equal(t, int64(0), page.TotalCount)
+		assert.True(t, page.HasNext(10))
+		assert.False(t, page.HasNext(3))
+	})
+}
+
+func TestGetETag(t *testing.T) {
+	paginateable := &BasePaginateable{}
+	paginateable.QuickFix()
+	eTag := paginateable.GetETag()
+	assert.True(t, strings.HasPrefix(eTag, "\"") && strings.HasSuffix(eTag, "\""))
+	assert.Equal(t, "W/"+eTag, paginateable.GetWeakETag())
+	assert.Equal(t, eTag, paginateable.GetETag())
+	paginateable.UpdatedAt = paginateable.UpdatedAt.Add(time.Microsecond)
+	assert.NotEqual(t, eTag, paginateable.GetETag())
+}
+
+func TestGetListETag(t *testing.T) {
+	first := &BasePaginateable{}
+	first.QuickFix()
+	second := &BasePaginateable{}
+	second.QuickFix()
+	second.UpdatedAt = first.UpdatedAt.Add(time.Second)
+	eTag := GetListETag(false, nil, first, second)
+	assert.Equal(t, eTag, GetListETag(false, nil, first, second))
+	assert.NotEqual(t, eTag, GetListETag(false, nil, second, first))
+	assert.NotEqual(t, eTag, GetListETag(false, NewPagination(second, nil), first, second))
+	assert.Equal(t, "W/"+eTag, GetListETag(true, nil, first, second))
+	assert.True(t, second.UpdatedAt.Equal(GetListLastModified(first, second)))
+	assert.True(t, GetListLastModified().IsZero())
+}
+
+func TestSoftDeletable(t *testing.T) {
+	softDeletable := &SoftDeletable{}
+	var model SoftDeletableModel = softDeletable
+	assert.False(t, model.GetSoftDeletable().IsDeleted())
+	now := time.Now()
+	softDeletable.MarkDeleted(now)
+	assert.True(t, softDeletable.IsDeleted())
+	assert.True(t, now.Equal(softDeletable.DeletedAt.Time))
+	softDeletable.Restore()
+	assert.False(t, softDeletable.IsDeleted())
+}
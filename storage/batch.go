@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/mattn/go-sqlite3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	sqlite3LegacyMaxPlaceholders      = 999
+	sqlite3MaxPlaceholders            = 32766
+	sqlite3LargePlaceholderVersion    = 3032000
+	mysqlMaxPlaceholders              = 65535
+	estimatedFixedWidthArgBytes       = 16
+	estimatedPlaceholderStatementSize = 3
+)
+
+var (
+	// ErrBatchRowLength is returned when a row in the batch does not have exactly one value per column
+	ErrBatchRowLength = errors.New("batch row value count does not match column count")
+	// ErrNoConflictColumns is returned when upsert is requested without conflict columns
+	ErrNoConflictColumns = errors.New("upsert requires conflict columns")
+	// ErrInvalidBatchRows is returned by ReadBatches when the content is not a mapping of table names to lists of rows
+	ErrInvalidBatchRows = errors.New("batch rows must map table names to lists of rows")
+	// MySQLMaxStatementBytes is the estimated size a MySQL batch statement is kept under; it should stay below server's max_allowed_packet
+	MySQLMaxStatementBytes = 4*1024*1024 - 64*1024
+)
+
+// Batch represents rows to be written to a table using multi-row `INSERT ... VALUES` statements
+type Batch struct {
+	Table   string
+	Columns []string
+	Rows    [][]interface{}
+	// MaxRowsPerStatement optionally caps rows per statement on top of the dialect's limits
+	MaxRowsPerStatement int
+	// ConflictColumns are the primary key or unique columns an upsert conflicts on; required for SQLite3
+	ConflictColumns []string
+	// UpdateColumns are updated on conflict during upsert; defaults to all columns other than ConflictColumns
+	UpdateColumns []string
+}
+
+// ReadBatches reads YAML or JSON content mapping table names to lists of rows, each a mapping of column names to values, grouping
+// consecutive rows of a table with the same columns in a batch. With conflict keys a table can instead map to `key`, the list of
+// conflict columns, and `rows`; the conflict columns of a batch otherwise default to its first column.
+func ReadBatches(content []byte, withConflictKeys bool) ([]*Batch, error) {
+	// YAML is a superset of JSON, and its node tree keeps the order of tables and columns
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	batches := make([]*Batch, 0)
+	if len(document.Content) == 0 {
+		return batches, nil
+	}
+	tables := document.Content[0]
+	if tables.Kind != yaml.MappingNode {
+		return nil, ErrInvalidBatchRows
+	}
+	for index := 0; index+1 < len(tables.Content); index += 2 {
+		table, rows := tables.Content[index].Value, tables.Content[index+1]
+		var key []string
+		if withConflictKeys && rows.Kind == yaml.MappingNode {
+			var keyedRows struct {
+				Key  []string  `yaml:"key"`
+				Rows yaml.Node `yaml:"rows"`
+			}
+			if err := rows.Decode(&keyedRows); err != nil {
+				return nil, err
+			}
+			key, rows = keyedRows.Key, &keyedRows.Rows
+		}
+		if rows.Kind != yaml.SequenceNode {
+			return nil, ErrInvalidBatchRows
+		}
+		var batch *Batch
+		for _, row := range rows.Content {
+			if row.Kind != yaml.MappingNode || len(row.Content) == 0 {
+				return nil, ErrInvalidBatchRows
+			}
+			columns := make([]string, 0, len(row.Content)/2)
+			values := make([]interface{}, 0, len(row.Content)/2)
+			for column := 0; column+1 < len(row.Content); column += 2 {
+				var value interface{}
+				if err := row.Content[column+1].Decode(&value); err != nil {
+					return nil, err
+				}
+				columns = append(columns, row.Content[column].Value)
+				values = append(values, value)
+			}
+			if batch == nil || !reflect.DeepEqual(batch.Columns, columns) {
+				batch = &Batch{Table: table, Columns: columns}
+				if withConflictKeys {
+					batch.ConflictColumns = key
+					if len(batch.ConflictColumns) == 0 {
+						batch.ConflictColumns = columns[:1]
+					}
+				}
+				batches = append(batches, batch)
+			}
+			batch.Rows = append(batch.Rows, values)
+		}
+	}
+	return batches, nil
+}
+
+var (
+	// ExecuteBatchInsert inserts the batch in a single transaction, chunked to stay under dialect limits, and returns rows affected per chunk
+	ExecuteBatchInsert = func(db *sql.DB, dialect config.DBDialect, batch *Batch) (rowCounts []int64, err error) {
+		err = ExecuteOpsInTransaction(db, func(tx *sql.Tx) (txErr error) {
+			rowCounts, txErr = BatchInsertInTransaction(tx, dialect, batch)
+			return txErr
+		})
+		return rowCounts, err
+	}
+
+	// BatchInsertInTransaction is same as ExecuteBatchInsert but within the transaction provided
+	BatchInsertInTransaction = func(tx *sql.Tx, dialect config.DBDialect, batch *Batch) ([]int64, error) {
+		return executeBatch(tx, dialect, batch, "")
+	}
+
+	// ExecuteBatchUpsert inserts or updates the batch in a single transaction using `ON DUPLICATE KEY UPDATE` for MySQL and
+	// `ON CONFLICT DO UPDATE` for SQLite3. Note MySQL counts 2 rows affected for every updated row.
+	ExecuteBatchUpsert = func(db *sql.DB, dialect config.DBDialect, batch *Batch) (rowCounts []int64, err error) {
+		err = ExecuteOpsInTransaction(db, func(tx *sql.Tx) (txErr error) {
+			rowCounts, txErr = BatchUpsertInTransaction(tx, dialect, batch)
+			return txErr
+		})
+		return rowCounts, err
+	}
+
+	// BatchUpsertInTransaction is same as ExecuteBatchUpsert but within the transaction provided
+	BatchUpsertInTransaction = func(tx *sql.Tx, dialect config.DBDialect, batch *Batch) ([]int64, error) {
+		upsertClause, err := getUpsertClause(dialect, batch)
+		if err != nil {
+			return nil, err
+		}
+		return executeBatch(tx, dialect, batch, upsertClause)
+	}
+
+	getMaxPlaceholders = func(dialect config.DBDialect) int {
+		switch dialect {
+		case config.MySQLDialect:
+			return mysqlMaxPlaceholders
+		default:
+			if _, versionNumber, _ := sqlite3.Version(); versionNumber >= sqlite3LargePlaceholderVersion {
+				return sqlite3MaxPlaceholders
+			}
+			return sqlite3LegacyMaxPlaceholders
+		}
+	}
+)
+
+func validateBatch(batch *Batch) error {
+	if !isValidIdentifier(batch.Table) || len(batch.Columns) <= 0 {
+		return ErrInvalidIdentifier
+	}
+	for _, columns := range [][]string{batch.Columns, batch.ConflictColumns, batch.UpdateColumns} {
+		for _, column := range columns {
+			if !isValidIdentifier(column) {
+				return ErrInvalidIdentifier
+			}
+		}
+	}
+	for _, row := range batch.Rows {
+		if len(row) != len(batch.Columns) {
+			return ErrBatchRowLength
+		}
+	}
+	return nil
+}
+
+func getUpsertClause(dialect config.DBDialect, batch *Batch) (string, error) {
+	if len(batch.ConflictColumns) <= 0 {
+		return "", ErrNoConflictColumns
+	}
+	updateColumns := batch.UpdateColumns
+	if len(updateColumns) <= 0 {
+		isConflictColumn := make(map[string]bool)
+		for _, column := range batch.ConflictColumns {
+			isConflictColumn[column] = true
+		}
+		for _, column := range batch.Columns {
+			if !isConflictColumn[column] {
+				updateColumns = append(updateColumns, column)
+			}
+		}
+	}
+	setClauses := make([]string, len(updateColumns))
+	for index, column := range updateColumns {
+		quoted := quoteIdentifier(column)
+		switch dialect {
+		case config.MySQLDialect:
+			setClauses[index] = quoted + " = VALUES(" + quoted + ")"
+		default:
+			setClauses[index] = quoted + " = excluded." + quoted
+		}
+	}
+	switch dialect {
+	case config.MySQLDialect:
+		if len(setClauses) <= 0 {
+			// no-op update keeps the statement valid while ignoring duplicates
+			first := quoteIdentifier(batch.ConflictColumns[0])
+			return " ON DUPLICATE KEY UPDATE " + first + " = " + first, nil
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(setClauses, ", "), nil
+	default:
+		if len(setClauses) <= 0 {
+			return " ON CONFLICT (" + joinQuotedIdentifiers(batch.ConflictColumns) + ") DO NOTHING", nil
+		}
+		return " ON CONFLICT (" + joinQuotedIdentifiers(batch.ConflictColumns) + ") DO UPDATE SET " + strings.Join(setClauses, ", "), nil
+	}
+}
+
+// getBatchChunks splits rows so each statement stays under placeholder, row and, for MySQL, estimated statement size limits
+func getBatchChunks(dialect config.DBDialect, batch *Batch) [][][]interface{} {
+	maxRows := getMaxPlaceholders(dialect) / len(batch.Columns)
+	if batch.MaxRowsPerStatement > 0 && batch.MaxRowsPerStatement < maxRows {
+		maxRows = batch.MaxRowsPerStatement
+	}
+	if maxRows < 1 {
+		maxRows = 1
+	}
+	chunks := make([][][]interface{}, 0, len(batch.Rows)/maxRows+1)
+	start, chunkBytes := 0, 0
+	for index, row := range batch.Rows {
+		rowBytes := estimateRowBytes(row)
+		exceedsBytes := dialect == config.MySQLDialect && index > start && chunkBytes+rowBytes > MySQLMaxStatementBytes
+		if index-start >= maxRows || exceedsBytes {
+			chunks = append(chunks, batch.Rows[start:index])
+			start, chunkBytes = index, 0
+		}
+		chunkBytes += rowBytes
+	}
+	if start < len(batch.Rows) {
+		chunks = append(chunks, batch.Rows[start:])
+	}
+	return chunks
+}
+
+func estimateRowBytes(row []interface{}) int {
+	size := 0
+	for _, value := range row {
+		switch typedValue := value.(type) {
+		case string:
+			size += len(typedValue)
+		case []byte:
+			size += len(typedValue)
+		default:
+			size += estimatedFixedWidthArgBytes
+		}
+		size += estimatedPlaceholderStatementSize
+	}
+	return size
+}
+
+func executeBatch(tx *sql.Tx, dialect config.DBDialect, batch *Batch, suffix string) ([]int64, error) {
+	if err := validateBatch(batch); err != nil {
+		return nil, err
+	}
+	prefix := "INSERT INTO " + quoteIdentifier(batch.Table) + " (" + joinQuotedIdentifiers(batch.Columns) + ") VALUES "
+	rowPlaceholders := "(" + getPlaceholders(len(batch.Columns)) + ")"
+	chunks := getBatchChunks(dialect, batch)
+	rowCounts := make([]int64, 0, len(chunks))
+	for _, chunk := range chunks {
+		args := make([]interface{}, 0, len(chunk)*len(batch.Columns))
+		for _, row := range chunk {
+			args = append(args, row...)
+		}
+		query := prefix + strings.Repeat(rowPlaceholders+", ", len(chunk)-1) + rowPlaceholders + suffix
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return rowCounts, ClassifyError(err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return rowCounts, err
+		}
+		rowCounts = append(rowCounts, rowsAffected)
+	}
+	return rowCounts, nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/stretchr/testify/assert"
+)
+
+var batchTestColumns = []string{"id", "code", "name", "createdAt", "updatedAt"}
+
+func getBatchTestRows(prefix string, count int) [][]interface{} {
+	rows := make([][]interface{}, 0, count)
+	for index := 0; index < count; index++ {
+		p := &data.BasePaginateable{}
+		p.QuickFix()
+		rows = append(rows, []interface{}{p.ID, prefix + strconv.Itoa(index), "name", p.CreatedAt, p.UpdatedAt})
+	}
+	return rows
+}
+
+func TestGetBatchChunks(t *testing.T) {
+	t.Run("Placeholders", func(t *testing.T) {
+		t.Parallel()
+		batch := &Batch{Table: "batch_test", Columns: batchTestColumns, Rows: getBatchTestRows("p", 20000)}
+		chunks := getBatchChunks(config.MySQLDialect, batch)
+		assert.Equal(t, 2, len(chunks))
+		assert.Equal(t, mysqlMaxPlaceholders/len(batchTestColumns), len(chunks[0]))
+		assert.Equal(t, 20000, len(chunks[0])+len(chunks[1]))
+	})
+	t.Run("MaxRows", func(t *testing.T) {
+		t.Parallel()
+		batch := &Batch{Table: "batch_test", Columns: batchTestColumns, Rows: getBatchTestRows("r", 25), MaxRowsPerStatement: 10}
+		chunks := getBatchChunks(config.SQLite3Dialect, batch)
+		assert.Equal(t, 3, len(chunks))
+		assert.Equal(t, 5, len(chunks[2]))
+	})
+	t.Run("MySQLStatementBytes", func(t *testing.T) {
+		t.Parallel()
+		largeValue := strings.Repeat("x", MySQLMaxStatementBytes/2)
+		batch := &Batch{Table: "batch_test", Columns: []string{"name"}, Rows: [][]interface{}{{largeValue}, {largeValue}, {"small"}}}
+		assert.Equal(t, 2, len(getBatchChunks(config.MySQLDialect, batch)))
+		assert.Equal(t, 1, len(getBatchChunks(config.SQLite3Dialect, batch)))
+	})
+}
+
+func TestExecuteBatchInsert(t *testing.T) {
+	t.Run("Chunked", func(t *testing.T) {
+		batch := &Batch{Table: "batch_test", Columns: batchTestColumns, Rows: getBatchTestRows("insert", 2500), MaxRowsPerStatement: 1000}
+		rowCounts, err := ExecuteBatchInsert(testDB, config.SQLite3Dialect, batch)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{1000, 1000, 500}, rowCounts)
+		count, err := CountRows(testDB, "SELECT COUNT(*) FROM batch_test WHERE code LIKE 'insert%'", NilArgs)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2500), count)
+	})
+	t.Run("DuplicateRollsBack", func(t *testing.T) {
+		rows := getBatchTestRows("duplicate", 10)
+		rows[9][1] = rows[0][1]
+		_, err := ExecuteBatchInsert(testDB, config.SQLite3Dialect, &Batch{Table: "batch_test", Columns: batchTestColumns, Rows: rows, MaxRowsPerStatement: 5})
+		assert.True(t, errors.Is(err, ErrDuplicateKey))
+		count, _ := CountRows(testDB, "SELECT COUNT(*) FROM batch_test WHERE code LIKE 'duplicate%'", NilArgs)
+		assert.Equal(t, int64(0), count)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ExecuteBatchInsert(testDB, config.SQLite3Dialect, &Batch{Table: "batch_test", Columns: batchTestColumns, Rows: [][]interface{}{{"id"}}})
+		assert.Equal(t, ErrBatchRowLength, err)
+		_, err = ExecuteBatchInsert(testDB, config.SQLite3Dialect, &Batch{Table: "batch test", Columns: batchTestColumns})
+		assert.Equal(t, ErrInvalidIdentifier, err)
+		_, err = ExecuteBatchUpsert(testDB, config.SQLite3Dialect, &Batch{Table: "batch_test", Columns: batchTestColumns})
+		assert.Equal(t, ErrNoConflictColumns, err)
+	})
+}
+
+func TestExecuteBatchUpsert(t *testing.T) {
+	t.Run("SQLite3", func(t *testing.T) {
+		rows := getBatchTestRows("upsert", 10)
+		_, err := ExecuteBatchInsert(testDB, config.SQLite3Dialect, &Batch{Table: "batch_test", Columns: batchTestColumns, Rows: rows[:5]})
+		assert.Nil(t, err)
+		for _, row := range rows {
+			row[2] = "upserted"
+		}
+		rowCounts, err := ExecuteBatchUpsert(testDB, config.SQLite3Dialect, &Batch{Table: "batch_test", Columns: batchTestColumns, Rows: rows,
+			ConflictColumns: []string{"id"}, UpdateColumns: []string{"name", "updatedAt"}})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{10}, rowCounts)
+		count, _ := CountRows(testDB, "SELECT COUNT(*) FROM batch_test WHERE code LIKE 'upsert%' AND name = 'upserted'", NilArgs)
+		assert.Equal(t, int64(10), count)
+	})
+	t.Run("MySQLQuery", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `batch_test` (`id`, `name`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)").
+			WithArgs("1", "a", "2", "b").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+		rowCounts, err := ExecuteBatchUpsert(db, config.MySQLDialect, &Batch{Table: "batch_test", Columns: []string{"id", "name"}, Rows: [][]interface{}{{"1", "a"}, {"2", "b"}}, ConflictColumns: []string{"id"}})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{3}, rowCounts)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("UpsertClauseOnlyConflictColumns", func(t *testing.T) {
+		t.Parallel()
+		batch := &Batch{Table: "batch_test", Columns: []string{"id"}, ConflictColumns: []string{"id"}}
+		clause, _ := getUpsertClause(config.MySQLDialect, batch)
+		assert.Equal(t, " ON DUPLICATE KEY UPDATE `id` = `id`", clause)
+		clause, _ = getUpsertClause(config.SQLite3Dialect, batch)
+		assert.Equal(t, " ON CONFLICT (`id`) DO NOTHING", clause)
+	})
+}
+
+func TestReadBatches(t *testing.T) {
+	content := []byte("users:\n  - id: 1\n    name: Alice\n  - id: 2\n    name: Bob\n  - id: 3\nsettings:\n  key: [name]\n  rows:\n    - name: theme\n      value: dark\n")
+	batches, err := ReadBatches(content, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []*Batch{
+		{Table: "users", Columns: []string{"id", "name"}, Rows: [][]interface{}{{1, "Alice"}, {2, "Bob"}}, ConflictColumns: []string{"id"}},
+		{Table: "users", Columns: []string{"id"}, Rows: [][]interface{}{{3}}, ConflictColumns: []string{"id"}},
+		{Table: "settings", Columns: []string{"name", "value"}, Rows: [][]interface{}{{"theme", "dark"}}, ConflictColumns: []string{"name"}},
+	}, batches)
+	_, err = ReadBatches(content, false)
+	assert.Equal(t, ErrInvalidBatchRows, err)
+	batches, err = ReadBatches([]byte(`{"users": [{"id": 1}]}`), false)
+	assert.Nil(t, err)
+	assert.Equal(t, []*Batch{{Table: "users", Columns: []string{"id"}, Rows: [][]interface{}{{1}}}}, batches)
+	_, err = ReadBatches([]byte("users:\n  - {}\n"), false)
+	assert.Equal(t, ErrInvalidBatchRows, err)
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/imyousuf/appcommons/data"
+)
+
+const (
+	conditionalUpdateSuffix = "`" + updatedAtColumn + "` = ? WHERE `" + idColumn + "` = ? AND `" + updatedAtColumn + "` = ?"
+)
+
+var (
+	// DefaultTimestampPrecision is the precision updatedAt is truncated to by GetConditionalUpdateTxOp
+	DefaultTimestampPrecision = time.Microsecond
+
+	// GetConditionalUpdateTxOp wraps an `UPDATE table SET col1 = ?, col2 = ?` query into an optimistic update by appending
+	// `updatedAt = ? WHERE id = ? AND updatedAt = ?`. The row is only updated if its updatedAt still matches paginateable.UpdatedAt,
+	// in which case paginateable.UpdatedAt is bumped; else ErrStaleModel is returned.
+	GetConditionalUpdateTxOp = func(paginateable *data.BasePaginateable, setQuery string, arguments func() []interface{}) func(tx *sql.Tx) error {
+		return func(tx *sql.Tx) error {
+			return conditionalUpdate(tx, paginateable, setQuery, func() ([]interface{}, error) {
+				return arguments(), nil
+			}, DefaultTimestampPrecision)
+		}
+	}
+
+	// ExecuteConditionalUpdate executes the conditional update from GetConditionalUpdateTxOp in its own transaction
+	ExecuteConditionalUpdate = func(db *sql.DB, paginateable *data.BasePaginateable, setQuery string, arguments func() []interface{}) error {
+		return ExecuteMultipleWriteOpsInTransaction(db, GetConditionalUpdateTxOp(paginateable, setQuery, arguments))
+	}
+)
+
+func getConditionalUpdateQuery(setQuery string) string {
+	setQuery = strings.TrimSpace(setQuery)
+	if strings.HasSuffix(strings.ToUpper(setQuery), " SET") {
+		return setQuery + " " + conditionalUpdateSuffix
+	}
+	return setQuery + ", " + conditionalUpdateSuffix
+}
+
+// conditionalUpdate performs the update and restores UpdatedAt if it fails
+func conditionalUpdate(tx *sql.Tx, paginateable *data.BasePaginateable, setQuery string, arguments func() ([]interface{}, error), precision time.Duration) error {
+	lastUpdatedAt := paginateable.UpdatedAt
+	newUpdatedAt := time.Now().UTC().Truncate(precision)
+	if !newUpdatedAt.After(lastUpdatedAt) {
+		newUpdatedAt = lastUpdatedAt.Add(precision).UTC().Truncate(precision)
+	}
+	paginateable.UpdatedAt = newUpdatedAt
+	args, err := arguments()
+	if err == nil {
+		args = append(args, newUpdatedAt, paginateable.ID, lastUpdatedAt)
+		err = ExecuteQueryInTransaction(tx, EmptyOps, getConditionalUpdateQuery(setQuery), Args2SliceFnWrapper(args...), int64(1))
+	}
+	if err != nil {
+		paginateable.UpdatedAt = lastUpdatedAt
+	}
+	if err == ErrNoRowsUpdated {
+		err = ErrStaleModel
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/imyousuf/appcommons/data"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	conditionalInsertQuery = "INSERT INTO conditional_update_test (id, name, createdAt, updatedAt) VALUES (?, ?, ?, ?)"
+	conditionalSetQuery    = "UPDATE conditional_update_test SET name = ?"
+)
+
+func TestGetConditionalUpdateQuery(t *testing.T) {
+	assert.Equal(t, "UPDATE t SET a = ?, `updatedAt` = ? WHERE `id` = ? AND `updatedAt` = ?", getConditionalUpdateQuery("UPDATE t SET a = ? "))
+	assert.Equal(t, "UPDATE t set `updatedAt` = ? WHERE `id` = ? AND `updatedAt` = ?", getConditionalUpdateQuery("UPDATE t set"))
+}
+
+func TestExecuteConditionalUpdate(t *testing.T) {
+	paginateable := &data.BasePaginateable{}
+	paginateable.QuickFix()
+	paginateable.UpdatedAt = paginateable.UpdatedAt.UTC().Truncate(DefaultTimestampPrecision)
+	err := ExecuteSingleRowWriteInTransaction(testDB, EmptyOps, conditionalInsertQuery, Args2SliceFnWrapper(paginateable.ID, "original", paginateable.CreatedAt, paginateable.UpdatedAt))
+	assert.Nil(t, err)
+	stale := *paginateable
+	lastUpdatedAt := paginateable.UpdatedAt
+	assert.Nil(t, ExecuteConditionalUpdate(testDB, paginateable, conditionalSetQuery, Args2SliceFnWrapper("updated")))
+	assert.True(t, paginateable.UpdatedAt.After(lastUpdatedAt))
+	var name string
+	assert.Nil(t, QuerySingleRow(testDB, "SELECT name FROM conditional_update_test WHERE id = ? AND updatedAt = ?", Args2SliceFnWrapper(paginateable.ID, paginateable.UpdatedAt), Args2SliceFnWrapper(&name)))
+	assert.Equal(t, "updated", name)
+	assert.Equal(t, ErrStaleModel, ExecuteConditionalUpdate(testDB, &stale, conditionalSetQuery, Args2SliceFnWrapper("stale")))
+	assert.True(t, stale.UpdatedAt.Equal(lastUpdatedAt))
+}
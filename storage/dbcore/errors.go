@@ -0,0 +1,46 @@
+// Package dbcore holds the storage error sentinels, migration state, pool health and request ID context that the HTTP layer needs,
+// without depending on the DB drivers and migration tooling of the storage package.
+package dbcore
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotFound is matched by errors.Is when the row being read, updated or deleted does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicateKey is matched by errors.Is when a write violates a primary key or unique constraint
+	ErrDuplicateKey = errors.New("duplicate key")
+	// ErrForeignKeyViolation is matched by errors.Is when a write violates a foreign key constraint
+	ErrForeignKeyViolation = errors.New("foreign key constraint violation")
+	// ErrCheckViolation is matched by errors.Is when a write violates a check constraint
+	ErrCheckViolation = errors.New("check constraint violation")
+	// ErrDeadlock is matched by errors.Is when the transaction was rolled back to resolve a deadlock
+	ErrDeadlock = errors.New("deadlock detected")
+	// ErrLockTimeout is matched by errors.Is when a lock could not be acquired in time, e.g. SQLite3's `database is locked`
+	ErrLockTimeout = errors.New("lock wait timeout")
+	// ErrReadOnly is matched by errors.Is when a write is attempted against a read only database
+	ErrReadOnly = errors.New("database is read only")
+	// ErrStaleModel is returned when an optimistic update finds the row's updatedAt changed since the model was read
+	ErrStaleModel = errors.New("model modified since it was read")
+)
+
+// DBError wraps a driver error with the library sentinel it is classified as; errors.As can still reach the driver error
+type DBError struct {
+	Kind error
+	Err  error
+}
+
+func (e *DBError) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the original driver error
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows errors.Is to match the classified sentinel
+func (e *DBError) Is(target error) bool {
+	return target == e.Kind
+}
@@ -0,0 +1,52 @@
+package dbcore
+
+import (
+	"sync"
+)
+
+const (
+	// MigrationPending is the state before migration is attempted
+	MigrationPending MigrationState = "pending"
+	// MigrationWaiting is the state while another instance holds the migration lock
+	MigrationWaiting MigrationState = "waiting"
+	// MigrationRunning is the state while this instance applies migrations
+	MigrationRunning MigrationState = "running"
+	// MigrationComplete is the state once the schema is at the latest version of the migration source or migration is disabled
+	MigrationComplete MigrationState = "complete"
+	// MigrationFailed is the state if migration failed or timed out
+	MigrationFailed MigrationState = "failed"
+)
+
+var (
+	migrationStatus = &migrationStateHolder{state: MigrationPending}
+)
+
+// MigrationState represents the progress of the startup migration, for readiness checks
+type MigrationState string
+
+type migrationStateHolder struct {
+	state MigrationState
+	err   error
+	mutex sync.RWMutex
+}
+
+// SetMigrationState records the progress of the startup migration and, if it failed, the failure
+func SetMigrationState(state MigrationState, err error) {
+	migrationStatus.mutex.Lock()
+	defer migrationStatus.mutex.Unlock()
+	migrationStatus.state = state
+	migrationStatus.err = err
+}
+
+// GetMigrationState returns the state of the startup migration
+func GetMigrationState() MigrationState {
+	state, _ := GetMigrationStatus()
+	return state
+}
+
+// GetMigrationStatus returns the state of the startup migration and the failure if it failed
+func GetMigrationStatus() (MigrationState, error) {
+	migrationStatus.mutex.RLock()
+	defer migrationStatus.mutex.RUnlock()
+	return migrationStatus.state, migrationStatus.err
+}
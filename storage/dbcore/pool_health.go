@@ -0,0 +1,45 @@
+package dbcore
+
+import (
+	"time"
+)
+
+const (
+	// PoolHealthy means the DB responds to ping and the pool has capacity
+	PoolHealthy PoolHealthStatus = "healthy"
+	// PoolDegraded means the DB responds to ping but the pool is, or is close to being, exhausted
+	PoolDegraded PoolHealthStatus = "degraded"
+	// PoolUnhealthy means the DB did not respond to ping
+	PoolUnhealthy PoolHealthStatus = "unhealthy"
+)
+
+type (
+	// PoolHealthStatus represents the overall health of the DB connection pool
+	PoolHealthStatus string
+
+	// PoolStats is the JSON friendly form of sql.DBStats; WaitCount and WaitDurationMillis are totals since the pool was created
+	PoolStats struct {
+		MaxOpenConnections int   `json:"maxOpenConnections"`
+		OpenConnections    int   `json:"openConnections"`
+		InUse              int   `json:"inUse"`
+		Idle               int   `json:"idle"`
+		WaitCount          int64 `json:"waitCount"`
+		WaitDurationMillis int64 `json:"waitDurationMillis"`
+		MaxIdleClosed      int64 `json:"maxIdleClosed"`
+		MaxIdleTimeClosed  int64 `json:"maxIdleTimeClosed"`
+		MaxLifetimeClosed  int64 `json:"maxLifetimeClosed"`
+	}
+
+	// PoolHealth is the result of a pool check meant to be surfaced by the HTTP layer
+	PoolHealth struct {
+		Status    PoolHealthStatus `json:"status"`
+		Stats     PoolStats        `json:"stats"`
+		Reasons   []string         `json:"reasons,omitempty"`
+		CheckedAt time.Time        `json:"checkedAt"`
+	}
+)
+
+// IsAvailable returns whether the pool can serve queries, i.e. it is not unhealthy
+func (health *PoolHealth) IsAvailable() bool {
+	return health.Status != PoolUnhealthy
+}
@@ -0,0 +1,18 @@
+package dbcore
+
+import (
+	"context"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID to be included in query logs and events
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// GetRequestID returns the request ID set using WithRequestID or empty string
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/mattn/go-sqlite3"
+)
+
+// MySQL server error numbers used for classification
+const (
+	mysqlErrDuplicateEntry          uint16 = 1062
+	mysqlErrDuplicateEntryWithKey   uint16 = 1586
+	mysqlErrLockWaitTimeout         uint16 = 1205
+	mysqlErrDeadlock                uint16 = 1213
+	mysqlErrRowIsReferenced         uint16 = 1217
+	mysqlErrNoReferencedRow         uint16 = 1216
+	mysqlErrRowIsReferenced2        uint16 = 1451
+	mysqlErrNoReferencedRow2        uint16 = 1452
+	mysqlErrOptionPreventsStatement uint16 = 1290
+	mysqlErrReadOnlyTransaction     uint16 = 1792
+	mysqlErrInnodbReadOnly          uint16 = 1874
+	mysqlErrCheckConstraintViolated uint16 = 3819
+)
+
+var (
+	// ErrNotFound is matched by errors.Is when the row being read, updated or deleted does not exist
+	ErrNotFound = dbcore.ErrNotFound
+	// ErrDuplicateKey is matched by errors.Is when a write violates a primary key or unique constraint
+	ErrDuplicateKey = dbcore.ErrDuplicateKey
+	// ErrForeignKeyViolation is matched by errors.Is when a write violates a foreign key constraint
+	ErrForeignKeyViolation = dbcore.ErrForeignKeyViolation
+	// ErrCheckViolation is matched by errors.Is when a write violates a check constraint
+	ErrCheckViolation = dbcore.ErrCheckViolation
+	// ErrDeadlock is matched by errors.Is when the transaction was rolled back to resolve a deadlock
+	ErrDeadlock = dbcore.ErrDeadlock
+	// ErrLockTimeout is matched by errors.Is when a lock could not be acquired in time, e.g. SQLite3's `database is locked`
+	ErrLockTimeout = dbcore.ErrLockTimeout
+	// ErrReadOnly is matched by errors.Is when a write is attempted against a read only database
+	ErrReadOnly = dbcore.ErrReadOnly
+)
+
+// DBError wraps a driver error with the library sentinel it is classified as; errors.As can still reach the driver error
+type DBError = dbcore.DBError
+
+var (
+	// ClassifyError translates sql.ErrNoRows, MySQL and SQLite3 driver errors to a *DBError; other errors are returned as is
+	ClassifyError = func(err error) error {
+		if err == nil {
+			return nil
+		}
+		var dbErr *DBError
+		if errors.As(err, &dbErr) {
+			return err
+		}
+		if kind := getErrorKind(err); kind != nil {
+			return &DBError{Kind: kind, Err: err}
+		}
+		return err
+	}
+
+	// IsRetryable checks whether the error is transient and the transaction could be retried
+	IsRetryable = func(err error) bool {
+		return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrLockTimeout)
+	}
+)
+
+func getErrorKind(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return getMySQLErrorKind(mysqlErr)
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return getSQLite3ErrorKind(sqliteErr)
+	}
+	return nil
+}
+
+func getMySQLErrorKind(err *mysql.MySQLError) error {
+	switch err.Number {
+	case mysqlErrDuplicateEntry, mysqlErrDuplicateEntryWithKey:
+		return ErrDuplicateKey
+	case mysqlErrRowIsReferenced, mysqlErrNoReferencedRow, mysqlErrRowIsReferenced2, mysqlErrNoReferencedRow2:
+		return ErrForeignKeyViolation
+	case mysqlErrCheckConstraintViolated:
+		return ErrCheckViolation
+	case mysqlErrDeadlock:
+		return ErrDeadlock
+	case mysqlErrLockWaitTimeout:
+		return ErrLockTimeout
+	case mysqlErrOptionPreventsStatement, mysqlErrReadOnlyTransaction, mysqlErrInnodbReadOnly:
+		return ErrReadOnly
+	}
+	return nil
+}
+
+func getSQLite3ErrorKind(err sqlite3.Error) error {
+	switch err.Code {
+	case sqlite3.ErrConstraint:
+		switch err.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey, sqlite3.ErrConstraintRowID:
+			return ErrDuplicateKey
+		case sqlite3.ErrConstraintForeignKey:
+			return ErrForeignKeyViolation
+		case sqlite3.ErrConstraintCheck:
+			return ErrCheckViolation
+		}
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return ErrLockTimeout
+	case sqlite3.ErrReadonly:
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	unknownErr := errors.New("unknown")
+	testCases := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"NoRows", sql.ErrNoRows, ErrNotFound},
+		{"WrappedNoRows", fmt.Errorf("reading: %w", sql.ErrNoRows), ErrNotFound},
+		{"MySQLDuplicate", &mysql.MySQLError{Number: 1062}, ErrDuplicateKey},
+		{"MySQLForeignKey", &mysql.MySQLError{Number: 1452}, ErrForeignKeyViolation},
+		{"MySQLCheck", &mysql.MySQLError{Number: 3819}, ErrCheckViolation},
+		{"MySQLDeadlock", &mysql.MySQLError{Number: 1213}, ErrDeadlock},
+		{"MySQLLockTimeout", &mysql.MySQLError{Number: 1205}, ErrLockTimeout},
+		{"MySQLReadOnly", &mysql.MySQLError{Number: 1290}, ErrReadOnly},
+		{"SQLite3Unique", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, ErrDuplicateKey},
+		{"SQLite3PrimaryKey", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, ErrDuplicateKey},
+		{"SQLite3ForeignKey", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintForeignKey}, ErrForeignKeyViolation},
+		{"SQLite3Check", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintCheck}, ErrCheckViolation},
+		{"SQLite3Busy", sqlite3.Error{Code: sqlite3.ErrBusy}, ErrLockTimeout},
+		{"SQLite3ReadOnly", sqlite3.Error{Code: sqlite3.ErrReadonly}, ErrReadOnly},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			classified := ClassifyError(testCase.err)
+			assert.True(t, errors.Is(classified, testCase.kind))
+			assert.True(t, errors.Is(classified, testCase.err) || errors.Is(testCase.err, sql.ErrNoRows))
+			assert.Equal(t, classified, ClassifyError(classified))
+		})
+	}
+	t.Run("Unclassified", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, ClassifyError(nil))
+		assert.Equal(t, unknownErr, ClassifyError(unknownErr))
+		mysqlErr := &mysql.MySQLError{Number: 1064}
+		assert.Equal(t, mysqlErr, ClassifyError(mysqlErr))
+		sqliteErr := sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintNotNull}
+		assert.Equal(t, sqliteErr, ClassifyError(sqliteErr))
+	})
+	t.Run("DriverErrorReachable", func(t *testing.T) {
+		t.Parallel()
+		var mysqlErr *mysql.MySQLError
+		assert.True(t, errors.As(ClassifyError(&mysql.MySQLError{Number: 1062, Message: "dup"}), &mysqlErr))
+		assert.Equal(t, uint16(1062), mysqlErr.Number)
+	})
+	t.Run("IsRetryable", func(t *testing.T) {
+		t.Parallel()
+		assert.True(t, IsRetryable(ClassifyError(&mysql.MySQLError{Number: 1213})))
+		assert.True(t, IsRetryable(ClassifyError(sqlite3.Error{Code: sqlite3.ErrBusy})))
+		assert.False(t, IsRetryable(ClassifyError(sql.ErrNoRows)))
+	})
+}
@@ -0,0 +1,469 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// QueryKindQuery marks a QueryEvent for a read query
+	QueryKindQuery = "query"
+	// QueryKindExec marks a QueryEvent for a write query
+	QueryKindExec = "exec"
+)
+
+type (
+	// QueryEvent describes a query executed through the instrumented driver. Args are the raw arguments; use GetRedactedArgs when
+	// exporting them. RowsAffected is -1 for read queries and failed writes; Duration and Err are only set for AfterQuery.
+	QueryEvent struct {
+		Kind         string
+		Query        string
+		Args         []driver.NamedValue
+		RequestID    string
+		StartedAt    time.Time
+		Duration     time.Duration
+		RowsAffected int64
+		Err          error
+	}
+
+	// QueryHook is notified before and after every query executed on pools created by CreateDBConnectionPool. Hooks run on the query's
+	// goroutine, so they must be quick and safe for concurrent use.
+	QueryHook interface {
+		BeforeQuery(ctx context.Context, event *QueryEvent)
+		AfterQuery(ctx context.Context, event *QueryEvent)
+	}
+
+	queryInstrumentation struct {
+		slowQueryThreshold time.Duration
+		logArgs            bool
+		hooks              []QueryHook
+	}
+
+	instrumentedDriver struct {
+		driver.Driver
+		connector *instrumentedConnector
+	}
+
+	// instrumentedConnector opens the connections of a pool with its current connection URL; changing the URL retires the connections
+	// opened with the previous one as they are returned to the pool
+	instrumentedConnector struct {
+		driver       *instrumentedDriver
+		target       atomic.Value
+		db           *sql.DB
+		maxIdleConns int32
+	}
+
+	connectionTarget struct {
+		connectionURL string
+		generation    uint64
+	}
+
+	// instrumentedConn remembers the request ID of the context its transaction began with, so that queries of the transaction run
+	// without a context, e.g. sql.Tx.Exec, are still attributed to the request
+	instrumentedConn struct {
+		driver.Conn
+		connector   *instrumentedConnector
+		generation  uint64
+		txRequestID string
+	}
+
+	instrumentedTx struct {
+		driver.Tx
+		conn *instrumentedConn
+	}
+
+	instrumentedStmt struct {
+		driver.Stmt
+		conn  *instrumentedConn
+		query string
+	}
+)
+
+var (
+	instrumentation         atomic.Value
+	instrumentationMutex    sync.Mutex
+	instrumentedDriverMutex sync.Mutex
+	baseDrivers             = make(map[string]driver.Driver)
+
+	// RedactQueryArg converts an argument to what is logged for slow queries when argument logging is disabled; by default only the
+	// type and, for strings and bytes, length are retained
+	RedactQueryArg = func(arg driver.NamedValue) interface{} {
+		switch value := arg.Value.(type) {
+		case nil:
+			return nil
+		case string:
+			return fmt.Sprintf("<string len=%d>", len(value))
+		case []byte:
+			return fmt.Sprintf("<bytes len=%d>", len(value))
+		default:
+			return fmt.Sprintf("<%T>", value)
+		}
+	}
+)
+
+func init() {
+	instrumentation.Store(&queryInstrumentation{})
+}
+
+// WithRequestID returns a context carrying the request ID to be included in query logs and events
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return dbcore.WithRequestID(ctx, requestID)
+}
+
+// GetRequestID returns the request ID set using WithRequestID or empty string
+func GetRequestID(ctx context.Context) string {
+	return dbcore.GetRequestID(ctx)
+}
+
+// ConfigureSlowQueryLog sets the duration above which queries are logged as slow, 0 disables it, and whether argument values are
+// logged instead of being redacted using RedactQueryArg
+func ConfigureSlowQueryLog(threshold time.Duration, logArgs bool) {
+	updateInstrumentation(func(current *queryInstrumentation) {
+		current.slowQueryThreshold = threshold
+		current.logArgs = logArgs
+	})
+}
+
+// AddQueryHook subscribes the hook to queries of all instrumented pools
+func AddQueryHook(hook QueryHook) {
+	updateInstrumentation(func(current *queryInstrumentation) {
+		current.hooks = append(current.hooks[:len(current.hooks):len(current.hooks)], hook)
+	})
+}
+
+// RemoveQueryHooks unsubscribes all query hooks
+func RemoveQueryHooks() {
+	updateInstrumentation(func(current *queryInstrumentation) {
+		current.hooks = nil
+	})
+}
+
+// GetRedactedArgs returns the arguments as logged for slow queries when argument logging is disabled
+func (event *QueryEvent) GetRedactedArgs() []interface{} {
+	redacted := make([]interface{}, len(event.Args))
+	for index, arg := range event.Args {
+		redacted[index] = RedactQueryArg(arg)
+	}
+	return redacted
+}
+
+func updateInstrumentation(update func(current *queryInstrumentation)) {
+	instrumentationMutex.Lock()
+	defer instrumentationMutex.Unlock()
+	updated := *instrumentation.Load().(*queryInstrumentation)
+	update(&updated)
+	instrumentation.Store(&updated)
+}
+
+// getBaseDriver looks up, once per dialect, the registered driver of the dialect
+func getBaseDriver(dialect string) (driver.Driver, error) {
+	instrumentedDriverMutex.Lock()
+	defer instrumentedDriverMutex.Unlock()
+	baseDriver, ok := baseDrivers[dialect]
+	if !ok {
+		// sql.Open does not connect, it only looks up the driver
+		db, err := sql.Open(dialect, "")
+		if err != nil {
+			return nil, err
+		}
+		baseDriver = db.Driver()
+		db.Close()
+		baseDrivers[dialect] = baseDriver
+	}
+	return baseDriver, nil
+}
+
+func newInstrumentedConnector(dialect, connectionURL string) (*instrumentedConnector, error) {
+	baseDriver, err := getBaseDriver(dialect)
+	if err != nil {
+		return nil, err
+	}
+	connector := &instrumentedConnector{}
+	connector.driver = &instrumentedDriver{Driver: baseDriver, connector: connector}
+	connector.target.Store(&connectionTarget{connectionURL: connectionURL})
+	return connector, nil
+}
+
+// getInstrumentedConnector returns the connector of a pool created by getDB, or nil for any other pool
+func getInstrumentedConnector(db *sql.DB) *instrumentedConnector {
+	if instrumented, ok := db.Driver().(*instrumentedDriver); ok {
+		return instrumented.connector
+	}
+	return nil
+}
+
+// Connect opens a connection with the current connection URL
+func (connector *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	target := connector.target.Load().(*connectionTarget)
+	conn, err := connector.driver.Driver.Open(target.connectionURL)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, connector: connector, generation: target.generation}, nil
+}
+
+// Driver returns the instrumented driver of the connector
+func (connector *instrumentedConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// Close is called when the pool of the connector is closed and releases the state kept for it
+func (connector *instrumentedConnector) Close() error {
+	if connector.db != nil {
+		DisableWriteSerialization(connector.db)
+	}
+	return nil
+}
+
+func (connector *instrumentedConnector) setConnectionURL(connectionURL string) {
+	current := connector.target.Load().(*connectionTarget)
+	connector.target.Store(&connectionTarget{connectionURL: connectionURL, generation: current.generation + 1})
+}
+
+func instrument(ctx context.Context, kind, query string, args []driver.NamedValue, execute func() (driver.Result, error)) error {
+	settings := instrumentation.Load().(*queryInstrumentation)
+	if settings.slowQueryThreshold <= 0 && len(settings.hooks) == 0 {
+		_, err := execute()
+		return err
+	}
+	event := &QueryEvent{Kind: kind, Query: query, Args: args, RequestID: GetRequestID(ctx), StartedAt: time.Now(), RowsAffected: -1}
+	for _, hook := range settings.hooks {
+		hook.BeforeQuery(ctx, event)
+	}
+	result, err := execute()
+	event.Duration = time.Since(event.StartedAt)
+	event.Err = err
+	if err == nil && result != nil {
+		if rowsAffected, rowsErr := result.RowsAffected(); rowsErr == nil {
+			event.RowsAffected = rowsAffected
+		}
+	}
+	for _, hook := range settings.hooks {
+		hook.AfterQuery(ctx, event)
+	}
+	if settings.slowQueryThreshold > 0 && event.Duration >= settings.slowQueryThreshold {
+		logEvent := log.Warn().Str("kind", kind).Str("query", query).Dur("duration", event.Duration).Int64("rowsAffected", event.RowsAffected).Err(err)
+		if len(event.RequestID) > 0 {
+			logEvent = logEvent.Str("requestId", event.RequestID)
+		}
+		if settings.logArgs {
+			values := make([]interface{}, len(args))
+			for index, arg := range args {
+				values[index] = arg.Value
+			}
+			logEvent = logEvent.Interface("args", values)
+		} else {
+			logEvent = logEvent.Interface("args", event.GetRedactedArgs())
+		}
+		logEvent.Msg("slow query")
+	}
+	return err
+}
+
+func instrumentExec(ctx context.Context, query string, args []driver.NamedValue, exec func() (driver.Result, error)) (result driver.Result, err error) {
+	err = instrument(ctx, QueryKindExec, query, args, func() (driver.Result, error) {
+		result, err = exec()
+		return result, err
+	})
+	return result, err
+}
+
+func instrumentQuery(ctx context.Context, query string, args []driver.NamedValue, runQuery func() (driver.Rows, error)) (rows driver.Rows, err error) {
+	err = instrument(ctx, QueryKindQuery, query, args, func() (driver.Result, error) {
+		rows, err = runQuery()
+		return nil, err
+	})
+	return rows, err
+}
+
+func toNamedValues(args []driver.Value) []driver.NamedValue {
+	namedArgs := make([]driver.NamedValue, len(args))
+	for index, arg := range args {
+		namedArgs[index] = driver.NamedValue{Ordinal: index + 1, Value: arg}
+	}
+	return namedArgs
+}
+
+func toValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for index, arg := range args {
+		if len(arg.Name) > 0 {
+			return nil, fmt.Errorf("driver does not support named argument %s", arg.Name)
+		}
+		values[index] = arg.Value
+	}
+	return values, nil
+}
+
+// Open opens a connection of the wrapped driver
+func (instrumented *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := instrumented.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, connector: instrumented.connector}, nil
+}
+
+func (conn *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := conn.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, conn: conn, query: query}, nil
+}
+
+func (conn *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := conn.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return conn.Prepare(query)
+	}
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, conn: conn, query: query}, nil
+}
+
+func (conn *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	if beginner, ok := conn.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = conn.Conn.Begin() //nolint:staticcheck // fallback for drivers without BeginTx
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.txRequestID = GetRequestID(ctx)
+	return &instrumentedTx{Tx: tx, conn: conn}, nil
+}
+
+// withTxRequestID returns ctx carrying the request ID of the transaction in progress on the connection, unless ctx has its own
+func (conn *instrumentedConn) withTxRequestID(ctx context.Context) context.Context {
+	if len(conn.txRequestID) > 0 && len(GetRequestID(ctx)) == 0 {
+		return WithRequestID(ctx, conn.txRequestID)
+	}
+	return ctx
+}
+
+func (conn *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := conn.Conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql falls back to prepared statement which is instrumented
+		return nil, driver.ErrSkip
+	}
+	return instrumentExec(conn.withTxRequestID(ctx), query, args, func() (driver.Result, error) { return execer.ExecContext(ctx, query, args) })
+}
+
+func (conn *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := conn.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return instrumentQuery(conn.withTxRequestID(ctx), query, args, func() (driver.Rows, error) { return queryer.QueryContext(ctx, query, args) })
+}
+
+func (conn *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := conn.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (conn *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := conn.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (conn *instrumentedConn) IsValid() bool {
+	if conn.connector != nil && conn.connector.target.Load().(*connectionTarget).generation != conn.generation {
+		return false
+	}
+	if validator, ok := conn.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (conn *instrumentedConn) CheckNamedValue(namedValue *driver.NamedValue) error {
+	return checkNamedValue(conn.Conn, namedValue)
+}
+
+func checkNamedValue(target interface{}, namedValue *driver.NamedValue) error {
+	if checker, ok := target.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(namedValue)
+	}
+	return driver.ErrSkip
+}
+
+func (tx *instrumentedTx) Commit() error {
+	tx.conn.txRequestID = ""
+	return tx.Tx.Commit()
+}
+
+func (tx *instrumentedTx) Rollback() error {
+	tx.conn.txRequestID = ""
+	return tx.Tx.Rollback()
+}
+
+func (stmt *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return instrumentExec(stmt.conn.withTxRequestID(context.Background()), stmt.query, toNamedValues(args), func() (driver.Result, error) {
+		return stmt.Stmt.Exec(args) //nolint:staticcheck // wrapped driver's deprecated API
+	})
+}
+
+func (stmt *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return instrumentQuery(stmt.conn.withTxRequestID(context.Background()), stmt.query, toNamedValues(args), func() (driver.Rows, error) {
+		return stmt.Stmt.Query(args) //nolint:staticcheck // wrapped driver's deprecated API
+	})
+}
+
+func (stmt *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return instrumentExec(stmt.conn.withTxRequestID(ctx), stmt.query, args, func() (driver.Result, error) {
+		if execer, ok := stmt.Stmt.(driver.StmtExecContext); ok {
+			return execer.ExecContext(ctx, args)
+		}
+		values, err := toValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return stmt.Stmt.Exec(values) //nolint:staticcheck // fallback for drivers without ExecContext
+	})
+}
+
+func (stmt *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return instrumentQuery(stmt.conn.withTxRequestID(ctx), stmt.query, args, func() (driver.Rows, error) {
+		if queryer, ok := stmt.Stmt.(driver.StmtQueryContext); ok {
+			return queryer.QueryContext(ctx, args)
+		}
+		values, err := toValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return stmt.Stmt.Query(values) //nolint:staticcheck // fallback for drivers without QueryContext
+	})
+}
+
+// CheckNamedValue defers to the statement's checker, else to the connection's, as database/sql only consults the statement if it has one
+func (stmt *instrumentedStmt) CheckNamedValue(namedValue *driver.NamedValue) error {
+	if err := checkNamedValue(stmt.Stmt, namedValue); err != driver.ErrSkip {
+		return err
+	}
+	if converter, ok := stmt.Stmt.(driver.ColumnConverter); ok { //nolint:staticcheck // wrapped driver's deprecated API
+		value, err := converter.ColumnConverter(namedValue.Ordinal - 1).ConvertValue(namedValue.Value)
+		if err == nil {
+			namedValue.Value = value
+		}
+		return err
+	}
+	return checkNamedValue(stmt.conn.Conn, namedValue)
+}
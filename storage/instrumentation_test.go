@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingQueryHook struct {
+	mutex  sync.Mutex
+	before []QueryEvent
+	after  []QueryEvent
+}
+
+func (hook *recordingQueryHook) BeforeQuery(ctx context.Context, event *QueryEvent) {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	hook.before = append(hook.before, *event)
+}
+
+func (hook *recordingQueryHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	hook.after = append(hook.after, *event)
+}
+
+func TestRequestIDContext(t *testing.T) {
+	assert.Equal(t, "", GetRequestID(context.Background()))
+	assert.Equal(t, "request-1", GetRequestID(WithRequestID(context.Background(), "request-1")))
+}
+
+func TestRedactQueryArg(t *testing.T) {
+	event := &QueryEvent{Args: []driver.NamedValue{{Value: "secret"}, {Value: []byte("abc")}, {Value: int64(5)}, {Value: nil}}}
+	assert.Equal(t, []interface{}{"<string len=6>", "<bytes len=3>", "<int64>", nil}, event.GetRedactedArgs())
+}
+
+func TestQueryInstrumentation(t *testing.T) {
+	hook := &recordingQueryHook{}
+	AddQueryHook(hook)
+	defer RemoveQueryHooks()
+	var logOutput bytes.Buffer
+	oldLogger := log.Logger
+	log.Logger = zerolog.New(&logOutput)
+	defer func() { log.Logger = oldLogger }()
+	ConfigureSlowQueryLog(time.Nanosecond, false)
+	defer ConfigureSlowQueryLog(0, false)
+	ctx := WithRequestID(context.Background(), "request-2")
+	id := xid.New().String()
+	_, err := testDB.ExecContext(ctx, "INSERT INTO `test` (id, name, note, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?)", id, "instrumented", "secret note", time.Now(), time.Now())
+	assert.Nil(t, err)
+	var name string
+	assert.Nil(t, testDB.QueryRowContext(ctx, "SELECT name FROM `test` WHERE id = ?", id).Scan(&name))
+	assert.Nil(t, ExecuteOpsInTransaction(testDB, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM `test` WHERE id = ?", id)
+		return err
+	}))
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	assert.Equal(t, 3, len(hook.before))
+	assert.Equal(t, 3, len(hook.after))
+	assert.Equal(t, QueryKindExec, hook.after[0].Kind)
+	assert.Equal(t, "request-2", hook.after[0].RequestID)
+	assert.Equal(t, int64(1), hook.after[0].RowsAffected)
+	assert.True(t, hook.after[0].Duration > 0)
+	assert.Equal(t, QueryKindQuery, hook.after[1].Kind)
+	assert.Equal(t, int64(-1), hook.after[1].RowsAffected)
+	assert.Equal(t, "", hook.after[2].RequestID)
+	assert.Equal(t, int64(1), hook.after[2].RowsAffected)
+	assert.Contains(t, logOutput.String(), "slow query")
+	assert.Contains(t, logOutput.String(), "\"requestId\":\"request-2\"")
+	assert.Contains(t, logOutput.String(), "string len=11")
+	assert.NotContains(t, logOutput.String(), "secret note")
+}
+
+func TestQueryInstrumentationThroughHelpers(t *testing.T) {
+	hook := &recordingQueryHook{}
+	AddQueryHook(hook)
+	defer RemoveQueryHooks()
+	ctx := WithRequestID(context.Background(), "request-3")
+	id := xid.New().String()
+	now := time.Now()
+	assert.Nil(t, ExecuteMultipleWriteOpsInTransactionContext(ctx, testDB, GetTxWrapperForSingleWriteQuery(EmptyOps,
+		"INSERT INTO `test` (id, name, note, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?)", Args2SliceFnWrapper(id, "helper", "note", now, now))))
+	var name string
+	assert.Nil(t, QuerySingleRowContext(ctx, testDB, "SELECT name FROM `test` WHERE id = ?", Args2SliceFnWrapper(id), Args2SliceFnWrapper(&name)))
+	assert.Nil(t, QueryRowsContext(ctx, testDB, "SELECT name FROM `test` WHERE id = ?", Args2SliceFnWrapper(id), Args2SliceFnWrapper(&name)))
+	assert.Nil(t, ExecuteSingleRowWriteInTransaction(testDB, EmptyOps, "DELETE FROM `test` WHERE id = ?", Args2SliceFnWrapper(id)))
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	assert.Equal(t, 4, len(hook.after))
+	for _, event := range hook.after[:3] {
+		assert.Equal(t, "request-3", event.RequestID, event.Query)
+	}
+	assert.Equal(t, "", hook.after[3].RequestID)
+}
+
+func TestNewInstrumentedConnector(t *testing.T) {
+	connector, err := newInstrumentedConnector("sqlite3", ":memory:")
+	assert.Nil(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	assert.Equal(t, connector, getInstrumentedConnector(db))
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.True(t, conn.(*instrumentedConn).IsValid())
+	connector.setConnectionURL(":memory:")
+	assert.False(t, conn.(*instrumentedConn).IsValid())
+	_, err = newInstrumentedConnector("unknown", "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultJobMaxAttempts is used when a job is enqueued without MaxAttempts
+	DefaultJobMaxAttempts = 5
+	// DefaultJobLeaseDuration is used when a worker has no LeaseDuration
+	DefaultJobLeaseDuration = 30 * time.Second
+	// DefaultJobPollInterval is used when a worker has no PollInterval
+	DefaultJobPollInterval = time.Second
+	maxJobLastErrorLength  = 1024
+	jobLeasableFilter      = "`queue` = ? AND `deadAt` IS NULL AND `runAt` <= ? AND (`leaseToken` = '' OR `leaseExpiresAt` < ?)"
+	jobLeaseOrder          = " ORDER BY `priority` DESC, `runAt` ASC, `id` ASC LIMIT 1"
+)
+
+var (
+	// ErrNoJobAvailable is returned by Lease when no job of the queue is due
+	ErrNoJobAvailable = errors.New("no job available to lease")
+	// ErrJobLeaseLost is returned when the job's lease expired and it was leased by another worker or finished
+	ErrJobLeaseLost = errors.New("job lease lost")
+	// ErrNoJobHandler is returned when the worker is started without a handler
+	ErrNoJobHandler = errors.New("job worker requires a handler")
+	// DefaultJobMinBackoff is the delay before the first retry of a failed job
+	DefaultJobMinBackoff = 5 * time.Second
+	// DefaultJobMaxBackoff caps the exponentially growing retry delay of a failed job
+	DefaultJobMaxBackoff = time.Hour
+)
+
+// GetJobQueueTableMigration returns the up and down SQL of the job queue table for the application to add to its migration source; the
+// up migration has two statements, so MySQL connection URL needs multiStatements=true for migration
+func GetJobQueueTableMigration(dialect config.DBDialect, table string) (up string, down string, err error) {
+	dateTimeType := getDateTimeType(dialect)
+	return getTableMigration(table, []string{
+		"`id` VARCHAR(255) NOT NULL PRIMARY KEY",
+		"`queue` VARCHAR(255) NOT NULL",
+		"`payload` BLOB NOT NULL",
+		"`priority` INT NOT NULL DEFAULT 0",
+		"`runAt` " + dateTimeType + " NOT NULL",
+		"`attempts` INT NOT NULL DEFAULT 0",
+		"`maxAttempts` INT NOT NULL",
+		"`leaseToken` VARCHAR(255) NOT NULL DEFAULT ''",
+		"`leaseExpiresAt` " + dateTimeType + " NULL",
+		"`lastError` VARCHAR(1024) NOT NULL DEFAULT ''",
+		"`deadAt` " + dateTimeType + " NULL",
+		"`createdAt` " + dateTimeType + " NOT NULL",
+		"`updatedAt` " + dateTimeType + " NOT NULL",
+	}, tableIndex{suffix: "lease_idx", columns: []string{"queue", "deadAt", "runAt", "priority"}})
+}
+
+// Job represents a row of the job queue table
+type Job struct {
+	data.BasePaginateable
+	Queue          string       `db:"queue"`
+	Payload        []byte       `db:"payload"`
+	Priority       int          `db:"priority"`
+	RunAt          time.Time    `db:"runAt"`
+	Attempts       int          `db:"attempts"`
+	MaxAttempts    int          `db:"maxAttempts"`
+	LeaseToken     string       `db:"leaseToken"`
+	LeaseExpiresAt sql.NullTime `db:"leaseExpiresAt"`
+	LastError      string       `db:"lastError"`
+	DeadAt         sql.NullTime `db:"deadAt"`
+}
+
+// IsInValidState returns false if the job has no queue
+func (job *Job) IsInValidState() bool {
+	return len(job.Queue) > 0
+}
+
+// IsDead returns whether the job exhausted its attempts and is dead lettered
+func (job *Job) IsDead() bool {
+	return job.DeadAt.Valid
+}
+
+// JobHandler processes a leased job; returning an error retries the job with backoff until its attempts are exhausted. ctx is
+// cancelled if the lease is lost or the worker is forced to stop.
+type JobHandler interface {
+	Handle(ctx context.Context, job *Job) error
+}
+
+// JobHandlerFunc allows a function to be used as a JobHandler
+type JobHandlerFunc func(ctx context.Context, job *Job) error
+
+// Handle calls the function
+func (fn JobHandlerFunc) Handle(ctx context.Context, job *Job) error {
+	return fn(ctx, job)
+}
+
+// JobQueue stores jobs in the table created through GetJobQueueTableMigration. Jobs are leased, highest priority and earliest run at
+// first, using `SELECT ... FOR UPDATE SKIP LOCKED` on MySQL (8.0+) and a lease token written by a single UPDATE on SQLite.
+type JobQueue struct {
+	db      *sql.DB
+	dialect config.DBDialect
+	repo    *Repository
+}
+
+// NewJobQueue creates a job queue backed by the table
+func NewJobQueue(db *sql.DB, dialect config.DBDialect, table string) (*JobQueue, error) {
+	repo, err := NewRepository(db, table, &Job{})
+	if err != nil {
+		return nil, err
+	}
+	return &JobQueue{db: db, dialect: dialect, repo: repo}, nil
+}
+
+// EnqueueOp returns a transaction op that inserts the job; RunAt defaults to now and MaxAttempts to DefaultJobMaxAttempts
+func (queue *JobQueue) EnqueueOp(job *Job) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		job.QuickFix()
+		if job.RunAt.IsZero() {
+			job.RunAt = job.CreatedAt
+		}
+		if job.MaxAttempts <= 0 {
+			job.MaxAttempts = DefaultJobMaxAttempts
+		}
+		if job.Payload == nil {
+			job.Payload = []byte{}
+		}
+		job.RunAt = queue.repo.normalizeTimestamp(job.RunAt)
+		return queue.repo.CreateOp(job)(tx)
+	}
+}
+
+// Enqueue inserts the job in its own transaction
+func (queue *JobQueue) Enqueue(job *Job) error {
+	return ExecuteMultipleWriteOpsInTransaction(queue.db, queue.EnqueueOp(job))
+}
+
+// Get reads the job with the id; ErrNotFound is matched once it is completed
+func (queue *JobQueue) Get(id xid.ID) (*Job, error) {
+	job := &Job{}
+	return job, queue.repo.Get(id, job)
+}
+
+// Lease leases the next due job of the named queue for leaseDuration, counting it as an attempt; ErrNoJobAvailable is returned if none
+func (queue *JobQueue) Lease(ctx context.Context, name string, leaseDuration time.Duration) (*Job, error) {
+	now := queue.repo.normalizeTimestamp(time.Now())
+	leaseToken := xid.New().String()
+	leaseExpiresAt := now.Add(leaseDuration)
+	table := quoteIdentifier(queue.repo.GetTableName())
+	leaseSet := "UPDATE " + table + " SET `leaseToken` = ?, `leaseExpiresAt` = ?, `attempts` = `attempts` + 1, `updatedAt` = ? WHERE `id` = "
+	var leased int64
+	err := ExecuteOpsInTransaction(queue.db, func(tx *sql.Tx) error {
+		var result sql.Result
+		var err error
+		switch queue.dialect {
+		case config.MySQLDialect:
+			var id string
+			err = tx.QueryRowContext(ctx, "SELECT `id` FROM "+table+" WHERE "+jobLeasableFilter+jobLeaseOrder+" FOR UPDATE SKIP LOCKED", name, now, now).Scan(&id)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err == nil {
+				result, err = tx.ExecContext(ctx, leaseSet+"?", leaseToken, leaseExpiresAt, now, id)
+			}
+		default:
+			// SQLite serializes writers, so the eligibility check and lease are atomic in a single UPDATE
+			result, err = tx.ExecContext(ctx, leaseSet+"(SELECT `id` FROM "+table+" WHERE "+jobLeasableFilter+jobLeaseOrder+")",
+				leaseToken, leaseExpiresAt, now, name, now, now)
+		}
+		if err == nil {
+			leased, err = result.RowsAffected()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if leased < 1 {
+		return nil, ErrNoJobAvailable
+	}
+	job := &Job{}
+	return job, QuerySingleRowIntoStruct(queue.db, queue.repo.GetSelectQuery()+" WHERE `leaseToken` = ?", Args2SliceFnWrapper(leaseToken), job)
+}
+
+// Heartbeat extends the lease of the job by leaseDuration from now; ErrJobLeaseLost is returned if the job is no longer leased by it
+func (queue *JobQueue) Heartbeat(job *Job, leaseDuration time.Duration) error {
+	now := queue.repo.normalizeTimestamp(time.Now())
+	leaseExpiresAt := now.Add(leaseDuration)
+	err := queue.executeLeasedJobUpdate(job, "UPDATE "+quoteIdentifier(queue.repo.GetTableName())+" SET `leaseExpiresAt` = ?, `updatedAt` = ?", leaseExpiresAt, now)
+	if err == nil {
+		job.LeaseExpiresAt = sql.NullTime{Time: leaseExpiresAt, Valid: true}
+	}
+	return err
+}
+
+// Complete removes the successfully processed job; ErrJobLeaseLost is returned if the job is no longer leased by it
+func (queue *JobQueue) Complete(job *Job) error {
+	return queue.executeLeasedJobUpdate(job, "DELETE FROM "+quoteIdentifier(queue.repo.GetTableName()))
+}
+
+// Fail releases the lease recording the error; the job is retried after backoff or, if its attempts are exhausted, dead lettered
+func (queue *JobQueue) Fail(job *Job, jobErr error, backoff time.Duration) error {
+	now := queue.repo.normalizeTimestamp(time.Now())
+	lastError := jobErr.Error()
+	if len(lastError) > maxJobLastErrorLength {
+		lastError = lastError[:maxJobLastErrorLength]
+	}
+	releaseSet := "UPDATE " + quoteIdentifier(queue.repo.GetTableName()) + " SET `leaseToken` = '', `leaseExpiresAt` = NULL, `lastError` = ?, `updatedAt` = ?, "
+	if job.Attempts >= job.MaxAttempts {
+		log.Warn().Str("queue", job.Queue).Str("job", job.ID.String()).Int("attempts", job.Attempts).Msg("dead lettering job")
+		return queue.executeLeasedJobUpdate(job, releaseSet+"`deadAt` = ?", lastError, now, now)
+	}
+	return queue.executeLeasedJobUpdate(job, releaseSet+"`runAt` = ?", lastError, now, now.Add(backoff))
+}
+
+// Release gives up the lease so the job can be leased again immediately, e.g. when the worker is stopping
+func (queue *JobQueue) Release(job *Job) error {
+	now := queue.repo.normalizeTimestamp(time.Now())
+	return queue.executeLeasedJobUpdate(job, "UPDATE "+quoteIdentifier(queue.repo.GetTableName())+
+		" SET `leaseToken` = '', `leaseExpiresAt` = NULL, `runAt` = ?, `updatedAt` = ?", now, now)
+}
+
+// RequeueDead moves a dead lettered job back to the queue with its attempts reset; ErrNotFound is matched if no dead job has the id
+func (queue *JobQueue) RequeueDead(id xid.ID) error {
+	now := queue.repo.normalizeTimestamp(time.Now())
+	return ExecuteMultipleWriteOpsInTransaction(queue.db, func(tx *sql.Tx) error {
+		return expectSingleRowChanged(ExecuteQueryInTransaction(tx, EmptyOps, "UPDATE "+quoteIdentifier(queue.repo.GetTableName())+
+			" SET `deadAt` = NULL, `attempts` = 0, `lastError` = '', `runAt` = ?, `updatedAt` = ? WHERE `id` = ? AND `deadAt` IS NOT NULL",
+			Args2SliceFnWrapper(now, now, id), int64(1)))
+	})
+}
+
+// ListDead reads a page of dead lettered jobs of the named queue, newest first, and the pagination for the adjacent pages
+func (queue *JobQueue) ListDead(name string, page *data.Pagination, pageSize PageSizeEnum) ([]*Job, *data.Pagination, error) {
+	if page == nil {
+		page = &data.Pagination{}
+	}
+	jobs := make([]*Job, 0, getExpectedMaxRowCount(pageSize))
+	query := queue.repo.GetSelectQuery() + " WHERE `queue` = ? AND `deadAt` IS NOT NULL" + GetPaginationQueryFragmentWithConfigurablePageSize(page, true, pageSize)
+	err := QueryRowsIntoStructs(queue.db, query, Args2SliceFnWrapper(AppendWithPaginationArgs(page, name)...), &jobs)
+	if err != nil || len(jobs) == 0 {
+		return jobs, &data.Pagination{}, err
+	}
+	if page.Previous != nil {
+		reverseSlice(reflect.ValueOf(jobs), 0)
+	}
+	return jobs, data.NewPagination(jobs[len(jobs)-1], jobs[0]), nil
+}
+
+func (queue *JobQueue) executeLeasedJobUpdate(job *Job, query string, args ...interface{}) error {
+	args = append(args, job.ID, job.LeaseToken)
+	return ExecuteMultipleWriteOpsInTransaction(queue.db, func(tx *sql.Tx) error {
+		err := ExecuteQueryInTransaction(tx, EmptyOps, query+" WHERE `id` = ? AND `leaseToken` = ?", Args2SliceFnWrapper(args...), int64(1))
+		if err == ErrNoRowsUpdated {
+			err = ErrJobLeaseLost
+		}
+		return err
+	})
+}
+
+// JobWorker leases jobs of a named queue and runs them through the handler with Concurrency goroutines, extending the lease every
+// HeartbeatInterval while the handler runs. Register Drain with controller.AddShutdownHook to finish in-flight jobs on shutdown.
+type JobWorker struct {
+	Queue             *JobQueue
+	Name              string
+	Handler           JobHandler
+	Concurrency       int
+	PollInterval      time.Duration
+	LeaseDuration     time.Duration
+	HeartbeatInterval time.Duration
+	MinBackoff        time.Duration
+	MaxBackoff        time.Duration
+	stopping          chan struct{}
+	cancel            context.CancelFunc
+	waitGroup         sync.WaitGroup
+	mutex             sync.Mutex
+}
+
+// Start starts leasing and handling jobs in background until drained
+func (worker *JobWorker) Start() error {
+	if worker.Handler == nil {
+		return ErrNoJobHandler
+	}
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+	if worker.stopping != nil {
+		return errWorkerAlreadyStarted
+	}
+	concurrency := worker.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var ctx context.Context
+	ctx, worker.cancel = context.WithCancel(context.Background())
+	worker.stopping = make(chan struct{})
+	for index := 0; index < concurrency; index++ {
+		worker.waitGroup.Add(1)
+		go worker.run(ctx, worker.stopping)
+	}
+	return nil
+}
+
+// Drain stops leasing new jobs and waits for in-flight jobs to finish; if ctx expires first, in-flight jobs are cancelled and released
+// and ctx's error is returned. It matches controller.ShutdownHook.
+func (worker *JobWorker) Drain(ctx context.Context) error {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+	if worker.stopping == nil {
+		return nil
+	}
+	close(worker.stopping)
+	done := make(chan struct{})
+	go func() {
+		worker.waitGroup.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		worker.cancel()
+		<-done
+	}
+	worker.cancel()
+	worker.stopping = nil
+	return err
+}
+
+func (worker *JobWorker) getLeaseDuration() time.Duration {
+	if worker.LeaseDuration > 0 {
+		return worker.LeaseDuration
+	}
+	return DefaultJobLeaseDuration
+}
+
+func (worker *JobWorker) run(ctx context.Context, stopping chan struct{}) {
+	defer worker.waitGroup.Done()
+	pollInterval := worker.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DefaultJobPollInterval
+	}
+	for {
+		select {
+		case <-stopping:
+			return
+		default:
+		}
+		job, err := worker.Queue.Lease(ctx, worker.Name, worker.getLeaseDuration())
+		if err == nil {
+			worker.handle(ctx, job)
+			continue
+		}
+		if err != ErrNoJobAvailable && ctx.Err() == nil {
+			log.Error().Err(err).Str("queue", worker.Name).Msg("could not lease job")
+		}
+		select {
+		case <-stopping:
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (worker *JobWorker) handle(ctx context.Context, job *Job) {
+	jobCtx, cancelJob := context.WithCancel(ctx)
+	defer cancelJob()
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	// heartbeat works on a copy as it updates the lease expiry while the handler reads the job
+	leased := *job
+	go worker.heartbeat(&leased, cancelJob, heartbeatDone)
+	handleErr := worker.Handler.Handle(jobCtx, job)
+	var err error
+	switch {
+	case ctx.Err() != nil:
+		err = worker.Queue.Release(job)
+	case handleErr != nil:
+		err = worker.Queue.Fail(job, handleErr, getExponentialBackoff(job.Attempts, worker.MinBackoff, worker.MaxBackoff, DefaultJobMinBackoff, DefaultJobMaxBackoff))
+	default:
+		err = worker.Queue.Complete(job)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("queue", worker.Name).Str("job", job.ID.String()).Msg("could not finish job")
+	}
+}
+
+func (worker *JobWorker) heartbeat(job *Job, cancelJob context.CancelFunc, done chan struct{}) {
+	interval := worker.HeartbeatInterval
+	if interval <= 0 {
+		interval = worker.getLeaseDuration() / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := worker.Queue.Heartbeat(job, worker.getLeaseDuration()); err != nil {
+				log.Error().Err(err).Str("queue", worker.Name).Str("job", job.ID.String()).Msg("job heartbeat failed")
+				if err == ErrJobLeaseLost {
+					cancelJob()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestJobQueue(t *testing.T) *JobQueue {
+	queue, err := NewJobQueue(testDB, config.SQLite3Dialect, "job_queue_test")
+	assert.Nil(t, err)
+	_, err = testDB.Exec("DELETE FROM `job_queue_test`")
+	assert.Nil(t, err)
+	return queue
+}
+
+func TestGetJobQueueTableMigration(t *testing.T) {
+	up, down, err := GetJobQueueTableMigration(config.SQLite3Dialect, "job_queue_test")
+	assert.Nil(t, err)
+	upFile, _ := ioutil.ReadFile("test-migration/000010_create_job_queue_test_table.up.sql")
+	downFile, _ := ioutil.ReadFile("test-migration/000010_create_job_queue_test_table.down.sql")
+	assert.Equal(t, string(upFile), up)
+	assert.Equal(t, string(downFile), down)
+	_, _, err = GetJobQueueTableMigration(config.MySQLDialect, "jobs; --")
+	assert.Equal(t, ErrInvalidIdentifier, err)
+}
+
+func TestJobQueueLease(t *testing.T) {
+	queue := getTestJobQueue(t)
+	assert.Equal(t, ErrInvalidModelState, queue.Enqueue(&Job{}))
+	low := &Job{Queue: "lease", Payload: []byte("low")}
+	high := &Job{Queue: "lease", Payload: []byte("high"), Priority: 10, MaxAttempts: 2}
+	later := &Job{Queue: "lease", Payload: []byte("later"), Priority: 20, RunAt: time.Now().Add(time.Hour)}
+	assert.Nil(t, queue.Enqueue(low))
+	assert.Nil(t, queue.Enqueue(high))
+	assert.Nil(t, queue.Enqueue(later))
+	assert.Equal(t, DefaultJobMaxAttempts, low.MaxAttempts)
+	t.Run("PriorityAndLeaseToken", func(t *testing.T) {
+		job, err := queue.Lease(context.Background(), "lease", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, high.ID, job.ID)
+		assert.Equal(t, 1, job.Attempts)
+		assert.NotEmpty(t, job.LeaseToken)
+		assert.Nil(t, queue.Heartbeat(job, time.Minute))
+		stale := *job
+		stale.LeaseToken = "stale"
+		assert.Equal(t, ErrJobLeaseLost, queue.Heartbeat(&stale, time.Minute))
+		assert.Equal(t, ErrJobLeaseLost, queue.Complete(&stale))
+		next, err := queue.Lease(context.Background(), "lease", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, low.ID, next.ID)
+		_, err = queue.Lease(context.Background(), "lease", time.Minute)
+		assert.Equal(t, ErrNoJobAvailable, err)
+		assert.Nil(t, queue.Complete(next))
+		_, err = queue.Get(low.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Nil(t, queue.Fail(job, errors.New("first failure"), 0))
+	})
+	t.Run("RetryAndDeadLetter", func(t *testing.T) {
+		job, err := queue.Lease(context.Background(), "lease", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, high.ID, job.ID)
+		assert.Equal(t, "first failure", job.LastError)
+		assert.Equal(t, 2, job.Attempts)
+		assert.Nil(t, queue.Fail(job, errors.New("second failure"), 0))
+		dead, err := queue.Get(high.ID)
+		assert.Nil(t, err)
+		assert.True(t, dead.IsDead())
+		_, err = queue.Lease(context.Background(), "lease", time.Minute)
+		assert.Equal(t, ErrNoJobAvailable, err)
+		jobs, page, err := queue.ListDead("lease", nil, RegularPageSize)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(jobs))
+		assert.NotNil(t, page.Next)
+		injected, _, err := queue.ListDead("lease", &data.Pagination{Next: &data.Cursor{ID: "' OR 1=1 --", Timestamp: time.Now()}}, RegularPageSize)
+		assert.Nil(t, err)
+		assert.Empty(t, injected)
+		assert.Nil(t, queue.RequeueDead(high.ID))
+		assert.ErrorIs(t, queue.RequeueDead(high.ID), ErrNotFound)
+		requeued, err := queue.Lease(context.Background(), "lease", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, requeued.Attempts)
+		assert.Nil(t, queue.Release(requeued))
+	})
+	t.Run("ExpiredLease", func(t *testing.T) {
+		job, err := queue.Lease(context.Background(), "lease", -time.Second)
+		assert.Nil(t, err)
+		again, err := queue.Lease(context.Background(), "lease", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, job.ID, again.ID)
+		assert.Equal(t, ErrJobLeaseLost, queue.Complete(job))
+		assert.Nil(t, queue.Complete(again))
+	})
+}
+
+func TestJobWorker(t *testing.T) {
+	queue := getTestJobQueue(t)
+	worker := &JobWorker{Queue: queue, Name: "worker", PollInterval: 5 * time.Millisecond}
+	assert.Equal(t, ErrNoJobHandler, worker.Start())
+	var handled int32
+	worker.Concurrency = 2
+	worker.HeartbeatInterval = time.Millisecond
+	worker.Handler = JobHandlerFunc(func(ctx context.Context, job *Job) error {
+		atomic.AddInt32(&handled, 1)
+		if string(job.Payload) == "fail" {
+			return errors.New("failed")
+		}
+		if string(job.Payload) == "slow" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		time.Sleep(3 * time.Millisecond)
+		return nil
+	})
+	ok := &Job{Queue: "worker", Payload: []byte("ok")}
+	fail := &Job{Queue: "worker", Payload: []byte("fail"), MaxAttempts: 1}
+	assert.Nil(t, queue.Enqueue(ok))
+	assert.Nil(t, queue.Enqueue(fail))
+	assert.Nil(t, worker.Start())
+	assert.Equal(t, errWorkerAlreadyStarted, worker.Start())
+	handledCount := func(count int32) func() bool {
+		return func() bool { return atomic.LoadInt32(&handled) == count }
+	}
+	assert.Eventually(t, handledCount(2), time.Second, time.Millisecond)
+	slow := &Job{Queue: "worker", Payload: []byte("slow")}
+	assert.Nil(t, queue.Enqueue(slow))
+	assert.Eventually(t, handledCount(3), time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, worker.Drain(ctx))
+	assert.Nil(t, worker.Drain(context.Background()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&handled))
+	_, err := queue.Get(ok.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	failed, err := queue.Get(fail.ID)
+	assert.Nil(t, err)
+	assert.True(t, failed.IsDead())
+	released, err := queue.Get(slow.ID)
+	assert.Nil(t, err)
+	assert.Empty(t, released.LeaseToken)
+	assert.Equal(t, 1, released.Attempts)
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultLockTTL is used by leader election when TTL is not set
+	DefaultLockTTL = 15 * time.Second
+	// maxMySQLLockNameLength is the limit of GET_LOCK names
+	maxMySQLLockNameLength = 64
+)
+
+var (
+	// ErrLockNotAcquired is returned when the lock is held by another owner
+	ErrLockNotAcquired = errors.New("lock held by another owner")
+	// ErrLockLost is returned when renewing or releasing a lock that expired or was taken over
+	ErrLockLost = errors.New("lock lost")
+	// ErrInvalidLockName is returned when the lock name is empty or too long
+	ErrInvalidLockName = errors.New("lock name must be 1 to 64 characters")
+)
+
+// GetLockTableMigration returns the up and down SQL of the lock table, which holds SQLite leases and the fencing tokens of both
+// dialects, for the application to add to its migration source
+func GetLockTableMigration(dialect config.DBDialect, table string) (up string, down string, err error) {
+	return getTableMigration(table, []string{
+		"`name` VARCHAR(64) NOT NULL PRIMARY KEY",
+		"`owner` VARCHAR(255) NOT NULL",
+		"`fencingToken` BIGINT NOT NULL",
+		"`expiresAt` " + getDateTimeType(dialect) + " NOT NULL",
+	})
+}
+
+// Locker acquires named locks on the RDBMS for an owner. On MySQL the lock is a GET_LOCK held by a dedicated connection, so it is
+// released if the process dies, while on SQLite it is a lease row that expires after its TTL. Every acquisition increments the
+// lock's fencing token, which writers guarded by the lock can pass along to reject writes from a previous holder.
+type Locker struct {
+	db      *sql.DB
+	dialect config.DBDialect
+	table   string
+	owner   string
+}
+
+// Lock is an acquired lock
+type Lock struct {
+	Name         string
+	Owner        string
+	FencingToken int64
+	ExpiresAt    time.Time
+	locker       *Locker
+	conn         *sql.Conn
+}
+
+// NewLocker creates a locker storing leases in table created through GetLockTableMigration with a unique owner id for this process
+func NewLocker(db *sql.DB, dialect config.DBDialect, table string) (*Locker, error) {
+	if !isValidIdentifier(table) {
+		return nil, ErrInvalidIdentifier
+	}
+	return &Locker{db: db, dialect: dialect, table: table, owner: xid.New().String()}, nil
+}
+
+// GetOwner returns the owner id the locker acquires locks with
+func (locker *Locker) GetOwner() string {
+	return locker.owner
+}
+
+// TryAcquire acquires the lock for ttl without waiting; ErrLockNotAcquired is returned if another owner holds it
+func (locker *Locker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if !isValidLockName(name) {
+		return nil, ErrInvalidLockName
+	}
+	lock := &Lock{Name: name, Owner: locker.owner, ExpiresAt: time.Now().UTC().Add(ttl), locker: locker}
+	if locker.dialect == config.MySQLDialect {
+		conn, err := locker.db.Conn(ctx)
+		if err != nil {
+			return nil, ClassifyError(err)
+		}
+		var acquired sql.NullInt64
+		if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&acquired); err != nil || acquired.Int64 != 1 {
+			conn.Close()
+			if err == nil {
+				err = ErrLockNotAcquired
+			}
+			return nil, ClassifyError(err)
+		}
+		lock.conn = conn
+	}
+	args := []interface{}{name, locker.owner, lock.ExpiresAt}
+	if locker.dialect != config.MySQLDialect {
+		args = append(args, time.Now().UTC())
+	}
+	err := ExecuteOpsInTransaction(locker.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, locker.getAcquireQuery(), args...)
+		if err != nil {
+			return err
+		}
+		if acquired, err := result.RowsAffected(); err != nil || acquired < 1 {
+			if err == nil {
+				err = ErrLockNotAcquired
+			}
+			return err
+		}
+		return tx.QueryRowContext(ctx, "SELECT `fencingToken` FROM "+quoteIdentifier(locker.table)+" WHERE `name` = ? AND `owner` = ?", name, locker.owner).
+			Scan(&lock.FencingToken)
+	})
+	if err != nil {
+		lock.closeConn()
+		return nil, err
+	}
+	return lock, nil
+}
+
+func isValidLockName(name string) bool {
+	return len(name) > 0 && len(name) <= maxMySQLLockNameLength
+}
+
+func (locker *Locker) getAcquireQuery() string {
+	table := quoteIdentifier(locker.table)
+	insert := "INSERT INTO " + table + " (`name`, `owner`, `fencingToken`, `expiresAt`) VALUES (?, ?, 1, ?)"
+	if locker.dialect == config.MySQLDialect {
+		// GET_LOCK already guarantees exclusivity, the row only tracks the fencing token
+		return insert + " ON DUPLICATE KEY UPDATE `owner` = VALUES(`owner`), `fencingToken` = `fencingToken` + 1, `expiresAt` = VALUES(`expiresAt`)"
+	}
+	return insert + " ON CONFLICT (`name`) DO UPDATE SET `owner` = excluded.`owner`, `fencingToken` = " + table + ".`fencingToken` + 1, " +
+		"`expiresAt` = excluded.`expiresAt` WHERE " + table + ".`expiresAt` < ?"
+}
+
+// Renew extends the lock by ttl from now; ErrLockLost is returned if it expired, was taken over or its MySQL connection was lost
+func (lock *Lock) Renew(ctx context.Context, ttl time.Duration) error {
+	if lock.locker.dialect == config.MySQLDialect {
+		if lock.conn == nil {
+			return ErrLockLost
+		}
+		var held sql.NullInt64
+		if err := lock.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", lock.Name).Scan(&held); err != nil || held.Int64 != 1 {
+			log.Warn().Err(err).Str("lock", lock.Name).Msg("mysql lock no longer held")
+			lock.closeConn()
+			return ErrLockLost
+		}
+	}
+	expiresAt := time.Now().UTC().Add(ttl)
+	err := lock.executeHeldLockUpdate(ctx, "UPDATE "+quoteIdentifier(lock.locker.table)+" SET `expiresAt` = ?", expiresAt)
+	if err == nil {
+		lock.ExpiresAt = expiresAt
+	}
+	return err
+}
+
+// Release releases the lock; ErrLockLost is returned if it was no longer held
+func (lock *Lock) Release(ctx context.Context) error {
+	err := lock.executeHeldLockUpdate(ctx, "UPDATE "+quoteIdentifier(lock.locker.table)+" SET `expiresAt` = ?", time.Time{}.UTC())
+	if lock.locker.dialect == config.MySQLDialect {
+		if lock.conn == nil {
+			return ErrLockLost
+		}
+		var released sql.NullInt64
+		if relErr := lock.conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", lock.Name).Scan(&released); relErr != nil || released.Int64 != 1 {
+			err = ErrLockLost
+		}
+		lock.closeConn()
+	}
+	return err
+}
+
+func (lock *Lock) executeHeldLockUpdate(ctx context.Context, query string, expiresAt time.Time) error {
+	condition := " WHERE `name` = ? AND `owner` = ? AND `fencingToken` = ?"
+	args := []interface{}{expiresAt, lock.Name, lock.Owner, lock.FencingToken}
+	if lock.locker.dialect != config.MySQLDialect {
+		condition = condition + " AND `expiresAt` >= ?"
+		args = append(args, time.Now().UTC())
+	}
+	return ExecuteOpsInTransaction(lock.locker.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query+condition, args...)
+		if err != nil {
+			return err
+		}
+		if updated, err := result.RowsAffected(); err != nil || updated < 1 {
+			if err == nil {
+				err = ErrLockLost
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+func (lock *Lock) closeConn() {
+	if lock.conn != nil {
+		lock.conn.Close()
+		lock.conn = nil
+	}
+}
+
+// LeaderElection campaigns for a named lock so that only one instance runs scheduled work. The instance holding the lock is the leader
+// until it fails to renew; OnElected is called in its own goroutine, so it can run the leader's work, with a context cancelled on losing
+// leadership and OnDemoted after it is lost. Register Stop with controller.AddShutdownHook to step down on server shutdown.
+type LeaderElection struct {
+	Locker *Locker
+	Name   string
+	// TTL is how long leadership survives without renewal, i.e. the longest two leaders can overlap on SQLite
+	TTL time.Duration
+	// RenewInterval is how often the leader renews and followers campaign; defaults to a third of TTL
+	RenewInterval time.Duration
+	OnElected     func(ctx context.Context, fencingToken int64)
+	OnDemoted     func()
+	lock          *Lock
+	cancelLeader  context.CancelFunc
+	worker        periodicWorker
+	mutex         sync.Mutex
+}
+
+// Start campaigns immediately and then every RenewInterval until Stop is called
+func (election *LeaderElection) Start() error {
+	if !isValidLockName(election.Name) {
+		return ErrInvalidLockName
+	}
+	election.campaign(context.Background())
+	return election.worker.start(election.getRenewInterval(), election.campaign)
+}
+
+// Stop stops campaigning and releases leadership if held. It matches controller.ShutdownHook.
+func (election *LeaderElection) Stop(ctx context.Context) error {
+	election.worker.stop()
+	election.mutex.Lock()
+	if election.lock == nil {
+		election.mutex.Unlock()
+		return nil
+	}
+	err := election.lock.Release(ctx)
+	notify := election.demote()
+	election.mutex.Unlock()
+	notify()
+	return err
+}
+
+// IsLeader returns whether this instance currently holds leadership
+func (election *LeaderElection) IsLeader() bool {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+	return election.lock != nil
+}
+
+// GetFencingToken returns the fencing token of the current leadership or 0 if not the leader
+func (election *LeaderElection) GetFencingToken() int64 {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+	if election.lock == nil {
+		return 0
+	}
+	return election.lock.FencingToken
+}
+
+func (election *LeaderElection) getTTL() time.Duration {
+	if election.TTL > 0 {
+		return election.TTL
+	}
+	return DefaultLockTTL
+}
+
+func (election *LeaderElection) getRenewInterval() time.Duration {
+	if election.RenewInterval > 0 {
+		return election.RenewInterval
+	}
+	return election.getTTL() / 3
+}
+
+func (election *LeaderElection) campaign(ctx context.Context) {
+	// callbacks are invoked after unlocking so that they can query the election
+	notify := election.campaignLocked(ctx)
+	notify()
+}
+
+func (election *LeaderElection) campaignLocked(ctx context.Context) func() {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+	if election.lock != nil {
+		if err := election.lock.Renew(ctx, election.getTTL()); err != nil {
+			if ctx.Err() != nil {
+				// stopping; leave the lock for Stop to release
+				return EmptyOps
+			}
+			log.Warn().Err(err).Str("election", election.Name).Msg("lost leadership")
+			return election.demote()
+		}
+		return EmptyOps
+	}
+	lock, err := election.Locker.TryAcquire(ctx, election.Name, election.getTTL())
+	if err != nil {
+		if err != ErrLockNotAcquired {
+			log.Error().Err(err).Str("election", election.Name).Msg("could not campaign for leadership")
+		}
+		return EmptyOps
+	}
+	log.Info().Str("election", election.Name).Int64("fencingToken", lock.FencingToken).Msg("elected leader")
+	election.lock = lock
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	election.cancelLeader = cancelLeader
+	return func() {
+		if election.OnElected != nil {
+			go election.OnElected(leaderCtx, lock.FencingToken)
+		}
+	}
+}
+
+// demote clears leadership and returns the notification of it to be called after unlocking
+func (election *LeaderElection) demote() func() {
+	election.lock = nil
+	election.cancelLeader()
+	return func() {
+		if election.OnDemoted != nil {
+			election.OnDemoted()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestLocker(t *testing.T) *Locker {
+	locker, err := NewLocker(testDB, config.SQLite3Dialect, "lock_test")
+	assert.Nil(t, err)
+	return locker
+}
+
+func TestGetLockTableMigration(t *testing.T) {
+	up, down, err := GetLockTableMigration(config.SQLite3Dialect, "lock_test")
+	assert.Nil(t, err)
+	upFile, _ := ioutil.ReadFile("test-migration/000011_create_lock_test_table.up.sql")
+	downFile, _ := ioutil.ReadFile("test-migration/000011_create_lock_test_table.down.sql")
+	assert.Equal(t, string(upFile), up)
+	assert.Equal(t, string(downFile), down)
+	_, err = NewLocker(testDB, config.SQLite3Dialect, "lock; --")
+	assert.Equal(t, ErrInvalidIdentifier, err)
+}
+
+func TestLockerSQLite(t *testing.T) {
+	first := getTestLocker(t)
+	second := getTestLocker(t)
+	assert.NotEqual(t, first.GetOwner(), second.GetOwner())
+	ctx := context.Background()
+	_, err := first.TryAcquire(ctx, "", time.Minute)
+	assert.Equal(t, ErrInvalidLockName, err)
+	lock, err := first.TryAcquire(ctx, "sqlite-lock", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), lock.FencingToken)
+	_, err = second.TryAcquire(ctx, "sqlite-lock", time.Minute)
+	assert.Equal(t, ErrLockNotAcquired, err)
+	assert.Nil(t, lock.Renew(ctx, -time.Second))
+	takenOver, err := second.TryAcquire(ctx, "sqlite-lock", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), takenOver.FencingToken)
+	assert.Equal(t, ErrLockLost, lock.Renew(ctx, time.Minute))
+	assert.Equal(t, ErrLockLost, lock.Release(ctx))
+	assert.Nil(t, takenOver.Release(ctx))
+	reacquired, err := first.TryAcquire(ctx, "sqlite-lock", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), reacquired.FencingToken)
+	assert.Nil(t, reacquired.Release(ctx))
+}
+
+func TestLockerMySQL(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	locker, _ := NewLocker(db, config.MySQLDialect, "locks")
+	ctx := context.Background()
+	t.Run("NotAcquired", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, 0)")).WithArgs("mysql-lock").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+		_, err := locker.TryAcquire(ctx, "mysql-lock", time.Minute)
+		assert.Equal(t, ErrLockNotAcquired, err)
+	})
+	t.Run("AcquireRenewRelease", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, 0)")).WithArgs("mysql-lock").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("ON DUPLICATE KEY UPDATE `owner` = VALUES(`owner`), `fencingToken` = `fencingToken` + 1")).
+			WithArgs("mysql-lock", locker.GetOwner(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `fencingToken` FROM `locks`")).WillReturnRows(sqlmock.NewRows([]string{"fencingToken"}).AddRow(7))
+		mock.ExpectCommit()
+		lock, err := locker.TryAcquire(ctx, "mysql-lock", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(7), lock.FencingToken)
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT IS_USED_LOCK(?) = CONNECTION_ID()")).WithArgs("mysql-lock").WillReturnRows(sqlmock.NewRows([]string{"held"}).AddRow(1))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `locks` SET `expiresAt` = ? WHERE `name` = ? AND `owner` = ? AND `fencingToken` = ?")).
+			WithArgs(sqlmock.AnyArg(), "mysql-lock", locker.GetOwner(), int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		assert.Nil(t, lock.Renew(ctx, time.Minute))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `locks` SET `expiresAt` = ?")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT RELEASE_LOCK(?)")).WithArgs("mysql-lock").WillReturnRows(sqlmock.NewRows([]string{"released"}).AddRow(1))
+		assert.Nil(t, lock.Release(ctx))
+		assert.Equal(t, ErrLockLost, lock.Renew(ctx, time.Minute))
+	})
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestLeaderElection(t *testing.T) {
+	var elected, demoted int32
+	newElection := func() *LeaderElection {
+		return &LeaderElection{Locker: getTestLocker(t), Name: "leader-test", TTL: time.Minute, RenewInterval: 5 * time.Millisecond,
+			OnElected: func(ctx context.Context, fencingToken int64) {
+				atomic.AddInt32(&elected, 1)
+				// leads until demoted, which must not hold up renewals
+				<-ctx.Done()
+			},
+			OnDemoted: func() { atomic.AddInt32(&demoted, 1) }}
+	}
+	assert.Equal(t, ErrInvalidLockName, (&LeaderElection{Locker: getTestLocker(t)}).Start())
+	leader := newElection()
+	follower := newElection()
+	assert.Nil(t, leader.Start())
+	assert.Nil(t, follower.Start())
+	assert.True(t, leader.IsLeader())
+	assert.False(t, follower.IsLeader())
+	assert.Equal(t, int64(0), follower.GetFencingToken())
+	token := leader.GetFencingToken()
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, leader.IsLeader())
+	assert.Nil(t, leader.Stop(context.Background()))
+	assert.False(t, leader.IsLeader())
+	assert.Eventually(t, follower.IsLeader, time.Second, 5*time.Millisecond)
+	assert.Equal(t, token+1, follower.GetFencingToken())
+	assert.Nil(t, follower.Stop(context.Background()))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&elected) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&demoted))
+}
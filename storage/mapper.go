@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dbTagName   = "db"
+	dbTagIgnore = "-"
+)
+
+var (
+	// ErrInvalidMappingTarget is returned when the destination of struct mapping is not a pointer to struct or pointer to slice of structs
+	ErrInvalidMappingTarget = errors.New("mapping target must be a non-nil pointer to a struct or to a slice of structs")
+	// ErrUnmappedColumn is returned when a column in the result set has no corresponding struct field
+	ErrUnmappedColumn = errors.New("no struct field mapped to column")
+	structMappings    sync.Map
+	scannerType       = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// structMapping holds column name to field index path mapping for a struct type
+type structMapping struct {
+	columns []string
+	fields  map[string][]int
+}
+
+// UnmappedColumnError is returned when the result set contains a column that no struct field maps to
+type UnmappedColumnError struct {
+	Column string
+	Type   reflect.Type
+}
+
+func (e *UnmappedColumnError) Error() string {
+	return ErrUnmappedColumn.Error() + " `" + e.Column + "` in " + e.Type.String()
+}
+
+// Is allows errors.Is(err, ErrUnmappedColumn) to match
+func (e *UnmappedColumnError) Is(target error) bool {
+	return target == ErrUnmappedColumn
+}
+
+func getStructMapping(structType reflect.Type) *structMapping {
+	if cached, ok := structMappings.Load(structType); ok {
+		return cached.(*structMapping)
+	}
+	mapping := &structMapping{fields: make(map[string][]int)}
+	collectStructFields(structType, nil, mapping)
+	cached, _ := structMappings.LoadOrStore(structType, mapping)
+	return cached.(*structMapping)
+}
+
+// collectStructFields walks exported fields, recursing into embedded structs such as data.BasePaginateable; outer fields win over embedded ones
+func collectStructFields(structType reflect.Type, parentIndex []int, mapping *structMapping) {
+	embedded := make([]reflect.StructField, 0)
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		tag, hasTag := field.Tag.Lookup(dbTagName)
+		if tag == dbTagIgnore || (len(field.PkgPath) > 0 && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && !hasTag && field.Type.Kind() == reflect.Struct && !isScannable(field.Type) {
+			embedded = append(embedded, field)
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		column := tag
+		if len(column) <= 0 {
+			column = field.Name
+		}
+		key := strings.ToLower(column)
+		if _, exists := mapping.fields[key]; exists {
+			continue
+		}
+		fieldIndex := append(append(make([]int, 0, len(parentIndex)+1), parentIndex...), index)
+		mapping.fields[key] = fieldIndex
+		mapping.columns = append(mapping.columns, column)
+	}
+	for _, field := range embedded {
+		collectStructFields(field.Type, append(append(make([]int, 0, len(parentIndex)+1), parentIndex...), field.Index[0]), mapping)
+	}
+}
+
+// isScannable checks whether the type is a column value itself, e.g. time.Time or sql.NullString, rather than a struct to be flattened
+func isScannable(fieldType reflect.Type) bool {
+	return reflect.PtrTo(fieldType).Implements(scannerType) || fieldType == timeType
+}
+
+func getStructValue(model interface{}) (reflect.Value, error) {
+	value := reflect.ValueOf(model)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, ErrInvalidMappingTarget
+	}
+	return value.Elem(), nil
+}
+
+// GetColumnNames returns the columns mapped by a struct (or pointer to struct) including the ones from embedded structs
+func GetColumnNames(model interface{}) ([]string, error) {
+	modelType := reflect.TypeOf(model)
+	if modelType != nil && modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+	if modelType == nil || modelType.Kind() != reflect.Struct {
+		return nil, ErrInvalidMappingTarget
+	}
+	mapping := getStructMapping(modelType)
+	columns := make([]string, len(mapping.columns))
+	copy(columns, mapping.columns)
+	return columns, nil
+}
+
+// GetFieldPointers returns pointers to fields of model mapped to the columns in the same order, to be used as scan or query args
+func GetFieldPointers(model interface{}, columns ...string) ([]interface{}, error) {
+	value, err := getStructValue(model)
+	if err != nil {
+		return nil, err
+	}
+	return getFieldPointers(value, getStructMapping(value.Type()), columns)
+}
+
+// GetFieldValues is same as GetFieldPointers but returns the values of the fields, to be used as args of write queries
+func GetFieldValues(model interface{}, columns ...string) ([]interface{}, error) {
+	pointers, err := GetFieldPointers(model, columns...)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(pointers))
+	for index, pointer := range pointers {
+		values[index] = reflect.ValueOf(pointer).Elem().Interface()
+	}
+	return values, nil
+}
+
+func getFieldPointers(value reflect.Value, mapping *structMapping, columns []string) ([]interface{}, error) {
+	pointers := make([]interface{}, len(columns))
+	for index, column := range columns {
+		fieldIndex, ok := mapping.fields[strings.ToLower(column)]
+		if !ok {
+			return nil, &UnmappedColumnError{Column: column, Type: value.Type()}
+		}
+		pointers[index] = value.FieldByIndex(fieldIndex).Addr().Interface()
+	}
+	return pointers, nil
+}
+
+var (
+	// QuerySingleRowIntoStruct reads a single row into the struct pointed to by dest, mapping columns using `db` tags; ErrNotFound, as well as
+	// sql.ErrNoRows, is matched if none
+	QuerySingleRowIntoStruct = func(db *sql.DB, query string, queryArgs func() []interface{}, dest interface{}) error {
+		return ClassifyError(querySingleRowIntoStruct(db, query, queryArgs, dest))
+	}
+
+	// QueryRowsIntoStructs reads all rows appending them to the slice pointed by dest; the slice element can either be a struct or a pointer to struct
+	QueryRowsIntoStructs = func(db *sql.DB, query string, queryArgs func() []interface{}, dest interface{}) error {
+		return ClassifyError(queryRowsIntoStructs(db, query, queryArgs, dest))
+	}
+)
+
+func querySingleRowIntoStruct(db *sql.DB, query string, queryArgs func() []interface{}, dest interface{}) error {
+	value, err := getStructValue(dest)
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(query, queryArgs()...)
+	if err != nil {
+		return err
+	}
+	defer func() { rows.Close() }()
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	pointers, err := getFieldPointers(value, getStructMapping(value.Type()), columns)
+	if err != nil {
+		return err
+	}
+	return rows.Scan(pointers...)
+}
+
+func queryRowsIntoStructs(db *sql.DB, query string, queryArgs func() []interface{}, dest interface{}) error {
+	sliceValue := reflect.ValueOf(dest)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.IsNil() || sliceValue.Elem().Kind() != reflect.Slice {
+		return ErrInvalidMappingTarget
+	}
+	sliceValue = sliceValue.Elem()
+	elemType := sliceValue.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtr {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return ErrInvalidMappingTarget
+	}
+	mapping := getStructMapping(structType)
+	rows, err := db.Query(query, queryArgs()...)
+	if err != nil {
+		return err
+	}
+	defer func() { rows.Close() }()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		element := reflect.New(structType)
+		pointers, err := getFieldPointers(element.Elem(), mapping, columns)
+		if err != nil {
+			return err
+		}
+		if err = rows.Scan(pointers...); err != nil {
+			return err
+		}
+		if isPtr {
+			sliceValue.Set(reflect.Append(sliceValue, element))
+		} else {
+			sliceValue.Set(reflect.Append(sliceValue, element.Elem()))
+		}
+	}
+	return rows.Err()
+}
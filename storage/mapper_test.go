@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/imyousuf/appcommons/data"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	mapperInsertQuery = "INSERT INTO mapper_test (id, name, note, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?)"
+	mapperSelectQuery = "SELECT id, name, note, createdAt, updatedAt FROM mapper_test"
+)
+
+type mapperTestModel struct {
+	data.BasePaginateable
+	Name     string         `db:"name"`
+	Note     sql.NullString `db:"note"`
+	Ignored  string         `db:"-"`
+	internal string
+}
+
+func TestGetColumnNames(t *testing.T) {
+	t.Run("EmbeddedBasePaginateable", func(t *testing.T) {
+		t.Parallel()
+		columns, err := GetColumnNames(&mapperTestModel{})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"name", "note", "id", "createdAt", "updatedAt"}, columns)
+	})
+	t.Run("InvalidTarget", func(t *testing.T) {
+		t.Parallel()
+		_, err := GetColumnNames("string")
+		assert.Equal(t, ErrInvalidMappingTarget, err)
+		_, err = GetFieldPointers(mapperTestModel{}, "id")
+		assert.Equal(t, ErrInvalidMappingTarget, err)
+	})
+	t.Run("UnmappedColumn", func(t *testing.T) {
+		t.Parallel()
+		_, err := GetFieldPointers(&mapperTestModel{}, "id", "missing")
+		assert.True(t, errors.Is(err, ErrUnmappedColumn))
+		assert.Contains(t, err.Error(), "missing")
+	})
+	t.Run("FieldValues", func(t *testing.T) {
+		t.Parallel()
+		model := &mapperTestModel{Name: "value"}
+		model.QuickFix()
+		values, err := GetFieldValues(model, "ID", "name")
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{model.ID, "value"}, values)
+	})
+}
+
+func TestQueryIntoStructs(t *testing.T) {
+	count := 5
+	models := make([]*mapperTestModel, 0, count)
+	ops := make([]func(*sql.Tx) error, 0, count)
+	for index := 0; index < count; index++ {
+		model := &mapperTestModel{Name: strconv.Itoa(index)}
+		model.QuickFix()
+		if index%2 == 0 {
+			model.Note = sql.NullString{String: "note " + model.Name, Valid: true}
+		}
+		args, err := GetFieldValues(model, "id", "name", "note", "createdAt", "updatedAt")
+		assert.Nil(t, err)
+		ops = append(ops, GetTxWrapperForSingleWriteQuery(EmptyOps, mapperInsertQuery, Args2SliceFnWrapper(args...)))
+		models = append(models, model)
+	}
+	assert.Nil(t, ExecuteMultipleWriteOpsInTransaction(testDB, ops...))
+	t.Run("SingleRow", func(t *testing.T) {
+		t.Parallel()
+		model := &mapperTestModel{}
+		err := QuerySingleRowIntoStruct(testDB, mapperSelectQuery+" WHERE id = ?", Args2SliceFnWrapper(models[0].ID), model)
+		assert.Nil(t, err)
+		assert.Equal(t, models[0].ID, model.ID)
+		assert.Equal(t, models[0].Name, model.Name)
+		assert.Equal(t, models[0].Note, model.Note)
+		assert.True(t, models[0].CreatedAt.Equal(model.CreatedAt))
+		assert.True(t, models[0].UpdatedAt.Equal(model.UpdatedAt))
+	})
+	t.Run("SingleRowNotFound", func(t *testing.T) {
+		t.Parallel()
+		err := QuerySingleRowIntoStruct(testDB, mapperSelectQuery+" WHERE id = ?", Args2SliceFnWrapper("none"), &mapperTestModel{})
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+	t.Run("RowsOfStructs", func(t *testing.T) {
+		t.Parallel()
+		var results []mapperTestModel
+		err := QueryRowsIntoStructs(testDB, mapperSelectQuery+" ORDER BY id ASC", NilArgs, &results)
+		assert.Nil(t, err)
+		assert.Equal(t, count, len(results))
+		for index, result := range results {
+			assert.Equal(t, models[index].ID, result.ID)
+			assert.Equal(t, models[index].Note.Valid, result.Note.Valid)
+		}
+	})
+	t.Run("RowsOfPointersWithPagination", func(t *testing.T) {
+		t.Parallel()
+		var results []*mapperTestModel
+		page := &data.Pagination{}
+		err := QueryRowsIntoStructs(testDB, mapperSelectQuery+GetPaginationQueryFragment(page, false), Args2SliceFnWrapper(GetPaginationTimestampQueryArgs(page)...), &results)
+		assert.Nil(t, err)
+		assert.Equal(t, count, len(results))
+		assert.Equal(t, models[count-1].ID, results[0].ID)
+	})
+	t.Run("UnmappedColumn", func(t *testing.T) {
+		t.Parallel()
+		var results []mapperTestModel
+		err := QueryRowsIntoStructs(testDB, "SELECT id, 1 AS extra FROM mapper_test", NilArgs, &results)
+		assert.True(t, errors.Is(err, ErrUnmappedColumn))
+	})
+	t.Run("InvalidTarget", func(t *testing.T) {
+		t.Parallel()
+		var results []string
+		assert.Equal(t, ErrInvalidMappingTarget, QueryRowsIntoStructs(testDB, mapperSelectQuery, NilArgs, &results))
+		assert.Equal(t, ErrInvalidMappingTarget, QueryRowsIntoStructs(testDB, mapperSelectQuery, NilArgs, results))
+		assert.Equal(t, ErrInvalidMappingTarget, QuerySingleRowIntoStruct(testDB, mapperSelectQuery, NilArgs, nil))
+	})
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMigrationTimeout bounds how long startup waits for the migration lock or for another instance to finish migrating
+	DefaultMigrationTimeout = 5 * time.Minute
+	// MigrationLockTable holds the migration lock; it is created outside of the migrations as it guards them
+	MigrationLockTable = "schema_migrations_lock"
+	migrationLockName  = "schema_migrations"
+	migrationLockTTL   = 30 * time.Second
+
+	// MigrationPending is the state before migration is attempted
+	MigrationPending = dbcore.MigrationPending
+	// MigrationWaiting is the state while another instance holds the migration lock
+	MigrationWaiting = dbcore.MigrationWaiting
+	// MigrationRunning is the state while this instance applies migrations
+	MigrationRunning = dbcore.MigrationRunning
+	// MigrationComplete is the state once the schema is at the latest version of the migration source or migration is disabled
+	MigrationComplete = dbcore.MigrationComplete
+	// MigrationFailed is the state if migration failed or timed out
+	MigrationFailed = dbcore.MigrationFailed
+)
+
+var (
+	// ErrMigrationTimeout is returned when neither the migration lock was acquired nor the schema reached the expected version in time
+	ErrMigrationTimeout = errors.New("timed out waiting for migrations")
+	// MigrationPollInterval is how often an instance waiting for migrations retries the lock and checks the schema version
+	MigrationPollInterval = time.Second
+)
+
+// MigrationState represents the progress of the startup migration, for readiness checks
+type MigrationState = dbcore.MigrationState
+
+func setMigrationState(state MigrationState, err error) {
+	dbcore.SetMigrationState(state, err)
+}
+
+// GetMigrationState returns the state of the startup migration
+func GetMigrationState() MigrationState {
+	return dbcore.GetMigrationState()
+}
+
+// WaitForMigrations blocks until the startup migration completes or fails, returning the failure, or ctx is done
+func WaitForMigrations(ctx context.Context) error {
+	ticker := time.NewTicker(MigrationPollInterval)
+	defer ticker.Stop()
+	for {
+		state, err := dbcore.GetMigrationStatus()
+		switch state {
+		case MigrationComplete:
+			return nil
+		case MigrationFailed:
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// coordinateMigration applies the migrations while holding the migration lock so that only one instance migrates at a time. Instances
+// that do not get the lock wait until the schema reaches the latest version of the migration source, or the lock is free, instead of
+// racing or failing on the dirty state of an in-progress migration. With seeds configured they wait for the lock, as the schema version
+// does not tell whether the seeds were applied.
+func coordinateMigration(db *sql.DB, dbConfig config.RelationalDatabaseConfig, migrationConf *MigrationConfig) error {
+	driver, err := getMigrationDriver(db, dbConfig)
+	if err != nil {
+		return err
+	}
+	migration, err := getMigration(migrationConf.MigrationSource, string(dbConfig.GetDBDialect()), driver)
+	if err != nil {
+		return err
+	}
+	locker, err := getMigrationLocker(db, dbConfig.GetDBDialect())
+	if err != nil {
+		return err
+	}
+	expectedVersion, hasMigrations, err := getLatestMigrationVersion(migrationConf.MigrationSource)
+	if err != nil {
+		return err
+	}
+	timeout := migrationConf.Timeout
+	if timeout <= 0 {
+		timeout = DefaultMigrationTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		lock, err := locker.TryAcquire(ctx, migrationLockName, migrationLockTTL)
+		if err == nil {
+			return applyMigrations(db, dbConfig, migrationConf, migration, lock)
+		}
+		if ctx.Err() != nil {
+			return ErrMigrationTimeout
+		}
+		if err != ErrLockNotAcquired {
+			return err
+		}
+		setMigrationState(MigrationWaiting, nil)
+		version, dirty, versionErr := migration.Version()
+		if len(migrationConf.SeedDir) == 0 && (!hasMigrations || (versionErr == nil && !dirty && version >= expectedVersion)) {
+			log.Info().Uint("version", version).Msg("migrated by another instance")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ErrMigrationTimeout
+		case <-time.After(MigrationPollInterval):
+		}
+	}
+}
+
+func applyMigrations(db *sql.DB, dbConfig config.RelationalDatabaseConfig, migrationConf *MigrationConfig, migration *migrate.Migrate,
+	lock *Lock) error {
+	setMigrationState(MigrationRunning, nil)
+	var renewer periodicWorker
+	renewer.start(migrationLockTTL/3, func(ctx context.Context) {
+		if err := lock.Renew(ctx, migrationLockTTL); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("could not renew migration lock")
+		}
+	})
+	defer func() {
+		renewer.stop()
+		if err := lock.Release(context.Background()); err != nil {
+			log.Error().Err(err).Msg("could not release migration lock")
+		}
+	}()
+	if len(migrationConf.BackupDir) > 0 && dbConfig.GetDBDialect() == config.SQLite3Dialect {
+		if err := backupBeforeMigration(db, migration, migrationConf.MigrationSource, migrationConf.BackupDir); err != nil {
+			return err
+		}
+	}
+	err := migration.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	if len(migrationConf.SeedDir) > 0 {
+		_, err = ApplySeeds(db, dbConfig.GetDBDialect(), migrationConf.SeedDir)
+		return err
+	}
+	return nil
+}
+
+func getMigrationLocker(db *sql.DB, dialect config.DBDialect) (*Locker, error) {
+	up, _, err := GetLockTableMigration(dialect, MigrationLockTable)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(up); err != nil {
+		return nil, err
+	}
+	return NewLocker(db, dialect, MigrationLockTable)
+}
+
+func getLatestMigrationVersion(migrationSource string) (version uint, ok bool, err error) {
+	sourceDriver, err := source.Open(migrationSource)
+	if err != nil {
+		return 0, false, err
+	}
+	defer sourceDriver.Close()
+	version, err = sourceDriver.First()
+	for err == nil {
+		ok = true
+		var next uint
+		if next, err = sourceDriver.Next(version); err == nil {
+			version = next
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return version, ok, err
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func getMigrationTestPool(t *testing.T, dbConfig *config.Config) *sql.DB {
+	db, err := CreateDBConnectionPool(dbConfig)
+	assert.Nil(t, err)
+	return db
+}
+
+func getSchemaVersion(t *testing.T, db *sql.DB) uint {
+	var version uint
+	assert.Nil(t, db.QueryRow("SELECT version FROM schema_migrations").Scan(&version))
+	return version
+}
+
+func TestCoordinatedMigration(t *testing.T) {
+	pollInterval := MigrationPollInterval
+	MigrationPollInterval = 10 * time.Millisecond
+	defer func() { MigrationPollInterval = pollInterval }()
+	expectedVersion, ok, err := getLatestMigrationVersion(defaultMigrationConf.MigrationSource)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint(11), expectedVersion)
+	t.Run("ConcurrentInstances", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "coordinated")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "concurrent.sqlite3"),
+			SQLiteBusyTimeout: 5 * time.Second}
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for index := range errs {
+			db := getMigrationTestPool(t, dbConfig)
+			defer db.Close()
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				errs[index] = runMigration(db, dbConfig, defaultMigrationConf)
+			}(index)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			assert.Nil(t, err)
+		}
+		db := getMigrationTestPool(t, dbConfig)
+		defer db.Close()
+		assert.Equal(t, expectedVersion, getSchemaVersion(t, db))
+		assert.Equal(t, MigrationComplete, GetMigrationState())
+		assert.Nil(t, WaitForMigrations(context.Background()))
+	})
+	t.Run("WaitForAnotherInstance", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "coordinated")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "wait.sqlite3")}
+		leaderDB := getMigrationTestPool(t, dbConfig)
+		defer leaderDB.Close()
+		locker, err := getMigrationLocker(leaderDB, config.SQLite3Dialect)
+		assert.Nil(t, err)
+		lock, err := locker.TryAcquire(context.Background(), migrationLockName, time.Minute)
+		assert.Nil(t, err)
+		followerDB := getMigrationTestPool(t, dbConfig)
+		defer followerDB.Close()
+		done := make(chan error, 1)
+		go func() {
+			done <- runMigration(followerDB, dbConfig, defaultMigrationConf)
+		}()
+		assert.Eventually(t, func() bool { return GetMigrationState() == MigrationWaiting }, time.Second, time.Millisecond)
+		waitCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		assert.Equal(t, context.DeadlineExceeded, WaitForMigrations(waitCtx))
+		cancel()
+		driver, err := getMigrationDriver(leaderDB, dbConfig)
+		assert.Nil(t, err)
+		migration, err := getMigration(defaultMigrationConf.MigrationSource, string(config.SQLite3Dialect), driver)
+		assert.Nil(t, err)
+		assert.Nil(t, migration.Up())
+		assert.Nil(t, <-done)
+		assert.Equal(t, MigrationComplete, GetMigrationState())
+		// the follower returned without taking over the lock
+		assert.Nil(t, lock.Renew(context.Background(), time.Minute))
+		assert.Nil(t, lock.Release(context.Background()))
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "coordinated")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "timeout.sqlite3")}
+		db := getMigrationTestPool(t, dbConfig)
+		defer db.Close()
+		locker, err := getMigrationLocker(db, config.SQLite3Dialect)
+		assert.Nil(t, err)
+		_, err = locker.TryAcquire(context.Background(), migrationLockName, time.Minute)
+		assert.Nil(t, err)
+		migrationConf := &MigrationConfig{MigrationEnabled: true, MigrationSource: defaultMigrationConf.MigrationSource,
+			Timeout: 50 * time.Millisecond}
+		assert.Equal(t, ErrMigrationTimeout, runMigration(db, dbConfig, migrationConf))
+		assert.Equal(t, MigrationFailed, GetMigrationState())
+		assert.Equal(t, ErrMigrationTimeout, WaitForMigrations(context.Background()))
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, runMigration(testDB, &config.Config{DBDialect: config.SQLite3Dialect}, &MigrationConfig{}))
+		assert.Equal(t, MigrationComplete, GetMigrationState())
+	})
+}
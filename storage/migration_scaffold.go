@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sequentialMigrationDigits = 6
+	timestampMigrationFormat  = "20060102150405"
+	fileMigrationSourcePrefix = "file://"
+	// minTimestampMigrationVersion is the smallest version with as many digits as timestampMigrationFormat; gaps are expected
+	// between timestamp versions
+	minTimestampMigrationVersion = 10000000000000
+)
+
+var (
+	// ErrInvalidMigrationName is returned when the name of a new migration is not lower case alphanumerics and underscores
+	ErrInvalidMigrationName = errors.New("migration name must be lower case alphanumerics and underscores")
+	// ErrMixedMigrationVersions is returned when creating a migration whose version scheme, sequential or timestamp, differs from that
+	// of the existing migrations
+	ErrMixedMigrationVersions = errors.New("sequential and timestamp migration versions cannot be mixed")
+	// ErrMigrationLintFailed is returned by the migration CLI mode when lint finds issues
+	ErrMigrationLintFailed = errors.New("migration lint failed")
+
+	migrationNamePattern = regexp.MustCompile("^[a-z0-9_]+$")
+	migrationFilePattern = regexp.MustCompile("^([0-9]+)_(.*)\\.(up|down)\\.sql$")
+	sqlCommentPattern    = regexp.MustCompile("(?m)--.*$")
+)
+
+// MigrationLintIssue represents a problem with the files in a migration directory
+type MigrationLintIssue struct {
+	Version uint64
+	Issue   string
+}
+
+func (issue MigrationLintIssue) String() string {
+	return fmt.Sprintf("%d: %s", issue.Version, issue.Issue)
+}
+
+type migrationFiles struct {
+	names []string
+	up    []string
+	down  []string
+}
+
+// GetMigrationDir returns the directory of a `file://` migration source
+func GetMigrationDir(migrationSource string) string {
+	return strings.TrimPrefix(migrationSource, fileMigrationSourcePrefix)
+}
+
+// CreateMigrationFiles creates an up and down migration pair for name in dir; the version is the next one in sequence or, if
+// timestamped, the current UTC time. ErrMixedMigrationVersions is returned if dir already has versions of the other scheme, as a
+// sequential version sorts below the timestamp versions and would never be applied to a DB migrated past them.
+func CreateMigrationFiles(dir, name string, timestamped bool) (upPath, downPath string, err error) {
+	if !migrationNamePattern.MatchString(name) {
+		return "", "", ErrInvalidMigrationName
+	}
+	migrations, err := readMigrationFiles(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var latest uint64
+	for existing := range migrations {
+		if (existing >= minTimestampMigrationVersion) != timestamped {
+			return "", "", ErrMixedMigrationVersions
+		}
+		if existing > latest {
+			latest = existing
+		}
+	}
+	version := fmt.Sprintf("%0*d", sequentialMigrationDigits, latest+1)
+	if timestamped {
+		version = time.Now().UTC().Format(timestampMigrationFormat)
+	}
+	upPath = filepath.Join(dir, version+"_"+name+".up.sql")
+	downPath = filepath.Join(dir, version+"_"+name+".down.sql")
+	for index, path := range []string{upPath, downPath} {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			if index > 0 {
+				os.Remove(upPath)
+			}
+			return "", "", err
+		}
+		file.Close()
+	}
+	return upPath, downPath, nil
+}
+
+// LintMigrations checks the migrations in dir for duplicate versions, missing or statement-less up and down files, gaps in the
+// sequence of non timestamp versions and a mix of sequential and timestamp versions
+func LintMigrations(dir string) ([]MigrationLintIssue, error) {
+	migrations, err := readMigrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]uint64, 0, len(migrations))
+	for version := range migrations {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	issues := make([]MigrationLintIssue, 0)
+	addIssue := func(version uint64, format string, args ...interface{}) {
+		issues = append(issues, MigrationLintIssue{Version: version, Issue: fmt.Sprintf(format, args...)})
+	}
+	var previousSequential uint64
+	for _, version := range versions {
+		files := migrations[version]
+		if len(files.names) > 1 {
+			addIssue(version, "duplicate version for %s", strings.Join(files.names, ", "))
+		}
+		for index, paths := range [][]string{files.up, files.down} {
+			if len(paths) == 0 {
+				direction := "up"
+				if index > 0 {
+					direction = "down"
+				}
+				addIssue(version, "missing %s file", direction)
+				continue
+			}
+			for _, path := range paths {
+				hasStatements, err := hasSQLStatements(path)
+				if err != nil {
+					return nil, err
+				}
+				if !hasStatements {
+					addIssue(version, "%s has no statements", filepath.Base(path))
+				}
+			}
+		}
+		if version < minTimestampMigrationVersion {
+			if version != previousSequential+1 {
+				addIssue(version, "gap in sequence, expected version %d", previousSequential+1)
+			}
+			previousSequential = version
+		} else if previousSequential > 0 {
+			addIssue(version, "timestamp version mixed with sequential versions")
+		}
+	}
+	return issues, nil
+}
+
+func readMigrationFiles(dir string) (map[uint64]*migrationFiles, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	migrations := make(map[uint64]*migrationFiles)
+	for _, entry := range entries {
+		matches := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		files, ok := migrations[version]
+		if !ok {
+			files = &migrationFiles{}
+			migrations[version] = files
+		}
+		name := matches[1] + "_" + matches[2]
+		if len(files.names) == 0 || files.names[len(files.names)-1] != name {
+			files.names = append(files.names, name)
+		}
+		path := filepath.Join(dir, entry.Name())
+		if matches[3] == "up" {
+			files.up = append(files.up, path)
+		} else {
+			files.down = append(files.down, path)
+		}
+	}
+	return migrations, nil
+}
+
+func hasSQLStatements(path string) (bool, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	withoutComments := sqlCommentPattern.ReplaceAllString(string(content), "")
+	return len(strings.Trim(withoutComments, " \t\r\n;")) > 0, nil
+}
+
+// ExecuteMigrationScaffoldCLIMode creates the migration requested with the `-new-migration` CLI flag or lints the migrations when
+// requested with the `-lint-migrations` CLI flag; ran is false if neither was requested, else the application is expected to exit
+// after it. ErrMigrationLintFailed is returned if lint finds issues.
+func ExecuteMigrationScaffoldCLIMode(cliConfig *config.CLIConfig) (ran bool, err error) {
+	if !cliConfig.IsNewMigrationMode() && !cliConfig.LintMigrations {
+		return false, nil
+	}
+	dir := GetMigrationDir(cliConfig.MigrationSource)
+	if cliConfig.IsNewMigrationMode() {
+		upPath, downPath, err := CreateMigrationFiles(dir, cliConfig.NewMigrationName, cliConfig.TimestampMigration)
+		if err != nil {
+			return true, err
+		}
+		log.Info().Str("up", upPath).Str("down", downPath).Msg("migration created")
+	}
+	if cliConfig.LintMigrations {
+		issues, err := LintMigrations(dir)
+		if err != nil {
+			return true, err
+		}
+		for _, issue := range issues {
+			log.Warn().Uint64("version", issue.Version).Msg(issue.Issue)
+		}
+		if len(issues) > 0 {
+			return true, ErrMigrationLintFailed
+		}
+	}
+	return true, nil
+}
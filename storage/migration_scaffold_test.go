@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeMigrationFile(t *testing.T, dir, name, content string) {
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestCreateMigrationFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	upPath, downPath, err := CreateMigrationFiles(dir, "create_users", false)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "000001_create_users.up.sql"), upPath)
+	assert.Equal(t, filepath.Join(dir, "000001_create_users.down.sql"), downPath)
+	writeMigrationFile(t, dir, "000007_add_index.up.sql", "CREATE INDEX i ON users (name);")
+	upPath, _, err = CreateMigrationFiles(dir, "add_email", false)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "000008_add_email.up.sql"), upPath)
+	_, _, err = CreateMigrationFiles(dir, "add_phone", true)
+	assert.Equal(t, ErrMixedMigrationVersions, err)
+	timestampDir, err := ioutil.TempDir("", "scaffold-timestamp")
+	assert.Nil(t, err)
+	defer os.RemoveAll(timestampDir)
+	upPath, _, err = CreateMigrationFiles(timestampDir, "add_phone", true)
+	assert.Nil(t, err)
+	assert.Regexp(t, "^[0-9]{14}_add_phone\\.up\\.sql$", filepath.Base(upPath))
+	_, _, err = CreateMigrationFiles(timestampDir, "add_address", false)
+	assert.Equal(t, ErrMixedMigrationVersions, err)
+	_, _, err = CreateMigrationFiles(dir, "Add Phone", false)
+	assert.Equal(t, ErrInvalidMigrationName, err)
+	_, _, err = CreateMigrationFiles(filepath.Join(dir, "missing"), "add_phone", false)
+	assert.NotNil(t, err)
+}
+
+func TestLintMigrations(t *testing.T) {
+	t.Run("TestMigrations", func(t *testing.T) {
+		issues, err := LintMigrations(GetMigrationDir(defaultMigrationConf.MigrationSource))
+		assert.Nil(t, err)
+		assert.Empty(t, issues)
+	})
+	t.Run("Issues", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "lint")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		writeMigrationFile(t, dir, "000001_create_users.up.sql", "CREATE TABLE users (id INT);")
+		writeMigrationFile(t, dir, "000001_create_users.down.sql", "-- nothing to undo\n;\n")
+		writeMigrationFile(t, dir, "000002_create_orders.up.sql", "CREATE TABLE orders (id INT);")
+		writeMigrationFile(t, dir, "000002_create_orders.down.sql", "DROP TABLE orders;")
+		writeMigrationFile(t, dir, "000002_create_items.up.sql", "CREATE TABLE items (id INT);")
+		writeMigrationFile(t, dir, "000004_add_index.up.sql", "CREATE INDEX i ON users (id);")
+		writeMigrationFile(t, dir, "20220328120000_add_column.up.sql", "ALTER TABLE users ADD name TEXT;")
+		writeMigrationFile(t, dir, "20220328120000_add_column.down.sql", "ALTER TABLE users DROP name;")
+		writeMigrationFile(t, dir, "README.md", "not a migration")
+		issues, err := LintMigrations(dir)
+		assert.Nil(t, err)
+		descriptions := make([]string, 0, len(issues))
+		for _, issue := range issues {
+			descriptions = append(descriptions, issue.String())
+		}
+		assert.Equal(t, []string{
+			"1: 000001_create_users.down.sql has no statements",
+			"2: duplicate version for 000002_create_items, 000002_create_orders",
+			"4: missing down file",
+			"4: gap in sequence, expected version 3",
+			"20220328120000: timestamp version mixed with sequential versions",
+		}, descriptions)
+	})
+}
+
+func TestExecuteMigrationScaffoldCLIMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold-cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ran, err := ExecuteMigrationScaffoldCLIMode(&config.CLIConfig{MigrationSource: "file://" + dir})
+	assert.False(t, ran)
+	assert.Nil(t, err)
+	ran, err = ExecuteMigrationScaffoldCLIMode(&config.CLIConfig{MigrationSource: "file://" + dir, NewMigrationName: "create_users"})
+	assert.True(t, ran)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "000001_create_users.down.sql"))
+	assert.Nil(t, err)
+	ran, err = ExecuteMigrationScaffoldCLIMode(&config.CLIConfig{MigrationSource: "file://" + dir, LintMigrations: true})
+	assert.True(t, ran)
+	assert.Equal(t, ErrMigrationLintFailed, err)
+	writeMigrationFile(t, dir, "000001_create_users.up.sql", "CREATE TABLE users (id INT);")
+	writeMigrationFile(t, dir, "000001_create_users.down.sql", "DROP TABLE users;")
+	ran, err = ExecuteMigrationScaffoldCLIMode(&config.CLIConfig{MigrationSource: "file://" + dir, LintMigrations: true})
+	assert.True(t, ran)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	estimateMySQLRowCountQuery   = "SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?"
+	estimateSQLite3RowCountQuery = "SELECT stat FROM sqlite_stat1 WHERE tbl = ? ORDER BY idx IS NOT NULL LIMIT 1"
+)
+
+var (
+	// ErrInvalidIdentifier is returned when a table or column name is not a plain SQL identifier
+	ErrInvalidIdentifier = errors.New("invalid SQL identifier")
+	// errNoEstimate is returned when table statistics are not available for estimating row count
+	errNoEstimate     = errors.New("row count estimate not available")
+	identifierPattern = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+	// GetOffsetPaginationQueryFragment generates the ORDER BY, LIMIT and OFFSET clause for page number based pagination
+	GetOffsetPaginationQueryFragment = func(page *data.OffsetPagination) string {
+		return " " + string(baseOrderByClause) + " LIMIT " + strconv.FormatUint(uint64(page.PerPage), 10) + " OFFSET " + strconv.FormatUint(page.Offset(), 10)
+	}
+
+	// CountRows executes a count query, e.g. `SELECT COUNT(*) FROM test WHERE ...`, and returns the count
+	CountRows = func(db *sql.DB, countQuery string, queryArgs func() []interface{}) (count int64, err error) {
+		err = QuerySingleRow(db, countQuery, queryArgs, Args2SliceFnWrapper(&count))
+		return count, err
+	}
+
+	// EstimateRowCount reads approximate row count of a table from the dialect's table statistics; for SQLite3 it requires ANALYZE to have been run
+	EstimateRowCount = func(db *sql.DB, dialect config.DBDialect, table string) (int64, error) {
+		if !isValidIdentifier(table) {
+			return 0, ErrInvalidIdentifier
+		}
+		switch dialect {
+		case config.MySQLDialect:
+			var count sql.NullInt64
+			err := QuerySingleRow(db, estimateMySQLRowCountQuery, Args2SliceFnWrapper(table), Args2SliceFnWrapper(&count))
+			if err == nil && !count.Valid {
+				err = errNoEstimate
+			}
+			return count.Int64, err
+		default:
+			var stat string
+			err := QuerySingleRow(db, estimateSQLite3RowCountQuery, Args2SliceFnWrapper(table), Args2SliceFnWrapper(&stat))
+			if err != nil {
+				return 0, err
+			}
+			fields := strings.Fields(stat)
+			if len(fields) < 1 {
+				return 0, errNoEstimate
+			}
+			return strconv.ParseInt(fields[0], 10, 64)
+		}
+	}
+
+	// PopulateOffsetPaginationTotal sets the total count on the page as per its CountMode. Estimated count falls back to exact count
+	// when table statistics are not available.
+	PopulateOffsetPaginationTotal = func(db *sql.DB, dialect config.DBDialect, page *data.OffsetPagination, table string, countQuery string, queryArgs func() []interface{}) error {
+		switch page.CountMode {
+		case data.EstimatedCount:
+			count, err := EstimateRowCount(db, dialect, table)
+			if err == nil {
+				page.SetTotalCount(count, true)
+				return nil
+			}
+			log.Debug().Err(err).Str("table", table).Msg("falling back to exact count")
+			fallthrough
+		case data.ExactCount:
+			count, err := CountRows(db, countQuery, queryArgs)
+			if err == nil {
+				page.SetTotalCount(count, false)
+			}
+			return err
+		default:
+			return nil
+		}
+	}
+)
+
+func isValidIdentifier(name string) bool {
+	return identifierPattern.MatchString(name)
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"database/sql"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	countQuery        = "SELECT COUNT(*) FROM offset_test"
+	offsetInsertQuery = "INSERT INTO offset_test (id, name, note, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?)"
+)
+
+func TestGetOffsetPaginationQueryFragment(t *testing.T) {
+	assert.Equal(t, " ORDER BY createdAt desc, id desc LIMIT 25 OFFSET 0", GetOffsetPaginationQueryFragment(data.NewOffsetPagination(1, 0)))
+	assert.Equal(t, " ORDER BY createdAt desc, id desc LIMIT 10 OFFSET 60", GetOffsetPaginationQueryFragment(data.NewOffsetPagination(7, 10)))
+}
+
+func TestOffsetPaginationRead(t *testing.T) {
+	ops := make([]func(*sql.Tx) error, 0, 30)
+	for index := 0; index < 30; index++ {
+		p := &data.BasePaginateable{}
+		p.QuickFix()
+		ops = append(ops, GetTxWrapperForSingleWriteQuery(EmptyOps, offsetInsertQuery, Args2SliceFnWrapper(p.ID, strconv.Itoa(index), strconv.Itoa(index), p.CreatedAt, p.UpdatedAt)))
+	}
+	assert.Nil(t, ExecuteMultipleWriteOpsInTransaction(testDB, ops...))
+	t.Run("Exact", func(t *testing.T) {
+		page := data.NewOffsetPagination(2, 10)
+		page.CountMode = data.ExactCount
+		err := PopulateOffsetPaginationTotal(testDB, config.SQLite3Dialect, page, "offset_test", countQuery, NilArgs)
+		assert.Nil(t, err)
+		assert.False(t, page.TotalIsEstimate)
+		assert.GreaterOrEqual(t, page.TotalCount, int64(30))
+		rowCount := 0
+		err = QueryRows(testDB, "SELECT id FROM offset_test"+GetOffsetPaginationQueryFragment(page), NilArgs, func() []interface{} {
+			rowCount++
+			var id string
+			return []interface{}{&id}
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 10, rowCount)
+	})
+	t.Run("Estimated", func(t *testing.T) {
+		_, err := testDB.Exec("ANALYZE")
+		assert.Nil(t, err)
+		page := data.NewOffsetPagination(1, 10)
+		page.CountMode = data.EstimatedCount
+		err = PopulateOffsetPaginationTotal(testDB, config.SQLite3Dialect, page, "offset_test", countQuery, NilArgs)
+		assert.Nil(t, err)
+		assert.True(t, page.TotalIsEstimate)
+		assert.Greater(t, page.TotalCount, int64(0))
+	})
+	t.Run("NoCount", func(t *testing.T) {
+		page := data.NewOffsetPagination(1, 10)
+		assert.Nil(t, PopulateOffsetPaginationTotal(testDB, config.SQLite3Dialect, page, "offset_test", countQuery, NilArgs))
+		assert.False(t, page.IsTotalKnown())
+	})
+}
+
+func TestEstimateRowCount(t *testing.T) {
+	t.Run("InvalidTable", func(t *testing.T) {
+		t.Parallel()
+		_, err := EstimateRowCount(testDB, config.SQLite3Dialect, "test; DROP TABLE test")
+		assert.Equal(t, ErrInvalidIdentifier, err)
+	})
+	t.Run("MySQL", func(t *testing.T) {
+		t.Parallel()
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery("SELECT TABLE_ROWS FROM information_schema.TABLES").WithArgs("test").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS"}).AddRow(420))
+		count, err := EstimateRowCount(db, config.MySQLDialect, "test")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(420), count)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("MySQLNull", func(t *testing.T) {
+		t.Parallel()
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery("SELECT TABLE_ROWS FROM information_schema.TABLES").WithArgs("test").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS"}).AddRow(nil))
+		_, err := EstimateRowCount(db, config.MySQLDialect, "test")
+		assert.Equal(t, errNoEstimate, err)
+	})
+}
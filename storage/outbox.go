@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultOutboxTable is the table name used by the outbox migration unless the application chooses another
+	DefaultOutboxTable       = "outbox"
+	maxOutboxLastErrorLength = 1024
+	outboxPendingFilter      = " WHERE `deliveredAt` IS NULL AND `nextAttemptAt` <= ?"
+)
+
+var (
+	// ErrNoOutboxPublisher is returned when the relay is started without a publisher
+	ErrNoOutboxPublisher = errors.New("outbox relay requires a publisher")
+	// DefaultOutboxPollInterval is used when the relay has no PollInterval
+	DefaultOutboxPollInterval = time.Second
+	// DefaultOutboxMinBackoff is the delay before the first retry of a failed publish
+	DefaultOutboxMinBackoff = time.Second
+	// DefaultOutboxMaxBackoff caps the exponentially growing retry delay
+	DefaultOutboxMaxBackoff = 10 * time.Minute
+)
+
+// GetOutboxTableMigration returns the up and down SQL of the outbox table for the application to add to its migration source; the up
+// migration has two statements, so MySQL connection URL needs multiStatements=true for migration
+func GetOutboxTableMigration(dialect config.DBDialect, table string) (up string, down string, err error) {
+	dateTimeType := getDateTimeType(dialect)
+	return getTableMigration(table, []string{
+		"`id` VARCHAR(255) NOT NULL PRIMARY KEY",
+		"`topic` VARCHAR(255) NOT NULL",
+		"`payload` BLOB NOT NULL",
+		"`attempts` INT NOT NULL DEFAULT 0",
+		"`lastError` VARCHAR(1024) NOT NULL DEFAULT ''",
+		"`nextAttemptAt` " + dateTimeType + " NOT NULL",
+		"`deliveredAt` " + dateTimeType + " NULL",
+		"`createdAt` " + dateTimeType + " NOT NULL",
+		"`updatedAt` " + dateTimeType + " NOT NULL",
+	}, tableIndex{suffix: "pending_idx", columns: []string{"deliveredAt", "nextAttemptAt"}})
+}
+
+// OutboxEvent represents a row of the outbox table
+type OutboxEvent struct {
+	data.BasePaginateable
+	Topic         string       `db:"topic"`
+	Payload       []byte       `db:"payload"`
+	Attempts      int          `db:"attempts"`
+	LastError     string       `db:"lastError"`
+	NextAttemptAt time.Time    `db:"nextAttemptAt"`
+	DeliveredAt   sql.NullTime `db:"deliveredAt"`
+}
+
+// IsInValidState returns false if the event has no topic
+func (event *OutboxEvent) IsInValidState() bool {
+	return len(event.Topic) > 0
+}
+
+// OutboxPublisher publishes a batch of events, in the order they were enqueued, to the external system. An error marks the whole
+// batch for retry, so publishing must be idempotent on the consumer side as delivery is at least once.
+type OutboxPublisher interface {
+	Publish(ctx context.Context, events []*OutboxEvent) error
+}
+
+// OutboxPublisherFunc allows a function to be used as an OutboxPublisher
+type OutboxPublisherFunc func(ctx context.Context, events []*OutboxEvent) error
+
+// Publish calls the function
+func (fn OutboxPublisherFunc) Publish(ctx context.Context, events []*OutboxEvent) error {
+	return fn(ctx, events)
+}
+
+// Outbox enqueues events into the outbox table as part of the application's transaction
+type Outbox struct {
+	db   *sql.DB
+	repo *Repository
+}
+
+// NewOutbox creates an outbox backed by the table created through GetOutboxTableMigration
+func NewOutbox(db *sql.DB, table string) (*Outbox, error) {
+	repo, err := NewRepository(db, table, &OutboxEvent{})
+	if err != nil {
+		return nil, err
+	}
+	return &Outbox{db: db, repo: repo}, nil
+}
+
+// EnqueueOp returns a transaction op that inserts the event; to be combined with the business writes in ExecuteMultipleWriteOpsInTransaction
+func (outbox *Outbox) EnqueueOp(topic string, payload []byte) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := outbox.Enqueue(tx, topic, payload)
+		return err
+	}
+}
+
+// Enqueue inserts the event within tx, e.g. the one passed to ExecuteOpsInTransaction callback, so it is only visible to the relay
+// once tx commits
+func (outbox *Outbox) Enqueue(tx *sql.Tx, topic string, payload []byte) (*OutboxEvent, error) {
+	event := &OutboxEvent{Topic: topic, Payload: payload}
+	if payload == nil {
+		event.Payload = []byte{}
+	}
+	event.QuickFix()
+	event.NextAttemptAt = outbox.repo.normalizeTimestamp(event.CreatedAt)
+	return event, outbox.repo.CreateOp(event)(tx)
+}
+
+// OutboxRelay polls the outbox for pending events oldest first, hands them to the publisher and marks them delivered, or schedules a
+// retry with exponential backoff if publishing fails. Events are published in enqueue order, but a retried event can be published after
+// newer ones; only one relay should run per outbox table.
+type OutboxRelay struct {
+	Outbox       *Outbox
+	Publisher    OutboxPublisher
+	PageSize     PageSizeEnum
+	PollInterval time.Duration
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	worker       periodicWorker
+}
+
+// Start relays pending events every PollInterval, or DefaultOutboxPollInterval if not set, in background until Stop is called
+func (relay *OutboxRelay) Start() error {
+	if relay.Publisher == nil {
+		return ErrNoOutboxPublisher
+	}
+	pollInterval := relay.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DefaultOutboxPollInterval
+	}
+	return relay.worker.start(pollInterval, func(ctx context.Context) {
+		if count, err := relay.RelayOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Int("relayed", count).Str("table", relay.Outbox.repo.GetTableName()).Msg("could not relay outbox events")
+		}
+	})
+}
+
+// Stop stops the background relay and waits for the batch in progress to finish
+func (relay *OutboxRelay) Stop() {
+	relay.worker.stop()
+}
+
+// RelayOnce walks all events due for delivery, oldest first, using the ascending (previous page) keyset pagination and returns the
+// number of events delivered
+func (relay *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	if relay.Publisher == nil {
+		return 0, ErrNoOutboxPublisher
+	}
+	now := relay.Outbox.repo.normalizeTimestamp(time.Now())
+	page := &data.Pagination{Previous: &data.Cursor{}}
+	delivered := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return delivered, err
+		}
+		events := make([]*OutboxEvent, 0, getExpectedMaxRowCount(relay.PageSize))
+		query := relay.Outbox.repo.GetSelectQuery() + outboxPendingFilter + getKeysetQueryFragment(page, true, relay.PageSize)
+		err := QueryRowsIntoStructs(relay.Outbox.db, query, Args2SliceFnWrapper(appendKeysetQueryArgs(page, now)...), &events)
+		if err != nil || len(events) == 0 {
+			return delivered, err
+		}
+		page = data.NewPagination(nil, events[len(events)-1])
+		if publishErr := relay.Publisher.Publish(ctx, events); publishErr != nil {
+			log.Warn().Err(publishErr).Int("events", len(events)).Msg("outbox publish failed, scheduling retry")
+			return delivered, relay.scheduleRetry(events, publishErr)
+		}
+		if err = relay.markDelivered(events); err != nil {
+			return delivered, err
+		}
+		delivered += len(events)
+		if len(events) < getExpectedMaxRowCount(relay.PageSize) {
+			return delivered, nil
+		}
+	}
+}
+
+func (relay *OutboxRelay) markDelivered(events []*OutboxEvent) error {
+	now := relay.Outbox.repo.normalizeTimestamp(time.Now())
+	args := make([]interface{}, 0, len(events)+2)
+	args = append(args, now, now)
+	for _, event := range events {
+		args = append(args, event.ID)
+	}
+	query := "UPDATE " + quoteIdentifier(relay.Outbox.repo.GetTableName()) + " SET `deliveredAt` = ?, `updatedAt` = ? WHERE `id` IN (" + getPlaceholders(len(events)) + ")"
+	return ExecuteMultipleWriteOpsInTransaction(relay.Outbox.db, func(tx *sql.Tx) error {
+		return ExecuteQueryInTransaction(tx, EmptyOps, query, Args2SliceFnWrapper(args...), int64(len(events)))
+	})
+}
+
+func (relay *OutboxRelay) scheduleRetry(events []*OutboxEvent, publishErr error) error {
+	now := relay.Outbox.repo.normalizeTimestamp(time.Now())
+	lastError := publishErr.Error()
+	if len(lastError) > maxOutboxLastErrorLength {
+		lastError = lastError[:maxOutboxLastErrorLength]
+	}
+	query := "UPDATE " + quoteIdentifier(relay.Outbox.repo.GetTableName()) + " SET `attempts` = ?, `lastError` = ?, `nextAttemptAt` = ?, `updatedAt` = ? WHERE `id` = ?"
+	ops := make([]func(tx *sql.Tx) error, 0, len(events))
+	for _, event := range events {
+		attempts := event.Attempts + 1
+		nextAttemptAt := now.Add(relay.getBackoff(attempts))
+		ops = append(ops, GetTxWrapperForSingleWriteQuery(EmptyOps, query, Args2SliceFnWrapper(attempts, lastError, nextAttemptAt, now, event.ID)))
+	}
+	return ExecuteMultipleWriteOpsInTransaction(relay.Outbox.db, ops...)
+}
+
+// getBackoff doubles MinBackoff for every attempt after the first, capped at MaxBackoff
+func (relay *OutboxRelay) getBackoff(attempts int) time.Duration {
+	return getExponentialBackoff(attempts, relay.MinBackoff, relay.MaxBackoff, DefaultOutboxMinBackoff, DefaultOutboxMaxBackoff)
+}
+
+func getExponentialBackoff(attempts int, minBackoff, maxBackoff, defaultMin, defaultMax time.Duration) time.Duration {
+	if minBackoff <= 0 {
+		minBackoff = defaultMin
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMax
+	}
+	backoff := minBackoff
+	for attempt := 1; attempt < attempts && backoff < maxBackoff; attempt++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// getTestOutbox returns the outbox of the shared test table emptied of events left by other tests or runs
+func getTestOutbox(t *testing.T) *Outbox {
+	outbox, err := NewOutbox(testDB, "outbox_test")
+	assert.Nil(t, err)
+	_, err = testDB.Exec("DELETE FROM `outbox_test`")
+	assert.Nil(t, err)
+	return outbox
+}
+
+func TestGetOutboxTableMigration(t *testing.T) {
+	up, down, err := GetOutboxTableMigration(config.SQLite3Dialect, "outbox_test")
+	assert.Nil(t, err)
+	upFile, _ := ioutil.ReadFile("test-migration/000009_create_outbox_test_table.up.sql")
+	downFile, _ := ioutil.ReadFile("test-migration/000009_create_outbox_test_table.down.sql")
+	assert.Equal(t, string(upFile), up)
+	assert.Equal(t, string(downFile), down)
+	up, _, _ = GetOutboxTableMigration(config.MySQLDialect, "outbox_test")
+	assert.Contains(t, up, "`createdAt` DATETIME(6) NOT NULL")
+	_, _, err = GetOutboxTableMigration(config.MySQLDialect, "outbox; --")
+	assert.Equal(t, ErrInvalidIdentifier, err)
+}
+
+func TestGetExponentialBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, getExponentialBackoff(1, 0, 0, time.Second, time.Minute))
+	assert.Equal(t, 4*time.Second, getExponentialBackoff(3, time.Second, time.Minute, 0, 0))
+	assert.Equal(t, time.Minute, getExponentialBackoff(100, time.Second, time.Minute, 0, 0))
+}
+
+func TestOutboxRelay(t *testing.T) {
+	outbox := getTestOutbox(t)
+	assert.Equal(t, ErrInvalidModelState, ExecuteOpsInTransaction(testDB, outbox.EnqueueOp("", nil)))
+	rollbackErr := errors.New("rollback")
+	assert.Equal(t, rollbackErr, ExecuteOpsInTransaction(testDB, func(tx *sql.Tx) error {
+		if _, err := outbox.Enqueue(tx, "rolled-back", []byte("0")); err != nil {
+			return err
+		}
+		return rollbackErr
+	}))
+	payloads := []string{"1", "2", "3"}
+	for _, payload := range payloads {
+		assert.Nil(t, ExecuteMultipleWriteOpsInTransaction(testDB, outbox.EnqueueOp("topic", []byte(payload))))
+	}
+	fail := true
+	published := make([]string, 0)
+	relay := &OutboxRelay{Outbox: outbox, PageSize: RegularPageSize, PollInterval: 10 * time.Millisecond, MinBackoff: time.Millisecond}
+	_, err := relay.RelayOnce(context.Background())
+	assert.Equal(t, ErrNoOutboxPublisher, err)
+	assert.Equal(t, ErrNoOutboxPublisher, relay.Start())
+	relay.Publisher = OutboxPublisherFunc(func(ctx context.Context, events []*OutboxEvent) error {
+		if fail {
+			return errors.New("broker down")
+		}
+		for _, event := range events {
+			published = append(published, string(event.Payload))
+		}
+		return nil
+	})
+	count, err := relay.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	events := make([]*OutboxEvent, 0)
+	assert.Nil(t, QueryRowsIntoStructs(testDB, outbox.repo.GetSelectQuery(), NilArgs, &events))
+	assert.Equal(t, len(payloads), len(events))
+	for _, event := range events {
+		assert.Equal(t, 1, event.Attempts)
+		assert.Equal(t, "broker down", event.LastError)
+		assert.False(t, event.DeliveredAt.Valid)
+	}
+	fail = false
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, relay.Start())
+	time.Sleep(100 * time.Millisecond)
+	relay.Stop()
+	assert.Equal(t, payloads, published)
+	count, err = relay.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	delivered := &OutboxEvent{}
+	assert.Nil(t, QuerySingleRowIntoStruct(testDB, outbox.repo.GetSelectQuery()+" WHERE `topic` = ? LIMIT 1", Args2SliceFnWrapper("topic"), delivered))
+	assert.True(t, delivered.DeliveredAt.Valid)
+	zeroInterval := &OutboxRelay{Outbox: outbox, Publisher: relay.Publisher}
+	assert.Nil(t, zeroInterval.Start())
+	zeroInterval.Stop()
+}
+
+func TestOutboxRelayKeysetPages(t *testing.T) {
+	outbox := getTestOutbox(t)
+	ops := make([]func(tx *sql.Tx) error, 0)
+	for index := 0; index < ExpectedMaxRowCount[RegularPageSize]*2+3; index++ {
+		ops = append(ops, outbox.EnqueueOp("keyset", []byte{byte(index)}))
+	}
+	assert.Nil(t, ExecuteMultipleWriteOpsInTransaction(testDB, ops...))
+	batches := 0
+	next := byte(0)
+	relay := &OutboxRelay{Outbox: outbox, Publisher: OutboxPublisherFunc(func(ctx context.Context, events []*OutboxEvent) error {
+		batches++
+		for _, event := range events {
+			assert.Equal(t, next, event.Payload[0])
+			next++
+		}
+		return nil
+	})}
+	count, err := relay.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, len(ops), count)
+	assert.Equal(t, 3, batches)
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// PoolHealthy means the DB responds to ping and the pool has capacity
+	PoolHealthy = dbcore.PoolHealthy
+	// PoolDegraded means the DB responds to ping but the pool is, or is close to being, exhausted
+	PoolDegraded = dbcore.PoolDegraded
+	// PoolUnhealthy means the DB did not respond to ping
+	PoolUnhealthy = dbcore.PoolUnhealthy
+	// DefaultPoolMonitorInterval is used when the monitor has no Interval
+	DefaultPoolMonitorInterval = 30 * time.Second
+	// DefaultPingTimeout is used when the monitor has no PingTimeout
+	DefaultPingTimeout = 5 * time.Second
+	// DefaultMaxInUseRatio is the in use to max open connections ratio at which the pool is considered exhausted
+	DefaultMaxInUseRatio = 0.9
+)
+
+var (
+	errPingTimedOut = errors.New("db ping timed out")
+	// PingDB is the liveness check used by the monitor; it is config.PingDBContext, which is abandoned when ctx is done
+	PingDB = func(ctx context.Context, dialect config.DBDialect, db *sql.DB) error {
+		err := config.PingDBContext(ctx, dialect, db)
+		if err != nil && ctx.Err() != nil {
+			return errPingTimedOut
+		}
+		return err
+	}
+)
+
+type (
+	// PoolHealthStatus represents the overall health of the DB connection pool
+	PoolHealthStatus = dbcore.PoolHealthStatus
+
+	// PoolStats is the JSON friendly form of sql.DBStats; WaitCount and WaitDurationMillis are totals since the pool was created
+	PoolStats = dbcore.PoolStats
+
+	// PoolHealth is the result of a pool check meant to be surfaced by the HTTP layer
+	PoolHealth = dbcore.PoolHealth
+
+	// PoolThresholds flag the pool as degraded when exceeded; zero values disable the wait thresholds
+	PoolThresholds struct {
+		// MaxInUseRatio of in use to max open connections; defaults to DefaultMaxInUseRatio, ignored if max open is unlimited
+		MaxInUseRatio float64
+		// MaxWaitCountPerCheck is the number of new waits for a connection allowed between two checks
+		MaxWaitCountPerCheck int64
+		// MaxWaitDurationPerCheck is the total new wait time for connections allowed between two checks
+		MaxWaitDurationPerCheck time.Duration
+	}
+
+	// PoolMonitor periodically pings the DB, logs the pool stats and evaluates the pool health
+	PoolMonitor struct {
+		DB          *sql.DB
+		Dialect     config.DBDialect
+		Interval    time.Duration
+		PingTimeout time.Duration
+		Thresholds  PoolThresholds
+		// OnCheck, if set, is called with every health result, e.g. to export stats as metrics
+		OnCheck   func(health *PoolHealth)
+		worker    periodicWorker
+		mutex     sync.Mutex
+		lastStats *sql.DBStats
+		health    *PoolHealth
+	}
+)
+
+// NewPoolStats converts sql.DBStats to PoolStats
+func NewPoolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMillis: stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+// Start checks immediately and then every Interval until Stop is called
+func (monitor *PoolMonitor) Start() error {
+	monitor.Check(context.Background())
+	interval := monitor.Interval
+	if interval <= 0 {
+		interval = DefaultPoolMonitorInterval
+	}
+	return monitor.worker.start(interval, func(ctx context.Context) { monitor.Check(ctx) })
+}
+
+// Stop stops the periodic checks
+func (monitor *PoolMonitor) Stop() {
+	monitor.worker.stop()
+}
+
+// GetHealth returns the result of the last check or checks now if none was done yet
+func (monitor *PoolMonitor) GetHealth() *PoolHealth {
+	monitor.mutex.Lock()
+	health := monitor.health
+	monitor.mutex.Unlock()
+	if health == nil {
+		health = monitor.Check(context.Background())
+	}
+	return health
+}
+
+// Check pings the DB, logs the pool stats and returns the evaluated health; OnCheck is called without holding the monitor's lock
+func (monitor *PoolMonitor) Check(ctx context.Context) *PoolHealth {
+	pingTimeout := monitor.PingTimeout
+	if pingTimeout <= 0 {
+		pingTimeout = DefaultPingTimeout
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	pingErr := PingDB(pingCtx, monitor.Dialect, monitor.DB)
+	stats := monitor.DB.Stats()
+	monitor.mutex.Lock()
+	health := &PoolHealth{Status: PoolHealthy, Stats: NewPoolStats(stats), CheckedAt: time.Now()}
+	if pingErr != nil {
+		health.Status = PoolUnhealthy
+		health.Reasons = append(health.Reasons, "ping failed: "+pingErr.Error())
+	}
+	for _, reason := range monitor.getExhaustionReasons(stats) {
+		if health.Status == PoolHealthy {
+			health.Status = PoolDegraded
+		}
+		health.Reasons = append(health.Reasons, reason)
+	}
+	monitor.lastStats = &stats
+	monitor.health = health
+	monitor.mutex.Unlock()
+	logEvent := log.Debug()
+	if health.Status != PoolHealthy {
+		logEvent = log.Warn().Strs("reasons", health.Reasons)
+	}
+	logEvent.Str("status", string(health.Status)).Int("open", stats.OpenConnections).Int("inUse", stats.InUse).Int("idle", stats.Idle).
+		Int64("waitCount", stats.WaitCount).Dur("waitDuration", stats.WaitDuration).Msg("db pool stats")
+	if monitor.OnCheck != nil {
+		monitor.OnCheck(health)
+	}
+	return health
+}
+
+func (monitor *PoolMonitor) getExhaustionReasons(stats sql.DBStats) []string {
+	reasons := make([]string, 0)
+	maxInUseRatio := monitor.Thresholds.MaxInUseRatio
+	if maxInUseRatio <= 0 {
+		maxInUseRatio = DefaultMaxInUseRatio
+	}
+	if stats.MaxOpenConnections > 0 && float64(stats.InUse) >= maxInUseRatio*float64(stats.MaxOpenConnections) {
+		reasons = append(reasons, fmt.Sprintf("%d of %d connections in use", stats.InUse, stats.MaxOpenConnections))
+	}
+	if monitor.lastStats == nil {
+		return reasons
+	}
+	newWaits := stats.WaitCount - monitor.lastStats.WaitCount
+	if monitor.Thresholds.MaxWaitCountPerCheck > 0 && newWaits > monitor.Thresholds.MaxWaitCountPerCheck {
+		reasons = append(reasons, fmt.Sprintf("%d waits for a connection since last check", newWaits))
+	}
+	newWaitDuration := stats.WaitDuration - monitor.lastStats.WaitDuration
+	if monitor.Thresholds.MaxWaitDurationPerCheck > 0 && newWaitDuration > monitor.Thresholds.MaxWaitDurationPerCheck {
+		reasons = append(reasons, fmt.Sprintf("waited %s for connections since last check", newWaitDuration))
+	}
+	return reasons
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolMonitorCheck(t *testing.T) {
+	var checked []*PoolHealth
+	monitor := &PoolMonitor{DB: testDB, Dialect: config.SQLite3Dialect, OnCheck: func(health *PoolHealth) { checked = append(checked, health) }}
+	health := monitor.GetHealth()
+	assert.Equal(t, PoolHealthy, health.Status)
+	assert.True(t, health.IsAvailable())
+	assert.Empty(t, health.Reasons)
+	assert.Equal(t, health, monitor.GetHealth())
+	assert.Equal(t, 1, len(checked))
+}
+
+func TestPoolMonitorExhaustion(t *testing.T) {
+	monitor := &PoolMonitor{Thresholds: PoolThresholds{MaxWaitCountPerCheck: 2, MaxWaitDurationPerCheck: time.Second}}
+	assert.Empty(t, monitor.getExhaustionReasons(sql.DBStats{MaxOpenConnections: 10, InUse: 8}))
+	assert.Equal(t, 1, len(monitor.getExhaustionReasons(sql.DBStats{MaxOpenConnections: 10, InUse: 9})))
+	assert.Empty(t, monitor.getExhaustionReasons(sql.DBStats{InUse: 100}))
+	monitor.lastStats = &sql.DBStats{WaitCount: 5, WaitDuration: time.Second}
+	assert.Empty(t, monitor.getExhaustionReasons(sql.DBStats{WaitCount: 7, WaitDuration: 2 * time.Second}))
+	assert.Equal(t, 2, len(monitor.getExhaustionReasons(sql.DBStats{WaitCount: 8, WaitDuration: 3 * time.Second})))
+}
+
+func TestPoolMonitorUnhealthy(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	monitor := &PoolMonitor{DB: db, Dialect: config.MySQLDialect, Interval: time.Hour}
+	mock.ExpectQuery("SHOW Tables").WillReturnError(errors.New("connection refused"))
+	assert.Nil(t, monitor.Start())
+	defer monitor.Stop()
+	health := monitor.GetHealth()
+	assert.Equal(t, PoolUnhealthy, health.Status)
+	assert.False(t, health.IsAvailable())
+	assert.Contains(t, health.Reasons[0], "connection refused")
+	oldPingDB := PingDB
+	defer func() { PingDB = oldPingDB }()
+	PingDB = func(ctx context.Context, dialect config.DBDialect, db *sql.DB) error {
+		<-ctx.Done()
+		return errPingTimedOut
+	}
+	monitor.PingTimeout = time.Millisecond
+	assert.Equal(t, []string{"ping failed: " + errPingTimedOut.Error()}, monitor.Check(context.Background()).Reasons)
+}
+
+func TestPingDB(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery("SHOW Tables").WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"Tables"}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, errPingTimedOut, PingDB(ctx, config.MySQLDialect, db))
+	assert.Nil(t, PingDB(context.Background(), config.SQLite3Dialect, testDB))
+	assert.NotNil(t, PingDB(context.Background(), config.DBDialect("mockdb"), testDB))
+}
+
+func TestPoolMonitorOnCheckGetsHealth(t *testing.T) {
+	monitor := &PoolMonitor{DB: testDB, Dialect: config.SQLite3Dialect}
+	var fromCallback *PoolHealth
+	monitor.OnCheck = func(health *PoolHealth) { fromCallback = monitor.GetHealth() }
+	health := monitor.Check(context.Background())
+	assert.Equal(t, health, fromCallback)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrDialectChangeNotSupported is returned when a pool is reconfigured to a different DB dialect, which requires a restart
+	ErrDialectChangeNotSupported = errors.New("changing DB dialect requires a restart")
+	// ErrPoolNotReconfigurable is returned when the connection URL of a pool not created by CreateDBConnectionPool is changed
+	ErrPoolNotReconfigurable = errors.New("connection url of the db connection pool can not be changed")
+)
+
+// ReconfigurablePool holds the DB connection pool and applies configuration changes to it live. Pool limits are applied to the
+// pool; a changed connection URL is validated and then used for every new connection of the same pool, while connections opened with
+// the previous URL are closed as they are returned to it. The *sql.DB never changes, so components holding it keep working.
+type ReconfigurablePool struct {
+	db            *sql.DB
+	mutex         sync.Mutex
+	dialect       config.DBDialect
+	connectionURL string
+}
+
+// NewReconfigurablePool wraps db, e.g. from GetConfiguredConnectionPool, that was created from dbConfig
+func NewReconfigurablePool(db *sql.DB, dbConfig config.RelationalDatabaseConfig) *ReconfigurablePool {
+	return &ReconfigurablePool{db: db, dialect: dbConfig.GetDBDialect(), connectionURL: getConnectionURL(dbConfig)}
+}
+
+// GetDB returns the connection pool
+func (pool *ReconfigurablePool) GetDB() *sql.DB {
+	return pool.db
+}
+
+// Reconfigure applies dbConfig to the pool. If the connection URL changed, it is first validated with a ping on a temporary pool.
+// On error the pool is left as is.
+func (pool *ReconfigurablePool) Reconfigure(dbConfig config.RelationalDatabaseConfig) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if dbConfig.GetDBDialect() != pool.dialect {
+		return ErrDialectChangeNotSupported
+	}
+	if queryLogConfig, ok := dbConfig.(config.QueryLogConfig); ok {
+		ConfigureSlowQueryLog(queryLogConfig.GetSlowQueryThreshold(), queryLogConfig.IsQueryArgLoggingEnabled())
+	}
+	connectionURL := getConnectionURL(dbConfig)
+	if connectionURL != pool.connectionURL {
+		connector := getInstrumentedConnector(pool.db)
+		if connector == nil {
+			return ErrPoolNotReconfigurable
+		}
+		if err := pingConnectionURL(pool.dialect, connectionURL); err != nil {
+			return err
+		}
+		connector.setConnectionURL(connectionURL)
+		pool.connectionURL = connectionURL
+		// dropping the idle limit closes idle connections, which were all opened with the previous URL
+		pool.db.SetMaxIdleConns(0)
+		log.Info().Msg("db connection url changed, new connections use it")
+	}
+	applyPoolLimits(pool.db, dbConfig)
+	configureWriteSerialization(pool.db, dbConfig)
+	log.Info().Uint16("maxOpen", dbConfig.GetMaxOpenDBConnections()).Uint16("maxIdle", dbConfig.GetMaxIdleDBConnections()).
+		Msg("applied db pool limits")
+	return nil
+}
+
+func pingConnectionURL(dialect config.DBDialect, connectionURL string) error {
+	db, err := getDB(string(dialect), connectionURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return config.PingDB(dialect, db)
+}
+
+// ReconfigureOnChange reloads the DB configuration and reconfigures the pool whenever the config file of cliConfig changes
+func (pool *ReconfigurablePool) ReconfigureOnChange(cliConfig *config.CLIConfig) {
+	cliConfig.NotifyOnConfigFileChange(func() { pool.reload(cliConfig) })
+}
+
+func (pool *ReconfigurablePool) reload(cliConfig *config.CLIConfig) {
+	dbConfig, err := config.GetDBConfigurationFromCLIConfig(cliConfig)
+	if err == nil {
+		err = pool.Reconfigure(dbConfig)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("could not reconfigure db connection pool")
+	}
+}
+
+// Close closes the pool
+func (pool *ReconfigurablePool) Close() error {
+	DisableWriteSerialization(pool.db)
+	return pool.db.Close()
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func getReconfigTestConfig(connectionURL string, maxOpen uint16) *config.Config {
+	return &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: connectionURL, DBMaxIdleConnections: 1, DBMaxOpenConnections: maxOpen}
+}
+
+func TestReconfigurablePool(t *testing.T) {
+	defer os.Remove("reconfig-a.sqlite3")
+	defer os.Remove("reconfig-b.sqlite3")
+	initialConfig := getReconfigTestConfig("reconfig-a.sqlite3", 5)
+	db, err := CreateDBConnectionPool(initialConfig)
+	assert.Nil(t, err)
+	pool := NewReconfigurablePool(db, initialConfig)
+	defer pool.Close()
+	t.Run("PoolLimits", func(t *testing.T) {
+		assert.Nil(t, pool.Reconfigure(getReconfigTestConfig("reconfig-a.sqlite3", 7)))
+		assert.Equal(t, db, pool.GetDB())
+		assert.Equal(t, 7, pool.GetDB().Stats().MaxOpenConnections)
+	})
+	t.Run("DialectChange", func(t *testing.T) {
+		mysqlConfig := getReconfigTestConfig("user:pass@tcp(localhost:3306)/db", 5)
+		mysqlConfig.DBDialect = config.MySQLDialect
+		assert.Equal(t, ErrDialectChangeNotSupported, pool.Reconfigure(mysqlConfig))
+		assert.Equal(t, db, pool.GetDB())
+	})
+	t.Run("InvalidURL", func(t *testing.T) {
+		assert.NotNil(t, pool.Reconfigure(getReconfigTestConfig("no-such-dir/reconfig.sqlite3", 5)))
+		assert.Equal(t, db, pool.GetDB())
+		assert.Nil(t, db.Ping())
+	})
+	t.Run("URLChange", func(t *testing.T) {
+		assert.Nil(t, pool.Reconfigure(getReconfigTestConfig("reconfig-b.sqlite3", 3)))
+		assert.Equal(t, db, pool.GetDB())
+		assert.Equal(t, 3, db.Stats().MaxOpenConnections)
+		assert.Nil(t, config.PingDB(config.SQLite3Dialect, db))
+		var file string
+		assert.Nil(t, db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file))
+		assert.Equal(t, "reconfig-b.sqlite3", filepath.Base(file))
+	})
+}
+
+func TestReconfigurablePoolKeepsConsumersWorking(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconfig")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.sqlite3", "b.sqlite3"} {
+		migrated, _ := getMigratedSQLiteDB(t, dir)
+		migrated.Close()
+		assert.Nil(t, os.Rename(filepath.Join(dir, "drift.sqlite3"), filepath.Join(dir, name)))
+	}
+	initialConfig := getReconfigTestConfig(filepath.Join(dir, "a.sqlite3"), 2)
+	db, err := CreateDBConnectionPool(initialConfig)
+	assert.Nil(t, err)
+	pool := NewReconfigurablePool(db, initialConfig)
+	defer pool.Close()
+	repo, err := NewRepository(db, "repository_test", &repositoryTestModel{})
+	assert.Nil(t, err)
+	before := &repositoryTestModel{Name: "before"}
+	assert.Nil(t, repo.Create(before))
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, pool.Reconfigure(getReconfigTestConfig(filepath.Join(dir, "b.sqlite3"), 2)))
+	// a transaction started before the change completes on the connection it began with
+	_, err = tx.Exec("UPDATE repository_test SET note = ? WHERE id = ?", "in flight", before.ID.String())
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+	after := &repositoryTestModel{Name: "after"}
+	assert.Nil(t, repo.Create(after))
+	assert.Nil(t, repo.Get(after.ID, &repositoryTestModel{}))
+	assert.True(t, errors.Is(repo.Get(before.ID, &repositoryTestModel{}), ErrNotFound))
+	previous, err := sql.Open("sqlite3", filepath.Join(dir, "a.sqlite3"))
+	assert.Nil(t, err)
+	defer previous.Close()
+	var note string
+	assert.Nil(t, previous.QueryRow("SELECT note FROM repository_test WHERE id = ?", before.ID.String()).Scan(&note))
+	assert.Equal(t, "in flight", note)
+	var count int
+	assert.Nil(t, previous.QueryRow("SELECT COUNT(*) FROM repository_test WHERE id = ?", after.ID.String()).Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestReconfigurablePoolReload(t *testing.T) {
+	defer os.Remove("reconfig-c.sqlite3")
+	configFile, err := ioutil.TempFile("", "reconfig-*.cfg")
+	assert.Nil(t, err)
+	defer os.Remove(configFile.Name())
+	configFile.WriteString("[rdbms]\ndialect=sqlite3\nconnection-url=reconfig-c.sqlite3\nmax-open-connxns=9\n")
+	configFile.Close()
+	initialConfig := getReconfigTestConfig("reconfig-c.sqlite3", 5)
+	db, err := CreateDBConnectionPool(initialConfig)
+	assert.Nil(t, err)
+	pool := NewReconfigurablePool(db, initialConfig)
+	defer pool.Close()
+	cliConfig := &config.CLIConfig{ConfigPath: configFile.Name()}
+	pool.ReconfigureOnChange(cliConfig)
+	defer cliConfig.StopWatcher()
+	assert.True(t, cliConfig.IsConfigWatcherStarted())
+	pool.reload(cliConfig)
+	assert.Equal(t, db, pool.GetDB())
+	assert.Equal(t, 9, db.Stats().MaxOpenConnections)
+}
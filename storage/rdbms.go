@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/imyousuf/appcommons/config"
 	"github.com/imyousuf/appcommons/data"
@@ -28,6 +32,12 @@ type (
 	MigrationConfig struct {
 		MigrationEnabled bool
 		MigrationSource  string
+		// BackupDir if set backs up a SQLite DB into it before pending migrations are applied
+		BackupDir string
+		// SeedDir if set has its seed files applied through ApplySeeds after the migrations
+		SeedDir string
+		// Timeout bounds the wait for the migration lock or for another instance to migrate; defaults to DefaultMigrationTimeout
+		Timeout time.Duration
 	}
 
 	// orderByClause represents the string to append for sorting to a DB query
@@ -88,37 +98,61 @@ var (
 		return db, err
 	}
 
-	// CreateDBConnectionPool just initializes the connection pool to the DB and does nothing else
+	// CreateDBConnectionPool just initializes the connection pool to the DB and does nothing else. The pool's driver is instrumented
+	// for slow query logging, configured if dbConfig implements config.QueryLogConfig, and for query hooks. For SQLite, tuning and write
+	// serialization are applied if dbConfig implements config.SQLiteConfig.
 	CreateDBConnectionPool = func(dbConfig config.RelationalDatabaseConfig) (*sql.DB, error) {
-		db, err := getDB(string(dbConfig.GetDBDialect()), dbConfig.GetDBConnectionURL())
+		if queryLogConfig, ok := dbConfig.(config.QueryLogConfig); ok {
+			ConfigureSlowQueryLog(queryLogConfig.GetSlowQueryThreshold(), queryLogConfig.IsQueryArgLoggingEnabled())
+		}
+		db, err := getDB(string(dbConfig.GetDBDialect()), getConnectionURL(dbConfig))
 		if err == nil {
-			db.SetConnMaxLifetime(dbConfig.GetDBConnectionMaxLifetime())
-			db.SetMaxIdleConns(int(dbConfig.GetMaxIdleDBConnections()))
-			db.SetMaxOpenConns(int(dbConfig.GetMaxOpenDBConnections()))
-			db.SetConnMaxIdleTime(dbConfig.GetDBConnectionMaxIdleTime())
+			applyPoolLimits(db, dbConfig)
+			configureWriteSerialization(db, dbConfig)
 		}
 		return db, err
 	}
 
+	applyPoolLimits = func(db *sql.DB, dbConfig config.RelationalDatabaseConfig) {
+		db.SetConnMaxLifetime(dbConfig.GetDBConnectionMaxLifetime())
+		db.SetMaxIdleConns(int(dbConfig.GetMaxIdleDBConnections()))
+		db.SetMaxOpenConns(int(dbConfig.GetMaxOpenDBConnections()))
+		db.SetConnMaxIdleTime(dbConfig.GetDBConnectionMaxIdleTime())
+		// database/sql does not expose the idle limit, it is kept for restoring it after temporarily lowering max open
+		if connector := getInstrumentedConnector(db); connector != nil {
+			atomic.StoreInt32(&connector.maxIdleConns, int32(dbConfig.GetMaxIdleDBConnections()))
+		}
+	}
+
 	getDB = func(dialect, connectionURL string) (*sql.DB, error) {
-		return sql.Open(string(dialect), connectionURL)
+		connector, err := newInstrumentedConnector(dialect, connectionURL)
+		if err != nil {
+			return nil, err
+		}
+		db := sql.OpenDB(connector)
+		connector.db = db
+		return db, nil
 	}
 	runMigration = func(db *sql.DB, dbConfig config.RelationalDatabaseConfig, migrationConf *MigrationConfig) error {
-		if migrationConf.MigrationEnabled {
-			driver, err := getMigrationDriver(db, dbConfig)
-			if err != nil {
-				return err
-			}
-			migration, err := getMigration(migrationConf.MigrationSource, string(dbConfig.GetDBDialect()), driver)
-			if err != nil {
-				return err
-			}
-			err = migration.Up()
-			if err != nil && err != migrate.ErrNoChange {
-				return err
-			}
+		if !migrationConf.MigrationEnabled {
+			setMigrationState(MigrationComplete, nil)
+			return nil
+		}
+		err := coordinateMigration(db, dbConfig, migrationConf)
+		if err != nil {
+			setMigrationState(MigrationFailed, err)
+		} else {
+			setMigrationState(MigrationComplete, nil)
 		}
-		return nil
+		return err
+	}
+
+	// NewMigrationConfig creates the migration config from the `-migrate`, `-backup-before-migrate`, `-migration-timeout` and `-seed`
+	// CLI flags; migration is disabled with `-check-schema-drift` so that the DB is checked as is
+	NewMigrationConfig = func(cliConfig *config.CLIConfig) *MigrationConfig {
+		migrationEnabled := cliConfig.IsMigrationEnabled() && !cliConfig.CheckSchemaDrift
+		return &MigrationConfig{MigrationEnabled: migrationEnabled, MigrationSource: cliConfig.MigrationSource,
+			BackupDir: cliConfig.PreMigrationBackupDir, Timeout: cliConfig.MigrationTimeout, SeedDir: cliConfig.SeedDir}
 	}
 
 	getMigration = func(source, dialect string, driver database.Driver) (*migrate.Migrate, error) {
@@ -143,10 +177,21 @@ var (
 	}
 
 	// ExecuteOpsInTransaction is the most high level function for wrapping DB Transaction Begin -> Do Queries -> Commit if success or Rollback.
-	// It has panic recovery backed in for default rollback
-	ExecuteOpsInTransaction = func(db *sql.DB, txOps func(tx *sql.Tx) error) (err error) {
+	// It has panic recovery backed in for default rollback. Driver errors are classified using ClassifyError. If write serialization is
+	// enabled for db the transaction waits for the one running on db, if any, to finish.
+	ExecuteOpsInTransaction = func(db *sql.DB, txOps func(tx *sql.Tx) error) error {
+		return ExecuteOpsInTransactionContext(context.Background(), db, txOps)
+	}
+
+	// ExecuteOpsInTransactionContext is same as ExecuteOpsInTransaction but begins the transaction with ctx; queries of the transaction
+	// are attributed to the request ID of ctx, if any, even when run without a context
+	ExecuteOpsInTransactionContext = func(ctx context.Context, db *sql.DB, txOps func(tx *sql.Tx) error) (err error) {
 		var tx *sql.Tx
-		tx, err = db.Begin()
+		if writer := getSerializedWriter(db); writer != nil {
+			writer.mutex.Lock()
+			defer writer.mutex.Unlock()
+		}
+		tx, err = db.BeginTx(ctx, nil)
 		defer func() {
 			if r := recover(); r != nil {
 				log.Error().Msg(fmt.Sprint("recovered from in-tx panic", r))
@@ -165,7 +210,7 @@ var (
 				Rollback(tx)
 			}
 		}
-		return err
+		return ClassifyError(err)
 	}
 
 	// ExecuteQueryInTransaction is a specific helper function designed for executing a write query that may effect multiple rows
@@ -196,7 +241,12 @@ var (
 
 	// Allows for multiple write operations to be performed within a single transaction
 	ExecuteMultipleWriteOpsInTransaction = func(db *sql.DB, ops ...func(tx *sql.Tx) error) error {
-		return ExecuteOpsInTransaction(db, func(tx *sql.Tx) (err error) {
+		return ExecuteMultipleWriteOpsInTransactionContext(context.Background(), db, ops...)
+	}
+
+	// ExecuteMultipleWriteOpsInTransactionContext is same as ExecuteMultipleWriteOpsInTransaction but begins the transaction with ctx
+	ExecuteMultipleWriteOpsInTransactionContext = func(ctx context.Context, db *sql.DB, ops ...func(tx *sql.Tx) error) error {
+		return ExecuteOpsInTransactionContext(ctx, db, func(tx *sql.Tx) (err error) {
 			for _, op := range ops {
 				if op == nil {
 					log.Warn().Msg("Tx Op is nil! Ignoring it")
@@ -216,26 +266,14 @@ var (
 	// appended directly after the WHERE clause.
 	GetPaginationQueryFragmentWithConfigurablePageSize = func(page *data.Pagination, append bool, pageSize PageSizeEnum) string {
 		query := " "
-		orderByQueryClause := baseOrderByClause
-		switch pageSize {
-		case ExtraLargePageSize:
-			orderByQueryClause = extraLargePageSizeWithOrder
-		case LargePageSize:
-			orderByQueryClause = largePageSizeWithOrder
-		case MediumPageSize:
-			orderByQueryClause = mediumPageSizeWithOrder
-		case RegularPageSize:
-			orderByQueryClause = pageSizeWithOrder
-		default:
-			orderByQueryClause = pageSizeWithOrder
-		}
+		orderByQueryClause := getOrderByClause(pageSize, false)
 		if page.Next != nil {
 			if append {
 				query = query + "AND "
 			} else {
 				query = query + "WHERE "
 			}
-			query = query + "id < '" + page.Next.ID + "' "
+			query = query + "id < ? "
 			query = query + "AND createdAt <= ? "
 		} else if page.Previous != nil {
 			if append {
@@ -243,20 +281,9 @@ var (
 			} else {
 				query = query + "WHERE "
 			}
-			query = query + "id > '" + page.Previous.ID + "' "
+			query = query + "id > ? "
 			query = query + "AND createdAt >= ? "
-			switch pageSize {
-			case ExtraLargePageSize:
-				orderByQueryClause = extraLargePageSizeWithOrderOpposite
-			case LargePageSize:
-				orderByQueryClause = largePageSizeWithOrderOpposite
-			case MediumPageSize:
-				orderByQueryClause = mediumPageSizeWithOrderOpposite
-			case RegularPageSize:
-				orderByQueryClause = pageSizeWithOrderOpposite
-			default:
-				orderByQueryClause = pageSizeWithOrderOpposite
-			}
+			orderByQueryClause = getOrderByClause(pageSize, true)
 		}
 		query = query + string(orderByQueryClause)
 		return query
@@ -267,38 +294,48 @@ var (
 		return GetPaginationQueryFragmentWithConfigurablePageSize(page, append, RegularPageSize)
 	}
 
-	// GetPaginationTimestampQueryArgs will generate the arguments pertaining to pagination fragment generated above
+	// GetPaginationTimestampQueryArgs will generate the arguments, the cursor ID and timestamp, pertaining to pagination fragment generated above
 	GetPaginationTimestampQueryArgs = func(page *data.Pagination) []interface{} {
-		times := make([]interface{}, 0, 2)
+		args := make([]interface{}, 0, 2)
 		if page.Next != nil {
-			times = append(times, page.Next.Timestamp)
-		}
-		if page.Previous != nil {
-			times = append(times, page.Previous.Timestamp)
+			args = append(args, page.Next.ID, page.Next.Timestamp)
+		} else if page.Previous != nil {
+			args = append(args, page.Previous.ID, page.Previous.Timestamp)
 		}
-		return times
+		return args
 	}
 
-	// QuerySingleRow is a helper designed to expect and read a single row from a result set
+	// QuerySingleRow is a helper designed to expect and read a single row from a result set; ErrNotFound, as well as
+	// sql.ErrNoRows, is matched if there is none
 	QuerySingleRow = func(db *sql.DB, query string, queryArgs func() []interface{}, scanArgs func() []interface{}) error {
-		row := db.QueryRow(query, queryArgs()...)
-		return row.Scan(scanArgs()...)
+		return QuerySingleRowContext(context.Background(), db, query, queryArgs, scanArgs)
+	}
+
+	// QuerySingleRowContext is same as QuerySingleRow but runs the query with ctx
+	QuerySingleRowContext = func(ctx context.Context, db *sql.DB, query string, queryArgs func() []interface{}, scanArgs func() []interface{}) error {
+		row := db.QueryRowContext(ctx, query, queryArgs()...)
+		return ClassifyError(row.Scan(scanArgs()...))
 	}
 
 	// QuerySingleRow is a helper designed to expect and read multiple rows from a result set
 	QueryRows = func(db *sql.DB, query string, queryArgs func() []interface{}, scanArgs func() []interface{}) error {
-		rows, err := db.Query(query, queryArgs()...)
+		return QueryRowsContext(context.Background(), db, query, queryArgs, scanArgs)
+	}
+
+	// QueryRowsContext is same as QueryRows but runs the query with ctx
+	QueryRowsContext = func(ctx context.Context, db *sql.DB, query string, queryArgs func() []interface{}, scanArgs func() []interface{}) error {
+		rows, err := db.QueryContext(ctx, query, queryArgs()...)
 		if err != nil {
-			return err
+			return ClassifyError(err)
 		}
 		defer func() { rows.Close() }()
 		for rows.Next() {
 			err = rows.Scan(scanArgs()...)
 			if err != nil {
-				return err
+				return ClassifyError(err)
 			}
 		}
-		return err
+		return ClassifyError(err)
 	}
 
 	// AppendWithPaginationArgs appends query positional arguments for pagination to the existing list of positional arguments
@@ -317,3 +354,58 @@ var (
 		return func() []interface{} { return args }
 	}
 )
+
+// tableIndex is an index created along with a table; it is named with the table name as prefix
+type tableIndex struct {
+	suffix  string
+	columns []string
+}
+
+// getDateTimeType returns the column type for timestamps; the SQLite driver only parses time for the exact DATETIME declared type while
+// MySQL needs the fractional precision
+func getDateTimeType(dialect config.DBDialect) string {
+	if dialect == config.MySQLDialect {
+		return "DATETIME(6)"
+	}
+	return "DATETIME"
+}
+
+// getTableMigration returns the up and down SQL creating and dropping table with the column definitions and indexes
+func getTableMigration(table string, columns []string, indexes ...tableIndex) (up string, down string, err error) {
+	if !isValidIdentifier(table) {
+		return "", "", ErrInvalidIdentifier
+	}
+	up = "CREATE TABLE IF NOT EXISTS " + quoteIdentifier(table) + " (\n    " + strings.Join(columns, ",\n    ") + "\n);\n"
+	for _, index := range indexes {
+		up += "CREATE INDEX " + quoteIdentifier(table+"_"+index.suffix) + " ON " + quoteIdentifier(table) + " (" +
+			joinQuotedIdentifiers(index.columns) + ");\n"
+	}
+	down = "DROP TABLE IF EXISTS " + quoteIdentifier(table) + ";"
+	return up, down, nil
+}
+
+// getOrderByClause returns the newest first order, or oldest first if ascending, limited to the rows of pageSize
+func getOrderByClause(pageSize PageSizeEnum, ascending bool) orderByClause {
+	if ascending {
+		switch pageSize {
+		case ExtraLargePageSize:
+			return extraLargePageSizeWithOrderOpposite
+		case LargePageSize:
+			return largePageSizeWithOrderOpposite
+		case MediumPageSize:
+			return mediumPageSizeWithOrderOpposite
+		default:
+			return pageSizeWithOrderOpposite
+		}
+	}
+	switch pageSize {
+	case ExtraLargePageSize:
+		return extraLargePageSizeWithOrder
+	case LargePageSize:
+		return largePageSizeWithOrder
+	case MediumPageSize:
+		return mediumPageSizeWithOrder
+	default:
+		return pageSizeWithOrder
+	}
+}
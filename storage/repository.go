@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/imyousuf/appcommons/data"
+	"github.com/imyousuf/appcommons/storage/dbcore"
+	"github.com/rs/xid"
+)
+
+const (
+	idColumn        = "id"
+	createdAtColumn = "createdAt"
+	updatedAtColumn = "updatedAt"
+	deletedAtColumn = "deletedAt"
+)
+
+var (
+	// ErrInvalidModelState is returned when model is not in valid state even after quick fix is applied
+	ErrInvalidModelState = errors.New("model not in valid state for write")
+	// ErrStaleModel is returned when an optimistic update finds the row's updatedAt changed since the model was read
+	ErrStaleModel = dbcore.ErrStaleModel
+	// ErrSoftDeleteNotEnabled is returned when restore is attempted on a repository without soft delete
+	ErrSoftDeleteNotEnabled = errors.New("soft delete not enabled for repository")
+	// ErrMissingPaginateableColumns is returned when the repository column mapping lacks id, createdAt or updatedAt
+	ErrMissingPaginateableColumns = errors.New("columns must include id, createdAt and updatedAt")
+)
+
+// Repository provides create, update, get, list and delete operations for a table whose rows map to a data.PaginateableModel
+type Repository struct {
+	// TimestampPrecision is what createdAt and updatedAt are truncated to before write; set to time.Second for DATETIME columns without fractional seconds
+	TimestampPrecision    time.Duration
+	db                    *sql.DB
+	table                 string
+	columns               []string
+	selectQuery           string
+	insertQuery           string
+	conditionalSetQuery   string
+	conditionalSetColumns []string
+	deleteQuery           string
+	softDeleteQuery       string
+	restoreQuery          string
+	softDelete            bool
+	includeDeleted        bool
+}
+
+// NewRepository creates a repository for the table; prototype determines the model type and columns, if not provided, are derived from its `db` tags.
+// If the prototype embeds data.SoftDeletable and columns include deletedAt, Delete marks rows deleted and reads exclude them.
+func NewRepository(db *sql.DB, table string, prototype data.PaginateableModel, columns ...string) (*Repository, error) {
+	if !isValidIdentifier(table) {
+		return nil, ErrInvalidIdentifier
+	}
+	if modelType := reflect.TypeOf(prototype); modelType == nil || modelType.Kind() != reflect.Ptr {
+		return nil, ErrInvalidMappingTarget
+	}
+	if len(columns) <= 0 {
+		var err error
+		if columns, err = GetColumnNames(prototype); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := GetFieldPointers(prototype, columns...); err != nil {
+		return nil, err
+	}
+	hasColumn := make(map[string]bool)
+	setColumns := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !isValidIdentifier(column) {
+			return nil, ErrInvalidIdentifier
+		}
+		hasColumn[column] = true
+		if column != idColumn && column != createdAtColumn && column != updatedAtColumn {
+			setColumns = append(setColumns, column)
+		}
+	}
+	if !hasColumn[idColumn] || !hasColumn[createdAtColumn] || !hasColumn[updatedAtColumn] {
+		return nil, ErrMissingPaginateableColumns
+	}
+	repo := &Repository{TimestampPrecision: time.Microsecond, db: db, table: table, columns: columns, conditionalSetColumns: setColumns}
+	quotedTable := quoteIdentifier(table)
+	repo.selectQuery = "SELECT " + joinQuotedIdentifiers(columns) + " FROM " + quotedTable
+	repo.insertQuery = "INSERT INTO " + quotedTable + " (" + joinQuotedIdentifiers(columns) + ") VALUES (" + getPlaceholders(len(columns)) + ")"
+	setClauses := make([]string, len(setColumns))
+	for index, column := range setColumns {
+		setClauses[index] = quoteIdentifier(column) + " = ?"
+	}
+	repo.conditionalSetQuery = "UPDATE " + quotedTable + " SET " + strings.Join(setClauses, ", ")
+	repo.deleteQuery = "DELETE FROM " + quotedTable + " WHERE " + quoteIdentifier(idColumn) + " = ?"
+	if _, ok := prototype.(data.SoftDeletableModel); ok && hasColumn[deletedAtColumn] {
+		repo.softDelete = true
+		repo.softDeleteQuery = "UPDATE " + quotedTable + " SET " + quoteIdentifier(deletedAtColumn) + " = ?, " + quoteIdentifier(updatedAtColumn) + " = ? WHERE " +
+			quoteIdentifier(idColumn) + " = ?" + GetSoftDeleteFilterFragment(false, true)
+		repo.restoreQuery = "UPDATE " + quotedTable + " SET " + quoteIdentifier(deletedAtColumn) + " = NULL, " + quoteIdentifier(updatedAtColumn) + " = ? WHERE " +
+			quoteIdentifier(idColumn) + " = ? AND " + quoteIdentifier(deletedAtColumn) + " IS NOT NULL"
+	}
+	return repo, nil
+}
+
+// GetTableName returns the name of the table backing the repository
+func (repo *Repository) GetTableName() string {
+	return repo.table
+}
+
+// IsSoftDeleteEnabled returns whether Delete marks rows deleted instead of removing them
+func (repo *Repository) IsSoftDeleteEnabled() bool {
+	return repo.softDelete
+}
+
+// IncludingDeleted returns a view of the repository whose Get and List also read soft deleted rows
+func (repo *Repository) IncludingDeleted() *Repository {
+	view := *repo
+	view.includeDeleted = true
+	return &view
+}
+
+func (repo *Repository) getDeletedFilter(append bool) string {
+	if !repo.softDelete {
+		return ""
+	}
+	return GetSoftDeleteFilterFragment(repo.includeDeleted, append)
+}
+
+// GetSelectQuery returns the `SELECT columns FROM table` prefix for custom queries to be read via QueryRowsIntoStructs
+func (repo *Repository) GetSelectQuery() string {
+	return repo.selectQuery
+}
+
+func (repo *Repository) normalizeTimestamp(timestamp time.Time) time.Time {
+	return timestamp.UTC().Truncate(repo.TimestampPrecision)
+}
+
+func (repo *Repository) prepareForWrite(model data.PaginateableModel) error {
+	model.QuickFix()
+	if !model.IsInValidState() {
+		return ErrInvalidModelState
+	}
+	return nil
+}
+
+// CreateOp returns a transaction op that validates and inserts the model; it can be combined with other ops in ExecuteMultipleWriteOpsInTransaction
+func (repo *Repository) CreateOp(model data.PaginateableModel) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if err := repo.prepareForWrite(model); err != nil {
+			return err
+		}
+		base := model.GetBasePaginateable()
+		base.CreatedAt = repo.normalizeTimestamp(base.CreatedAt)
+		base.UpdatedAt = repo.normalizeTimestamp(base.UpdatedAt)
+		args, err := GetFieldValues(model, repo.columns...)
+		if err != nil {
+			return err
+		}
+		return ExecuteQueryInTransaction(tx, EmptyOps, repo.insertQuery, Args2SliceFnWrapper(args...), int64(1))
+	}
+}
+
+// Create validates, quick fixes and inserts the model in its own transaction
+func (repo *Repository) Create(model data.PaginateableModel) error {
+	return ExecuteMultipleWriteOpsInTransaction(repo.db, repo.CreateOp(model))
+}
+
+// UpdateOp returns a transaction op for optimistic update; the row is only updated if its updatedAt still matches the model's and on success
+// model's UpdatedAt is bumped. ErrStaleModel is returned on mismatch.
+func (repo *Repository) UpdateOp(model data.PaginateableModel) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if err := repo.prepareForWrite(model); err != nil {
+			return err
+		}
+		return conditionalUpdate(tx, model.GetBasePaginateable(), repo.conditionalSetQuery, func() ([]interface{}, error) {
+			return GetFieldValues(model, repo.conditionalSetColumns...)
+		}, repo.TimestampPrecision)
+	}
+}
+
+// Update performs optimistic update of the model in its own transaction
+func (repo *Repository) Update(model data.PaginateableModel) error {
+	return ExecuteMultipleWriteOpsInTransaction(repo.db, repo.UpdateOp(model))
+}
+
+// DeleteOp returns a transaction op that deletes, or soft deletes if enabled, the row with the id; ErrNotFound is matched if no row was deleted
+func (repo *Repository) DeleteOp(id xid.ID) func(tx *sql.Tx) error {
+	if !repo.softDelete {
+		return repo.HardDeleteOp(id)
+	}
+	return func(tx *sql.Tx) error {
+		now := repo.normalizeTimestamp(time.Now())
+		return expectSingleRowChanged(ExecuteQueryInTransaction(tx, EmptyOps, repo.softDeleteQuery, Args2SliceFnWrapper(now, now, id), int64(1)))
+	}
+}
+
+// HardDeleteOp returns a transaction op that removes the row with the id irrespective of soft delete
+func (repo *Repository) HardDeleteOp(id xid.ID) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return expectSingleRowChanged(ExecuteQueryInTransaction(tx, EmptyOps, repo.deleteQuery, Args2SliceFnWrapper(id), int64(1)))
+	}
+}
+
+// RestoreOp returns a transaction op that clears deletion of a soft deleted row; ErrNotFound is matched if no deleted row has the id
+func (repo *Repository) RestoreOp(id xid.ID) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if !repo.softDelete {
+			return ErrSoftDeleteNotEnabled
+		}
+		return expectSingleRowChanged(ExecuteQueryInTransaction(tx, EmptyOps, repo.restoreQuery, Args2SliceFnWrapper(repo.normalizeTimestamp(time.Now()), id), int64(1)))
+	}
+}
+
+// Delete deletes, or soft deletes if enabled, the row with the id in its own transaction
+func (repo *Repository) Delete(id xid.ID) error {
+	return ExecuteMultipleWriteOpsInTransaction(repo.db, repo.DeleteOp(id))
+}
+
+// HardDelete removes the row with the id in its own transaction
+func (repo *Repository) HardDelete(id xid.ID) error {
+	return ExecuteMultipleWriteOpsInTransaction(repo.db, repo.HardDeleteOp(id))
+}
+
+// Restore clears deletion of a soft deleted row in its own transaction
+func (repo *Repository) Restore(id xid.ID) error {
+	return ExecuteMultipleWriteOpsInTransaction(repo.db, repo.RestoreOp(id))
+}
+
+func expectSingleRowChanged(err error) error {
+	if err == ErrNoRowsUpdated {
+		err = ClassifyError(sql.ErrNoRows)
+	}
+	return err
+}
+
+// Get reads the row with the id into dest; ErrNotFound is matched if it does not exist or is soft deleted, unless deleted rows are included
+func (repo *Repository) Get(id xid.ID, dest data.PaginateableModel) error {
+	return QuerySingleRowIntoStruct(repo.db, repo.selectQuery+" WHERE "+quoteIdentifier(idColumn)+" = ?"+repo.getDeletedFilter(true), Args2SliceFnWrapper(id), dest)
+}
+
+// List reads a page of models into dest, a pointer to slice of the model (or its pointer), newest first irrespective of traversal direction.
+// Soft deleted rows are excluded unless deleted rows are included.
+// It returns the pagination for the adjacent pages, which is empty when no rows are read.
+func (repo *Repository) List(page *data.Pagination, pageSize PageSizeEnum, dest interface{}) (*data.Pagination, error) {
+	if page == nil {
+		page = &data.Pagination{}
+	}
+	sliceValue := reflect.ValueOf(dest)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.IsNil() || sliceValue.Elem().Kind() != reflect.Slice {
+		return &data.Pagination{}, ErrInvalidMappingTarget
+	}
+	sliceValue = sliceValue.Elem()
+	startIndex := sliceValue.Len()
+	deletedFilter := repo.getDeletedFilter(false)
+	query := repo.selectQuery + deletedFilter + GetPaginationQueryFragmentWithConfigurablePageSize(page, len(deletedFilter) > 0, pageSize)
+	err := QueryRowsIntoStructs(repo.db, query, Args2SliceFnWrapper(GetPaginationTimestampQueryArgs(page)...), dest)
+	if err != nil || sliceValue.Len() <= startIndex {
+		return &data.Pagination{}, err
+	}
+	if page.Next == nil && page.Previous != nil {
+		reverseSlice(sliceValue, startIndex)
+	}
+	first := asPaginateable(sliceValue.Index(startIndex))
+	last := asPaginateable(sliceValue.Index(sliceValue.Len() - 1))
+	return data.NewPagination(last, first), nil
+}
+
+func asPaginateable(value reflect.Value) data.Paginateable {
+	if value.Kind() != reflect.Ptr {
+		value = value.Addr()
+	}
+	paginateable, _ := value.Interface().(data.Paginateable)
+	return paginateable
+}
+
+func reverseSlice(sliceValue reflect.Value, startIndex int) {
+	swap := reflect.Swapper(sliceValue.Interface())
+	for left, right := startIndex, sliceValue.Len()-1; left < right; left, right = left+1, right-1 {
+		swap(left, right)
+	}
+}
+
+func quoteIdentifier(identifier string) string {
+	return "`" + identifier + "`"
+}
+
+func joinQuotedIdentifiers(identifiers []string) string {
+	quoted := make([]string, len(identifiers))
+	for index, identifier := range identifiers {
+		quoted[index] = quoteIdentifier(identifier)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func getPlaceholders(count int) string {
+	if count <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", count-1) + "?"
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/data"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+)
+
+type repositoryTestModel struct {
+	data.BasePaginateable
+	Name string `db:"name"`
+	Note string `db:"note"`
+}
+
+func (model *repositoryTestModel) IsInValidState() bool {
+	return len(model.Name) > 0
+}
+
+func getTestRepository(t *testing.T) *Repository {
+	repo, err := NewRepository(testDB, "repository_test", &repositoryTestModel{})
+	assert.Nil(t, err)
+	return repo
+}
+
+func TestNewRepository(t *testing.T) {
+	t.Run("InvalidTable", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewRepository(testDB, "repository_test; --", &repositoryTestModel{})
+		assert.Equal(t, ErrInvalidIdentifier, err)
+	})
+	t.Run("MissingBaseColumns", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewRepository(testDB, "repository_test", &repositoryTestModel{}, "id", "name")
+		assert.Equal(t, ErrMissingPaginateableColumns, err)
+	})
+	t.Run("UnmappedColumn", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewRepository(testDB, "repository_test", &repositoryTestModel{}, "id", "createdAt", "updatedAt", "unknown")
+		assert.NotNil(t, err)
+	})
+	t.Run("Queries", func(t *testing.T) {
+		t.Parallel()
+		repo := getTestRepository(t)
+		assert.Equal(t, "repository_test", repo.GetTableName())
+		assert.Equal(t, "SELECT `name`, `note`, `id`, `createdAt`, `updatedAt` FROM `repository_test`", repo.GetSelectQuery())
+		assert.Equal(t, "UPDATE `repository_test` SET `name` = ?, `note` = ?, `updatedAt` = ? WHERE `id` = ? AND `updatedAt` = ?", getConditionalUpdateQuery(repo.conditionalSetQuery))
+	})
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	repo := getTestRepository(t)
+	t.Run("CreateInvalid", func(t *testing.T) {
+		model := &repositoryTestModel{}
+		assert.Equal(t, ErrInvalidModelState, repo.Create(model))
+	})
+	model := &repositoryTestModel{Name: "name", Note: "note"}
+	t.Run("CreateAndGet", func(t *testing.T) {
+		assert.Nil(t, repo.Create(model))
+		assert.False(t, model.ID.IsNil())
+		readModel := &repositoryTestModel{}
+		assert.Nil(t, repo.Get(model.ID, readModel))
+		assert.Equal(t, model.Name, readModel.Name)
+		assert.True(t, model.UpdatedAt.Equal(readModel.UpdatedAt))
+	})
+	t.Run("OptimisticUpdate", func(t *testing.T) {
+		staleCopy := &repositoryTestModel{}
+		assert.Nil(t, repo.Get(model.ID, staleCopy))
+		lastUpdatedAt := model.UpdatedAt
+		model.Note = "updated note"
+		assert.Nil(t, repo.Update(model))
+		assert.True(t, model.UpdatedAt.After(lastUpdatedAt))
+		readModel := &repositoryTestModel{}
+		assert.Nil(t, repo.Get(model.ID, readModel))
+		assert.Equal(t, "updated note", readModel.Note)
+		assert.True(t, model.UpdatedAt.Equal(readModel.UpdatedAt))
+		staleCopy.Note = "stale"
+		assert.Equal(t, ErrStaleModel, repo.Update(staleCopy))
+		assert.True(t, staleCopy.UpdatedAt.Equal(lastUpdatedAt))
+	})
+	t.Run("UpdateInvalid", func(t *testing.T) {
+		invalid := *model
+		invalid.Name = ""
+		assert.Equal(t, ErrInvalidModelState, repo.Update(&invalid))
+	})
+	t.Run("Delete", func(t *testing.T) {
+		assert.Nil(t, repo.Delete(model.ID))
+		assert.True(t, errors.Is(repo.Get(model.ID, &repositoryTestModel{}), ErrNotFound))
+		assert.True(t, errors.Is(repo.Delete(model.ID), ErrNotFound))
+	})
+	t.Run("CreateOpsInSingleTx", func(t *testing.T) {
+		first := &repositoryTestModel{Name: "first"}
+		duplicate := &repositoryTestModel{Name: "duplicate"}
+		assert.Nil(t, repo.Create(first))
+		duplicate.ID = first.ID
+		second := &repositoryTestModel{Name: "second"}
+		err := ExecuteMultipleWriteOpsInTransaction(testDB, repo.CreateOp(second), repo.CreateOp(duplicate))
+		assert.True(t, errors.Is(err, ErrDuplicateKey))
+		assert.True(t, errors.Is(repo.Get(second.ID, &repositoryTestModel{}), ErrNotFound))
+		assert.Nil(t, repo.Delete(first.ID))
+	})
+}
+
+func TestRepositoryList(t *testing.T) {
+	repo, err := NewRepository(testDB, "repository_test", &repositoryTestModel{})
+	assert.Nil(t, err)
+	count := 60
+	ops := make([]func(*sql.Tx) error, 0, count)
+	baseTime := time.Now().Add(-1 * time.Hour)
+	for index := 0; index < count; index++ {
+		model := &repositoryTestModel{Name: "list" + strconv.Itoa(index), Note: "note"}
+		model.ID = xid.New()
+		model.CreatedAt = baseTime.Add(time.Duration(index) * time.Second)
+		ops = append(ops, repo.CreateOp(model))
+	}
+	assert.Nil(t, ExecuteMultipleWriteOpsInTransaction(testDB, ops...))
+	var firstPage []repositoryTestModel
+	pagination, err := repo.List(nil, RegularPageSize, &firstPage)
+	assert.Nil(t, err)
+	assert.Equal(t, 25, len(firstPage))
+	assert.True(t, firstPage[0].CreatedAt.After(firstPage[24].CreatedAt))
+	var secondPage []*repositoryTestModel
+	nextPagination, err := repo.List(&data.Pagination{Next: pagination.Next}, RegularPageSize, &secondPage)
+	assert.Nil(t, err)
+	assert.Equal(t, 25, len(secondPage))
+	assert.True(t, firstPage[24].CreatedAt.After(secondPage[0].CreatedAt))
+	var backToFirst []repositoryTestModel
+	_, err = repo.List(&data.Pagination{Previous: nextPagination.Previous}, RegularPageSize, &backToFirst)
+	assert.Nil(t, err)
+	assert.Equal(t, 25, len(backToFirst))
+	assert.Equal(t, firstPage[0].ID, backToFirst[0].ID)
+	assert.Equal(t, firstPage[24].ID, backToFirst[24].ID)
+	var empty []repositoryTestModel
+	emptyPagination, err := repo.List(&data.Pagination{Next: &data.Cursor{ID: "0", Timestamp: baseTime.Add(-1 * time.Hour)}}, RegularPageSize, &empty)
+	assert.Nil(t, err)
+	assert.Nil(t, emptyPagination.Next)
+	assert.Equal(t, 0, len(empty))
+	var injected []repositoryTestModel
+	_, err = repo.List(&data.Pagination{Next: &data.Cursor{ID: "' OR 1=1 --", Timestamp: time.Now()}}, RegularPageSize, &injected)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(injected))
+	_, err = repo.List(nil, RegularPageSize, empty)
+	assert.Equal(t, ErrInvalidMappingTarget, err)
+}
@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	migrate_mysql "github.com/golang-migrate/migrate/v4/database/mysql"
+	migrate_sqlite3 "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	migrationVersionTable = "schema_migrations"
+)
+
+var (
+	// ErrSchemaDrift is returned by the schema drift CLI mode when the live schema does not match the migrations
+	ErrSchemaDrift = errors.New("live db schema drifted from migrations")
+	// ErrMigrationSourceRequired is returned when schema drift check is requested without a migration source
+	ErrMigrationSourceRequired = errors.New("migration source required to check schema drift")
+	// ErrUnsupportedDialect is returned when schema introspection is requested for a dialect other than SQLite and MySQL
+	ErrUnsupportedDialect = errors.New("schema introspection not supported for dialect")
+)
+
+type (
+	// ColumnSchema represents the introspected definition of a column
+	ColumnSchema struct {
+		Name     string
+		Type     string
+		Nullable bool
+	}
+
+	// IndexSchema represents the introspected definition of an index
+	IndexSchema struct {
+		Name    string
+		Columns []string
+		Unique  bool
+	}
+
+	// TableSchema represents the introspected columns and indexes of a table
+	TableSchema struct {
+		Name    string
+		Columns map[string]ColumnSchema
+		Indexes map[string]IndexSchema
+	}
+
+	// SchemaSnapshot represents the introspected tables of a DB, excluding the migration version, migration lock and seed version tables
+	SchemaSnapshot struct {
+		Tables map[string]*TableSchema
+	}
+
+	// SchemaDrift lists how the live schema differs from the expected one; columns are `table.column` and indexes `table.index`
+	SchemaDrift struct {
+		MissingTables  []string `json:"missingTables,omitempty"`
+		ExtraTables    []string `json:"extraTables,omitempty"`
+		MissingColumns []string `json:"missingColumns,omitempty"`
+		ExtraColumns   []string `json:"extraColumns,omitempty"`
+		ChangedColumns []string `json:"changedColumns,omitempty"`
+		MissingIndexes []string `json:"missingIndexes,omitempty"`
+		ExtraIndexes   []string `json:"extraIndexes,omitempty"`
+		ChangedIndexes []string `json:"changedIndexes,omitempty"`
+	}
+)
+
+// HasDrift checks whether any difference was found
+func (drift *SchemaDrift) HasDrift() bool {
+	return len(drift.MissingTables)+len(drift.ExtraTables)+len(drift.MissingColumns)+len(drift.ExtraColumns)+len(drift.ChangedColumns)+
+		len(drift.MissingIndexes)+len(drift.ExtraIndexes)+len(drift.ChangedIndexes) > 0
+}
+
+func (column ColumnSchema) String() string {
+	nullable := "NOT NULL"
+	if column.Nullable {
+		nullable = "NULL"
+	}
+	return column.Type + " " + nullable
+}
+
+func (index IndexSchema) String() string {
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	return unique + "(" + strings.Join(index.Columns, ", ") + ")"
+}
+
+func (snapshot *SchemaSnapshot) getTable(name string) *TableSchema {
+	table, ok := snapshot.Tables[name]
+	if !ok {
+		table = &TableSchema{Name: name, Columns: make(map[string]ColumnSchema), Indexes: make(map[string]IndexSchema)}
+		snapshot.Tables[name] = table
+	}
+	return table
+}
+
+// IntrospectSchema reads the tables, columns and indexes of db from `sqlite_master` or `information_schema`
+func IntrospectSchema(ctx context.Context, db *sql.DB, dialect config.DBDialect) (*SchemaSnapshot, error) {
+	switch dialect {
+	case config.SQLite3Dialect:
+		return introspectSQLite(ctx, db)
+	case config.MySQLDialect:
+		return introspectMySQL(ctx, db)
+	default:
+		return nil, ErrUnsupportedDialect
+	}
+}
+
+func introspectSQLite(ctx context.Context, db *sql.DB) (*SchemaSnapshot, error) {
+	snapshot := &SchemaSnapshot{Tables: make(map[string]*TableSchema)}
+	tableNames, err := queryStrings(ctx, db, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name NOT IN (?, ?, ?)",
+		migrationVersionTable, MigrationLockTable, SeedVersionTable)
+	if err != nil {
+		return nil, err
+	}
+	for _, tableName := range tableNames {
+		table := snapshot.getTable(tableName)
+		err = queryEach(ctx, db, "SELECT name, type, \"notnull\", pk FROM pragma_table_info(?)", []interface{}{tableName}, func(rows *sql.Rows) error {
+			var column ColumnSchema
+			var notNull, primaryKey int
+			err := rows.Scan(&column.Name, &column.Type, &notNull, &primaryKey)
+			column.Type = strings.ToUpper(column.Type)
+			column.Nullable = notNull == 0 && primaryKey == 0
+			table.Columns[column.Name] = column
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		var indexes []IndexSchema
+		err = queryEach(ctx, db, "SELECT name, \"unique\" FROM pragma_index_list(?)", []interface{}{tableName}, func(rows *sql.Rows) error {
+			var index IndexSchema
+			err := rows.Scan(&index.Name, &index.Unique)
+			indexes = append(indexes, index)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes {
+			if index.Columns, err = queryStrings(ctx, db, "SELECT name FROM pragma_index_info(?) ORDER BY seqno", index.Name); err != nil {
+				return nil, err
+			}
+			table.Indexes[index.Name] = index
+		}
+	}
+	return snapshot, nil
+}
+
+func introspectMySQL(ctx context.Context, db *sql.DB) (*SchemaSnapshot, error) {
+	snapshot := &SchemaSnapshot{Tables: make(map[string]*TableSchema)}
+	err := queryEach(ctx, db, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' AND TABLE_NAME NOT IN (?, ?, ?)",
+		[]interface{}{migrationVersionTable, MigrationLockTable, SeedVersionTable}, func(rows *sql.Rows) error {
+			var tableName string
+			err := rows.Scan(&tableName)
+			snapshot.getTable(tableName)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = queryEach(ctx, db, "SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE()",
+		nil, func(rows *sql.Rows) error {
+			var tableName, nullable string
+			var column ColumnSchema
+			err := rows.Scan(&tableName, &column.Name, &column.Type, &nullable)
+			column.Type = strings.ToUpper(column.Type)
+			column.Nullable = nullable == "YES"
+			if table, ok := snapshot.Tables[tableName]; ok {
+				table.Columns[column.Name] = column
+			}
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = queryEach(ctx, db, "SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() "+
+		"ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX", nil, func(rows *sql.Rows) error {
+		var tableName, indexName, columnName string
+		var nonUnique int
+		err := rows.Scan(&tableName, &indexName, &nonUnique, &columnName)
+		if table, ok := snapshot.Tables[tableName]; ok {
+			index := table.Indexes[indexName]
+			index.Name = indexName
+			index.Unique = nonUnique == 0
+			index.Columns = append(index.Columns, columnName)
+			table.Indexes[indexName] = index
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func queryEach(ctx context.Context, db *sql.DB, query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	values := make([]string, 0)
+	err := queryEach(ctx, db, query, args, func(rows *sql.Rows) error {
+		var value string
+		err := rows.Scan(&value)
+		values = append(values, value)
+		return err
+	})
+	return values, err
+}
+
+// CompareSchemas lists the differences of live from expected
+func CompareSchemas(expected, live *SchemaSnapshot) *SchemaDrift {
+	drift := &SchemaDrift{}
+	for name, expectedTable := range expected.Tables {
+		liveTable, ok := live.Tables[name]
+		if !ok {
+			drift.MissingTables = append(drift.MissingTables, name)
+			continue
+		}
+		for columnName, column := range expectedTable.Columns {
+			liveColumn, ok := liveTable.Columns[columnName]
+			switch {
+			case !ok:
+				drift.MissingColumns = append(drift.MissingColumns, name+"."+columnName)
+			case liveColumn != column:
+				drift.ChangedColumns = append(drift.ChangedColumns, fmt.Sprintf("%s.%s: %s -> %s", name, columnName, column, liveColumn))
+			}
+		}
+		for columnName := range liveTable.Columns {
+			if _, ok := expectedTable.Columns[columnName]; !ok {
+				drift.ExtraColumns = append(drift.ExtraColumns, name+"."+columnName)
+			}
+		}
+		for indexName, index := range expectedTable.Indexes {
+			liveIndex, ok := liveTable.Indexes[indexName]
+			switch {
+			case !ok:
+				drift.MissingIndexes = append(drift.MissingIndexes, name+"."+indexName)
+			case liveIndex.String() != index.String():
+				drift.ChangedIndexes = append(drift.ChangedIndexes, fmt.Sprintf("%s.%s: %s -> %s", name, indexName, index, liveIndex))
+			}
+		}
+		for indexName := range liveTable.Indexes {
+			if _, ok := expectedTable.Indexes[indexName]; !ok {
+				drift.ExtraIndexes = append(drift.ExtraIndexes, name+"."+indexName)
+			}
+		}
+	}
+	for name := range live.Tables {
+		if _, ok := expected.Tables[name]; !ok {
+			drift.ExtraTables = append(drift.ExtraTables, name)
+		}
+	}
+	for _, list := range [][]string{drift.MissingTables, drift.ExtraTables, drift.MissingColumns, drift.ExtraColumns, drift.ChangedColumns,
+		drift.MissingIndexes, drift.ExtraIndexes, drift.ChangedIndexes} {
+		sort.Strings(list)
+	}
+	return drift
+}
+
+// DetectSchemaDrift applies the migrations in migrationSource to a scratch DB, in-memory for SQLite and a temporary schema for MySQL,
+// and compares its schema to that of the live db
+func DetectSchemaDrift(ctx context.Context, db *sql.DB, dbConfig config.RelationalDatabaseConfig, migrationSource string) (*SchemaDrift, error) {
+	dialect := dbConfig.GetDBDialect()
+	live, err := IntrospectSchema(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	var expected *SchemaSnapshot
+	switch dialect {
+	case config.SQLite3Dialect:
+		expected, err = getExpectedSQLiteSchema(ctx, migrationSource)
+	case config.MySQLDialect:
+		expected, err = getExpectedMySQLSchema(ctx, db, dbConfig.GetDBConnectionURL(), migrationSource)
+	default:
+		err = ErrUnsupportedDialect
+	}
+	if err != nil {
+		return nil, err
+	}
+	return CompareSchemas(expected, live), nil
+}
+
+func getExpectedSQLiteSchema(ctx context.Context, migrationSource string) (*SchemaSnapshot, error) {
+	scratchDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer scratchDB.Close()
+	// every connection to :memory: is a new DB, so the scratch DB must live on a single connection
+	scratchDB.SetMaxOpenConns(1)
+	scratchDB.SetMaxIdleConns(1)
+	scratchDB.SetConnMaxLifetime(0)
+	scratchDB.SetConnMaxIdleTime(0)
+	driver, err := migrate_sqlite3.WithInstance(scratchDB, &migrate_sqlite3.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err = applyScratchMigrations(migrationSource, string(config.SQLite3Dialect), driver); err != nil {
+		return nil, err
+	}
+	return introspectSQLite(ctx, scratchDB)
+}
+
+func getExpectedMySQLSchema(ctx context.Context, db *sql.DB, connectionURL, migrationSource string) (*SchemaSnapshot, error) {
+	mysqlConfig, err := mysql.ParseDSN(connectionURL)
+	if err != nil {
+		return nil, err
+	}
+	mysqlConfig.DBName = "drift_" + xid.New().String()
+	if _, err = db.ExecContext(ctx, "CREATE DATABASE "+quoteIdentifier(mysqlConfig.DBName)); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _, dropErr := db.ExecContext(context.Background(), "DROP DATABASE "+quoteIdentifier(mysqlConfig.DBName)); dropErr != nil {
+			log.Error().Err(dropErr).Str("schema", mysqlConfig.DBName).Msg("could not drop scratch schema")
+		}
+	}()
+	scratchDB, err := sql.Open(string(config.MySQLDialect), mysqlConfig.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	defer scratchDB.Close()
+	driver, err := migrate_mysql.WithInstance(scratchDB, &migrate_mysql.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err = applyScratchMigrations(migrationSource, string(config.MySQLDialect), driver); err != nil {
+		return nil, err
+	}
+	return introspectMySQL(ctx, scratchDB)
+}
+
+func applyScratchMigrations(migrationSource, dialect string, driver database.Driver) error {
+	migration, err := getMigration(migrationSource, dialect, driver)
+	if err != nil {
+		return err
+	}
+	if err = migration.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+// ExecuteSchemaDriftCLIMode checks schema drift when requested with the `-check-schema-drift` CLI flag; ran is false if it was not
+// requested, else the application is expected to exit after it. ErrSchemaDrift is returned if drift is found. NewMigrationConfig
+// disables migration in this mode so that the DB is not migrated before it is checked.
+func ExecuteSchemaDriftCLIMode(ctx context.Context, cliConfig *config.CLIConfig, db *sql.DB, dbConfig config.RelationalDatabaseConfig) (ran bool, err error) {
+	if !cliConfig.CheckSchemaDrift {
+		return false, nil
+	}
+	if !cliConfig.IsMigrationEnabled() {
+		return true, ErrMigrationSourceRequired
+	}
+	drift, err := DetectSchemaDrift(ctx, db, dbConfig, cliConfig.MigrationSource)
+	if err != nil {
+		return true, err
+	}
+	if drift.HasDrift() {
+		log.Warn().Interface("drift", drift).Msg("db schema drifted from migrations")
+		return true, ErrSchemaDrift
+	}
+	log.Info().Msg("db schema matches migrations")
+	return true, nil
+}
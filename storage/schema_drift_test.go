@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func getMigratedSQLiteDB(t *testing.T, dir string) (*sql.DB, *config.Config) {
+	dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "drift.sqlite3")}
+	db, err := CreateDBConnectionPool(dbConfig)
+	assert.Nil(t, err)
+	assert.Nil(t, runMigration(db, dbConfig, defaultMigrationConf))
+	return db, dbConfig
+}
+
+func TestDetectSchemaDrift(t *testing.T) {
+	t.Run("NoDrift", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "drift")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		db, dbConfig := getMigratedSQLiteDB(t, dir)
+		defer db.Close()
+		drift, err := DetectSchemaDrift(context.Background(), db, dbConfig, defaultMigrationConf.MigrationSource)
+		assert.Nil(t, err)
+		assert.False(t, drift.HasDrift())
+	})
+	t.Run("Drift", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "drift")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		db, dbConfig := getMigratedSQLiteDB(t, dir)
+		defer db.Close()
+		for _, ddl := range []string{
+			"ALTER TABLE `test` ADD COLUMN `extra` INTEGER",
+			"CREATE TABLE `unmanaged` (`id` INTEGER PRIMARY KEY)",
+			"DROP TABLE `stream_test`",
+			"DROP INDEX `outbox_test_pending_idx`",
+			"CREATE INDEX `test_name_idx` ON `test` (`name`)",
+			"DROP INDEX `job_queue_test_lease_idx`",
+			"CREATE UNIQUE INDEX `job_queue_test_lease_idx` ON `job_queue_test` (`queue`)",
+		} {
+			_, err = db.Exec(ddl)
+			assert.Nil(t, err)
+		}
+		drift, err := DetectSchemaDrift(context.Background(), db, dbConfig, defaultMigrationConf.MigrationSource)
+		assert.Nil(t, err)
+		assert.True(t, drift.HasDrift())
+		assert.Equal(t, []string{"stream_test"}, drift.MissingTables)
+		assert.Equal(t, []string{"unmanaged"}, drift.ExtraTables)
+		assert.Equal(t, []string{"test.extra"}, drift.ExtraColumns)
+		assert.Empty(t, drift.MissingColumns)
+		assert.Equal(t, []string{"outbox_test.outbox_test_pending_idx"}, drift.MissingIndexes)
+		assert.Equal(t, []string{"test.test_name_idx"}, drift.ExtraIndexes)
+		assert.Equal(t, 1, len(drift.ChangedIndexes))
+		assert.Regexp(t, "^job_queue_test.job_queue_test_lease_idx: \\(.*\\) -> UNIQUE \\(queue\\)$", drift.ChangedIndexes[0])
+	})
+	t.Run("UnsupportedDialect", func(t *testing.T) {
+		_, err := DetectSchemaDrift(context.Background(), testDB, &config.Config{DBDialect: "postgres"}, defaultMigrationConf.MigrationSource)
+		assert.Equal(t, ErrUnsupportedDialect, err)
+	})
+}
+
+func TestCompareSchemas(t *testing.T) {
+	expected := &SchemaSnapshot{Tables: make(map[string]*TableSchema)}
+	expected.getTable("t").Columns["a"] = ColumnSchema{Name: "a", Type: "INTEGER"}
+	expected.getTable("t").Columns["b"] = ColumnSchema{Name: "b", Type: "TEXT"}
+	live := &SchemaSnapshot{Tables: make(map[string]*TableSchema)}
+	live.getTable("t").Columns["a"] = ColumnSchema{Name: "a", Type: "INTEGER", Nullable: true}
+	drift := CompareSchemas(expected, live)
+	assert.Equal(t, []string{"t.b"}, drift.MissingColumns)
+	assert.Equal(t, []string{"t.a: INTEGER NOT NULL -> INTEGER NULL"}, drift.ChangedColumns)
+	assert.False(t, CompareSchemas(expected, expected).HasDrift())
+}
+
+func TestIntrospectMySQLSchema(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM information_schema.TABLES")).WithArgs(migrationVersionTable, MigrationLockTable, SeedVersionTable).
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow("users"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM information_schema.COLUMNS")).WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME",
+		"COLUMN_TYPE", "IS_NULLABLE"}).AddRow("users", "id", "varchar(255)", "NO").AddRow("users", "email", "varchar(255)", "YES").
+		AddRow("schema_migrations", "version", "bigint", "NO"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM information_schema.STATISTICS")).WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "INDEX_NAME",
+		"NON_UNIQUE", "COLUMN_NAME"}).AddRow("users", "PRIMARY", 0, "id").AddRow("users", "users_email_idx", 1, "email").
+		AddRow("users", "users_email_idx", 1, "id"))
+	snapshot, err := IntrospectSchema(context.Background(), db, config.MySQLDialect)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, len(snapshot.Tables))
+	users := snapshot.Tables["users"]
+	assert.Equal(t, ColumnSchema{Name: "id", Type: "VARCHAR(255)"}, users.Columns["id"])
+	assert.True(t, users.Columns["email"].Nullable)
+	assert.Equal(t, IndexSchema{Name: "PRIMARY", Columns: []string{"id"}, Unique: true}, users.Indexes["PRIMARY"])
+	assert.Equal(t, IndexSchema{Name: "users_email_idx", Columns: []string{"email", "id"}}, users.Indexes["users_email_idx"])
+}
+
+func TestExecuteSchemaDriftCLIMode(t *testing.T) {
+	dbConfig := &config.Config{DBDialect: config.SQLite3Dialect}
+	ran, err := ExecuteSchemaDriftCLIMode(context.Background(), &config.CLIConfig{}, testDB, dbConfig)
+	assert.False(t, ran)
+	assert.Nil(t, err)
+	ran, err = ExecuteSchemaDriftCLIMode(context.Background(), &config.CLIConfig{CheckSchemaDrift: true}, testDB, dbConfig)
+	assert.True(t, ran)
+	assert.Equal(t, ErrMigrationSourceRequired, err)
+	cliConfig := &config.CLIConfig{CheckSchemaDrift: true, MigrationSource: defaultMigrationConf.MigrationSource}
+	assert.False(t, NewMigrationConfig(cliConfig).MigrationEnabled)
+	ran, err = ExecuteSchemaDriftCLIMode(context.Background(), cliConfig, testDB, dbConfig)
+	assert.True(t, ran)
+	assert.Nil(t, err)
+	dir, err := ioutil.TempDir("", "drift-cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db, _ := getMigratedSQLiteDB(t, dir)
+	defer db.Close()
+	_, err = db.Exec("DROP TABLE `lock_test`")
+	assert.Nil(t, err)
+	ran, err = ExecuteSchemaDriftCLIMode(context.Background(), cliConfig, db, dbConfig)
+	assert.True(t, ran)
+	assert.Equal(t, ErrSchemaDrift, err)
+}
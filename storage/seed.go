@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SeedVersionTable tracks the applied seed files; it is created by ApplySeeds
+	SeedVersionTable = "schema_seeds"
+)
+
+var (
+	// ErrInvalidSeedFile is returned when a seed file is not a mapping of table names to rows, or a CSV without a header
+	ErrInvalidSeedFile = errors.New("seed file must map table names to lists of rows")
+	// ErrDuplicateSeedVersion is returned when more than one seed file has the same version
+	ErrDuplicateSeedVersion = errors.New("duplicate seed version")
+
+	seedFilePattern = regexp.MustCompile("^([0-9]+)_(.*)\\.(yaml|yml|json|csv)$")
+)
+
+// SeedFile is a versioned seed file in a seed directory, named `<version>_<name>.<yaml|yml|json|csv>`
+type SeedFile struct {
+	Version  uint64
+	Name     string
+	Path     string
+	Checksum string
+}
+
+// ReadSeedFile reads the rows of a YAML, JSON or CSV seed file as batches to upsert. YAML and JSON map table names either to a list of
+// rows, keyed by their first column, or to a mapping of `key`, the list of conflict columns, and `rows`, e.g.
+//
+//	roles:
+//	  - id: admin
+//	    name: Administrator
+//	settings:
+//	  key: [name, environment]
+//	  rows:
+//	    - name: theme
+//	      environment: dev
+//	      value: dark
+//
+// Each row maps column names to values. A CSV seeds the table named in its file name, without the version prefix if any; its header
+// lists the columns, the first being the key, and empty cells are NULL. Consecutive rows of a table with the same columns are grouped in
+// a batch.
+func ReadSeedFile(path string) ([]*Batch, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		table := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if matches := seedFilePattern.FindStringSubmatch(filepath.Base(path)); matches != nil {
+			table = matches[2]
+		}
+		return readCSVSeed(table, content)
+	}
+	return readYAMLSeed(content)
+}
+
+func readCSVSeed(table string, content []byte) ([]*Batch, error) {
+	records, err := csv.NewReader(strings.NewReader(string(content))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || len(records[0]) == 0 {
+		return nil, ErrInvalidSeedFile
+	}
+	columns := records[0]
+	batch := &Batch{Table: table, Columns: columns, ConflictColumns: columns[:1]}
+	for _, record := range records[1:] {
+		row := make([]interface{}, len(record))
+		for index, value := range record {
+			if len(value) > 0 {
+				row[index] = value
+			}
+		}
+		batch.Rows = append(batch.Rows, row)
+	}
+	return []*Batch{batch}, nil
+}
+
+func readYAMLSeed(content []byte) ([]*Batch, error) {
+	batches, err := ReadBatches(content, true)
+	if err == ErrInvalidBatchRows {
+		return nil, ErrInvalidSeedFile
+	}
+	return batches, err
+}
+
+// ReadSeedDir lists the seed files in dir ordered by version
+func ReadSeedDir(dir string) ([]*SeedFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	seeds := make([]*SeedFile, 0)
+	versions := make(map[uint64]bool)
+	for _, entry := range entries {
+		matches := seedFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if versions[version] {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateSeedVersion, version)
+		}
+		versions[version] = true
+		path := filepath.Join(dir, entry.Name())
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		checksum := sha256.Sum256(content)
+		seeds = append(seeds, &SeedFile{Version: version, Name: entry.Name(), Path: path, Checksum: hex.EncodeToString(checksum[:])})
+	}
+	sort.Slice(seeds, func(i, j int) bool { return seeds[i].Version < seeds[j].Version })
+	return seeds, nil
+}
+
+// ApplySeeds upserts the seed files in dir that were not applied yet, or changed since, in order of version. Each file is applied and
+// recorded in SeedVersionTable in its own transaction, so re-running after a failure resumes with the failed file.
+func ApplySeeds(db *sql.DB, dialect config.DBDialect, dir string) (applied []*SeedFile, err error) {
+	seeds, err := ReadSeedDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(getSeedTableDDL()); err != nil {
+		return nil, err
+	}
+	checksums, err := getAppliedSeedChecksums(db)
+	if err != nil {
+		return nil, err
+	}
+	applied = make([]*SeedFile, 0)
+	for _, seed := range seeds {
+		if checksum, ok := checksums[seed.Version]; ok && checksum == seed.Checksum {
+			continue
+		}
+		batches, err := ReadSeedFile(seed.Path)
+		if err != nil {
+			return applied, err
+		}
+		err = ExecuteOpsInTransaction(db, func(tx *sql.Tx) error {
+			for _, batch := range batches {
+				if _, err := BatchUpsertInTransaction(tx, dialect, batch); err != nil {
+					return err
+				}
+			}
+			_, err := BatchUpsertInTransaction(tx, dialect, &Batch{Table: SeedVersionTable, Columns: []string{"version", "name", "checksum", "appliedAt"},
+				Rows: [][]interface{}{{seed.Version, seed.Name, seed.Checksum, time.Now().UTC()}}, ConflictColumns: []string{"version"}})
+			return err
+		})
+		if err != nil {
+			return applied, err
+		}
+		log.Info().Uint64("version", seed.Version).Str("name", seed.Name).Msg("seed applied")
+		applied = append(applied, seed)
+	}
+	return applied, nil
+}
+
+func getSeedTableDDL() string {
+	return "CREATE TABLE IF NOT EXISTS " + quoteIdentifier(SeedVersionTable) + " (\n" +
+		"    `version` BIGINT NOT NULL PRIMARY KEY,\n" +
+		"    `name` VARCHAR(255) NOT NULL,\n" +
+		"    `checksum` VARCHAR(64) NOT NULL,\n" +
+		"    `appliedAt` DATETIME NOT NULL\n" +
+		")"
+}
+
+func getAppliedSeedChecksums(db *sql.DB) (map[uint64]string, error) {
+	rows, err := db.Query("SELECT `version`, `checksum` FROM " + quoteIdentifier(SeedVersionTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	checksums := make(map[uint64]string)
+	for rows.Next() {
+		var version uint64
+		var checksum string
+		if err = rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		checksums[version] = checksum
+	}
+	return checksums, rows.Err()
+}
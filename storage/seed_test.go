@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	seedLocation = "./test-seed"
+)
+
+func copySeeds(t *testing.T, dir string) {
+	seeds, err := ioutil.ReadDir(seedLocation)
+	assert.Nil(t, err)
+	for _, seed := range seeds {
+		content, err := ioutil.ReadFile(filepath.Join(seedLocation, seed.Name()))
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, seed.Name()), content, 0644))
+	}
+}
+
+func getNote(t *testing.T, db queryRower, id string) string {
+	var note string
+	assert.Nil(t, db.QueryRow("SELECT note FROM test WHERE id = ?", id).Scan(&note))
+	return note
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func TestReadSeedFile(t *testing.T) {
+	batches, err := ReadSeedFile(filepath.Join(seedLocation, "000001_test.csv"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(batches))
+	assert.Equal(t, "test", batches[0].Table)
+	assert.Equal(t, []string{"id"}, batches[0].ConflictColumns)
+	assert.Equal(t, 2, len(batches[0].Rows))
+	batches, err = ReadSeedFile(filepath.Join(seedLocation, "000002_lock_test.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"owner", "name", "fencingToken", "expiresAt"}, batches[0].Columns)
+	assert.Equal(t, []string{"name"}, batches[0].ConflictColumns)
+	dir, err := ioutil.TempDir("", "seed-file")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{"list.yaml": "- id: 1", "rows.yaml": "test:\n  id: 1", "empty.csv": "",
+		"scalar.json": "{\"test\": [1]}"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+		_, err = ReadSeedFile(path)
+		assert.Equal(t, ErrInvalidSeedFile, err, name)
+	}
+	csvPath := filepath.Join(dir, "users.csv")
+	assert.Nil(t, ioutil.WriteFile(csvPath, []byte("id,email\n1,\n"), 0644))
+	batches, err = ReadSeedFile(csvPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "users", batches[0].Table)
+	assert.Equal(t, []interface{}{"1", nil}, batches[0].Rows[0])
+	_, err = ReadSeedFile(filepath.Join(dir, "missing.yaml"))
+	assert.NotNil(t, err)
+}
+
+func TestApplySeeds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seed")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	seedDir := filepath.Join(dir, "seeds")
+	assert.Nil(t, os.Mkdir(seedDir, 0755))
+	copySeeds(t, seedDir)
+	dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "seed.sqlite3")}
+	db, err := CreateDBConnectionPool(dbConfig)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, runMigration(db, dbConfig, defaultMigrationConf))
+	applied, err := ApplySeeds(db, config.SQLite3Dialect, seedDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(applied))
+	assert.Equal(t, "from json", getNote(t, db, "seed-1"))
+	assert.Equal(t, "from csv", getNote(t, db, "seed-2"))
+	var owner string
+	assert.Nil(t, db.QueryRow("SELECT owner FROM lock_test WHERE name = ?", "seed-lock").Scan(&owner))
+	assert.Equal(t, "seed", owner)
+	applied, err = ApplySeeds(db, config.SQLite3Dialect, seedDir)
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(seedDir, "000001_test.csv"),
+		[]byte("id,name,note,createdAt,updatedAt\nseed-2,second,changed,2022-03-28 12:00:00,2022-03-28 12:00:00\n"), 0644))
+	applied, err = ApplySeeds(db, config.SQLite3Dialect, seedDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(applied))
+	assert.Equal(t, uint64(1), applied[0].Version)
+	assert.Equal(t, "changed", getNote(t, db, "seed-2"))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(seedDir, "000004_missing_table.yaml"), []byte("missing_table:\n  - id: 1\n"), 0644))
+	applied, err = ApplySeeds(db, config.SQLite3Dialect, seedDir)
+	assert.NotNil(t, err)
+	assert.Empty(t, applied)
+	var count int
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM "+SeedVersionTable).Scan(&count))
+	assert.Equal(t, 3, count)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(seedDir, "000004_duplicate.json"), []byte("{}"), 0644))
+	_, err = ApplySeeds(db, config.SQLite3Dialect, seedDir)
+	assert.True(t, errors.Is(err, ErrDuplicateSeedVersion))
+}
+
+func TestSeedAfterMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seed-migration")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "seed.sqlite3")}
+	db, err := CreateDBConnectionPool(dbConfig)
+	assert.Nil(t, err)
+	defer db.Close()
+	seedDir, _ := filepath.Abs(seedLocation)
+	migrationConf := NewMigrationConfig(&config.CLIConfig{MigrationSource: defaultMigrationConf.MigrationSource, SeedDir: seedDir})
+	assert.Nil(t, runMigration(db, dbConfig, migrationConf))
+	assert.Equal(t, "from json", getNote(t, db, "seed-1"))
+	assert.Equal(t, MigrationComplete, GetMigrationState())
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	softDeleteFilter = "`" + deletedAtColumn + "` IS NULL"
+	// DefaultPurgeBatchSize is the number of rows deleted per statement when purging soft deleted rows
+	DefaultPurgeBatchSize = 500
+	// DefaultPurgeInterval is used when the purger has no Interval
+	DefaultPurgeInterval = time.Hour
+)
+
+var (
+	// GetSoftDeleteFilterFragment generates the `deletedAt IS NULL` filter to exclude soft deleted rows; empty if includeDeleted. It
+	// follows the same append semantics as GetPaginationQueryFragmentWithConfigurablePageSize.
+	GetSoftDeleteFilterFragment = func(includeDeleted bool, append bool) string {
+		if includeDeleted {
+			return ""
+		}
+		if append {
+			return " AND " + softDeleteFilter
+		}
+		return " WHERE " + softDeleteFilter
+	}
+
+	// PurgeSoftDeleted hard deletes rows of the table soft deleted before the retention period, batchSize rows per transaction, and
+	// returns the number of rows removed
+	PurgeSoftDeleted = func(ctx context.Context, db *sql.DB, dialect config.DBDialect, table string, retention time.Duration, batchSize int) (int64, error) {
+		if !isValidIdentifier(table) {
+			return 0, ErrInvalidIdentifier
+		}
+		if batchSize <= 0 {
+			batchSize = DefaultPurgeBatchSize
+		}
+		query := getPurgeQuery(dialect, table, batchSize)
+		cutOff := time.Now().Add(-1 * retention).UTC()
+		var purged int64
+		for {
+			if err := ctx.Err(); err != nil {
+				return purged, err
+			}
+			var deleted int64
+			err := ExecuteOpsInTransaction(db, func(tx *sql.Tx) error {
+				result, err := tx.ExecContext(ctx, query, cutOff)
+				if err == nil {
+					deleted, err = result.RowsAffected()
+				}
+				return err
+			})
+			purged += deleted
+			if err != nil || deleted < int64(batchSize) {
+				return purged, err
+			}
+		}
+	}
+)
+
+func getPurgeQuery(dialect config.DBDialect, table string, batchSize int) string {
+	quotedTable := quoteIdentifier(table)
+	condition := "`" + deletedAtColumn + "` IS NOT NULL AND `" + deletedAtColumn + "` < ?"
+	switch dialect {
+	case config.MySQLDialect:
+		return "DELETE FROM " + quotedTable + " WHERE " + condition + " LIMIT " + strconv.Itoa(batchSize)
+	default:
+		return "DELETE FROM " + quotedTable + " WHERE `" + idColumn + "` IN (SELECT `" + idColumn + "` FROM " + quotedTable + " WHERE " + condition + " LIMIT " + strconv.Itoa(batchSize) + ")"
+	}
+}
+
+// SoftDeletePurger periodically purges soft deleted rows older than the retention from the tables
+type SoftDeletePurger struct {
+	DB        *sql.DB
+	Dialect   config.DBDialect
+	Tables    []string
+	Retention time.Duration
+	Interval  time.Duration
+	BatchSize int
+	worker    periodicWorker
+}
+
+// Start runs the purge every Interval, or DefaultPurgeInterval if not set, in background until Stop is called
+func (purger *SoftDeletePurger) Start() error {
+	interval := purger.Interval
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+	return purger.worker.start(interval, purger.PurgeOnce)
+}
+
+// Stop stops the background purge and waits for any purge in progress to abort
+func (purger *SoftDeletePurger) Stop() {
+	purger.worker.stop()
+}
+
+// PurgeOnce purges all tables once
+func (purger *SoftDeletePurger) PurgeOnce(ctx context.Context) {
+	for _, table := range purger.Tables {
+		purged, err := PurgeSoftDeleted(ctx, purger.DB, purger.Dialect, table, purger.Retention, purger.BatchSize)
+		if err != nil {
+			log.Error().Err(err).Str("table", table).Int64("purged", purged).Msg("could not purge soft deleted rows")
+		} else if purged > 0 {
+			log.Info().Str("table", table).Int64("purged", purged).Msg("purged soft deleted rows")
+		}
+	}
+}
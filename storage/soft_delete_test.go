@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/stretchr/testify/assert"
+)
+
+type softDeleteTestModel struct {
+	data.BasePaginateable
+	data.SoftDeletable
+	Name string `db:"name"`
+}
+
+func (model *softDeleteTestModel) IsInValidState() bool {
+	return len(model.Name) > 0
+}
+
+func getSoftDeleteTestRepository(t *testing.T) *Repository {
+	repo, err := NewRepository(testDB, "soft_delete_test", &softDeleteTestModel{})
+	assert.Nil(t, err)
+	assert.True(t, repo.IsSoftDeleteEnabled())
+	return repo
+}
+
+func TestGetSoftDeleteFilterFragment(t *testing.T) {
+	assert.Equal(t, "", GetSoftDeleteFilterFragment(true, true))
+	assert.Equal(t, " WHERE `deletedAt` IS NULL", GetSoftDeleteFilterFragment(false, false))
+	assert.Equal(t, " AND `deletedAt` IS NULL", GetSoftDeleteFilterFragment(false, true))
+}
+
+func TestGetPurgeQuery(t *testing.T) {
+	assert.Equal(t, "DELETE FROM `t` WHERE `deletedAt` IS NOT NULL AND `deletedAt` < ? LIMIT 10", getPurgeQuery(config.MySQLDialect, "t", 10))
+	assert.Equal(t, "DELETE FROM `t` WHERE `id` IN (SELECT `id` FROM `t` WHERE `deletedAt` IS NOT NULL AND `deletedAt` < ? LIMIT 10)", getPurgeQuery(config.SQLite3Dialect, "t", 10))
+}
+
+func TestRepositorySoftDelete(t *testing.T) {
+	repo := getSoftDeleteTestRepository(t)
+	model := &softDeleteTestModel{Name: "soft"}
+	assert.Nil(t, repo.Create(model))
+	assert.Nil(t, repo.Delete(model.ID))
+	assert.ErrorIs(t, repo.Delete(model.ID), ErrNotFound)
+	assert.ErrorIs(t, repo.Get(model.ID, &softDeleteTestModel{}), ErrNotFound)
+	deleted := &softDeleteTestModel{}
+	assert.Nil(t, repo.IncludingDeleted().Get(model.ID, deleted))
+	assert.True(t, deleted.IsDeleted())
+	rows := make([]*softDeleteTestModel, 0)
+	_, err := repo.List(nil, LargePageSize, &rows)
+	assert.Nil(t, err)
+	for _, row := range rows {
+		assert.NotEqual(t, model.ID, row.ID)
+	}
+	assert.Nil(t, repo.Restore(model.ID))
+	assert.ErrorIs(t, repo.Restore(model.ID), ErrNotFound)
+	restored := &softDeleteTestModel{}
+	assert.Nil(t, repo.Get(model.ID, restored))
+	assert.False(t, restored.IsDeleted())
+	assert.Nil(t, repo.HardDelete(model.ID))
+	assert.ErrorIs(t, repo.IncludingDeleted().Get(model.ID, &softDeleteTestModel{}), ErrNotFound)
+	plainRepo := getTestRepository(t)
+	assert.False(t, plainRepo.IsSoftDeleteEnabled())
+	assert.Equal(t, ErrSoftDeleteNotEnabled, plainRepo.Restore(model.ID))
+}
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	repo := getSoftDeleteTestRepository(t)
+	old := &softDeleteTestModel{Name: "old"}
+	recent := &softDeleteTestModel{Name: "recent"}
+	assert.Nil(t, repo.Create(old))
+	assert.Nil(t, repo.Create(recent))
+	assert.Nil(t, repo.Delete(old.ID))
+	assert.Nil(t, repo.Delete(recent.ID))
+	_, err := testDB.Exec("UPDATE `soft_delete_test` SET `deletedAt` = ? WHERE `id` = ?", time.Now().Add(-48*time.Hour).UTC(), old.ID)
+	assert.Nil(t, err)
+	_, err = PurgeSoftDeleted(context.Background(), testDB, config.SQLite3Dialect, "soft_delete_test; --", time.Hour, 1)
+	assert.Equal(t, ErrInvalidIdentifier, err)
+	purged, err := PurgeSoftDeleted(context.Background(), testDB, config.SQLite3Dialect, "soft_delete_test", 24*time.Hour, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.ErrorIs(t, repo.IncludingDeleted().Get(old.ID, &softDeleteTestModel{}), ErrNotFound)
+	assert.Nil(t, repo.IncludingDeleted().Get(recent.ID, &softDeleteTestModel{}))
+	purger := &SoftDeletePurger{DB: testDB, Dialect: config.SQLite3Dialect, Tables: []string{"soft_delete_test"}, Retention: 0, Interval: 10 * time.Millisecond}
+	assert.Nil(t, purger.Start())
+	assert.NotNil(t, purger.Start())
+	time.Sleep(100 * time.Millisecond)
+	purger.Stop()
+	purger.Stop()
+	assert.ErrorIs(t, repo.IncludingDeleted().Get(recent.ID, &softDeleteTestModel{}), ErrNotFound)
+	zeroInterval := &SoftDeletePurger{DB: testDB, Dialect: config.SQLite3Dialect, Tables: []string{"soft_delete_test"}}
+	assert.Nil(t, zeroInterval.Start())
+	zeroInterval.Stop()
+}
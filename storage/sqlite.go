@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/imyousuf/appcommons/config"
+)
+
+var (
+	serializedWriters      = make(map[*sql.DB]*serializedWriter)
+	serializedWritersMutex sync.RWMutex
+
+	// GetSQLiteConnectionURL appends the SQLite tuning of sqliteConfig to connectionURL as driver params, which the driver applies as
+	// PRAGMAs on every new connection. Params already present in connectionURL take precedence.
+	GetSQLiteConnectionURL = func(connectionURL string, sqliteConfig config.SQLiteConfig) string {
+		existing := url.Values{}
+		if index := strings.Index(connectionURL, "?"); index >= 0 {
+			existing, _ = url.ParseQuery(connectionURL[index+1:])
+		}
+		params := url.Values{}
+		addParam := func(value string, keys ...string) {
+			for _, key := range keys {
+				if _, ok := existing[key]; ok {
+					return
+				}
+			}
+			params.Set(keys[0], value)
+		}
+		if journalMode := sqliteConfig.GetSQLiteJournalMode(); len(journalMode) > 0 {
+			addParam(journalMode, "_journal_mode", "_journal")
+		}
+		if synchronous := sqliteConfig.GetSQLiteSynchronous(); len(synchronous) > 0 {
+			addParam(synchronous, "_synchronous", "_sync")
+		}
+		if busyTimeout := sqliteConfig.GetSQLiteBusyTimeout(); busyTimeout > 0 {
+			addParam(strconv.FormatInt(busyTimeout.Milliseconds(), 10), "_busy_timeout", "_timeout")
+		}
+		if cacheSize := sqliteConfig.GetSQLiteCacheSize(); cacheSize != 0 {
+			addParam(strconv.Itoa(cacheSize), "_cache_size")
+		}
+		if len(params) == 0 {
+			return connectionURL
+		}
+		separator := "?"
+		if strings.Contains(connectionURL, "?") {
+			separator = "&"
+		}
+		return connectionURL + separator + params.Encode()
+	}
+)
+
+// serializedWriter lets one transaction of a pool run at a time so that SQLite never sees concurrent writers
+type serializedWriter struct {
+	mutex sync.Mutex
+}
+
+// EnableWriteSerialization makes ExecuteOpsInTransaction run transactions on db one at a time. Each transaction uses a connection
+// from the pool only while it runs, so reads outside transactions are not limited. Transactions must not start nested transactions
+// on the same db as that would deadlock.
+func EnableWriteSerialization(db *sql.DB) {
+	serializedWritersMutex.Lock()
+	defer serializedWritersMutex.Unlock()
+	if _, ok := serializedWriters[db]; !ok {
+		serializedWriters[db] = &serializedWriter{}
+	}
+}
+
+// DisableWriteSerialization reverts EnableWriteSerialization; pools created by CreateDBConnectionPool call it when closed
+func DisableWriteSerialization(db *sql.DB) {
+	serializedWritersMutex.Lock()
+	defer serializedWritersMutex.Unlock()
+	delete(serializedWriters, db)
+}
+
+// IsWriteSerializationEnabled checks whether transactions on db are serialized
+func IsWriteSerializationEnabled(db *sql.DB) bool {
+	return getSerializedWriter(db) != nil
+}
+
+func getSerializedWriter(db *sql.DB) *serializedWriter {
+	serializedWritersMutex.RLock()
+	defer serializedWritersMutex.RUnlock()
+	return serializedWriters[db]
+}
+
+func configureWriteSerialization(db *sql.DB, dbConfig config.RelationalDatabaseConfig) {
+	sqliteConfig, ok := dbConfig.(config.SQLiteConfig)
+	if ok && dbConfig.GetDBDialect() == config.SQLite3Dialect && sqliteConfig.IsSQLiteWriteSerializationEnabled() {
+		EnableWriteSerialization(db)
+	} else {
+		DisableWriteSerialization(db)
+	}
+}
+
+func getConnectionURL(dbConfig config.RelationalDatabaseConfig) string {
+	if sqliteConfig, ok := dbConfig.(config.SQLiteConfig); ok && dbConfig.GetDBDialect() == config.SQLite3Dialect {
+		return GetSQLiteConnectionURL(dbConfig.GetDBConnectionURL(), sqliteConfig)
+	}
+	return dbConfig.GetDBConnectionURL()
+}
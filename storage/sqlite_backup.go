@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// BackupPagesPerStep is the number of pages copied at a time, writers can make progress in between steps
+	BackupPagesPerStep           = 256
+	preMigrationBackupTimeFormat = "20060102T150405Z"
+	// defaultMaxIdleConns is the idle limit database/sql applies unless changed
+	defaultMaxIdleConns = 2
+)
+
+var (
+	// ErrBackupNotSupported is returned when backup or restore is requested for a dialect other than SQLite
+	ErrBackupNotSupported = errors.New("online backup is only supported for sqlite3")
+	// ErrNotSQLiteConnection is returned when the DB connection is not backed by the sqlite3 driver
+	ErrNotSQLiteConnection = errors.New("db connection is not a sqlite3 connection")
+	// ErrBackupCorrupt is returned when the file to restore from fails the SQLite integrity check
+	ErrBackupCorrupt = errors.New("backup failed integrity check")
+	// BackupStepInterval is the pause between backup steps
+	BackupStepInterval = 10 * time.Millisecond
+)
+
+// BackupSQLite copies the live DB to destination using the SQLite online backup API without blocking writers for the whole copy.
+// The copy is written next to destination and renamed into place once complete.
+func BackupSQLite(ctx context.Context, db *sql.DB, destination string) error {
+	tempDestination := destination + ".tmp"
+	os.Remove(tempDestination)
+	backupDB, err := sql.Open("sqlite3", tempDestination)
+	if err != nil {
+		return err
+	}
+	err = copySQLite(ctx, backupDB, db)
+	backupDB.Close()
+	if err != nil {
+		os.Remove(tempDestination)
+		return err
+	}
+	return os.Rename(tempDestination, destination)
+}
+
+// RestoreSQLite replaces the content of the live DB with the backup at source. The pool is paused for the duration, i.e. the restore
+// waits for connections in use to be returned to the pool and new queries wait for the restore to finish. The pool limits are
+// restored afterwards; the idle limit is only known for pools created by CreateDBConnectionPool, others get the database/sql default.
+func RestoreSQLite(ctx context.Context, db *sql.DB, source string) error {
+	if _, err := os.Stat(source); err != nil {
+		return err
+	}
+	backupDB, err := sql.Open("sqlite3", source)
+	if err != nil {
+		return err
+	}
+	defer backupDB.Close()
+	var integrity string
+	if err = backupDB.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&integrity); err != nil || integrity != "ok" {
+		log.Error().Err(err).Str("check", integrity).Msg("backup to restore is not usable")
+		return ErrBackupCorrupt
+	}
+	maxOpen, maxIdle := db.Stats().MaxOpenConnections, getMaxIdleConns(db)
+	db.SetMaxOpenConns(1)
+	defer func() {
+		db.SetMaxOpenConns(maxOpen)
+		db.SetMaxIdleConns(maxIdle)
+	}()
+	if err = waitForConnectionsInUse(ctx, db); err != nil {
+		return err
+	}
+	return copySQLite(ctx, db, backupDB)
+}
+
+func getMaxIdleConns(db *sql.DB) int {
+	if connector := getInstrumentedConnector(db); connector != nil {
+		return int(atomic.LoadInt32(&connector.maxIdleConns))
+	}
+	return defaultMaxIdleConns
+}
+
+// waitForConnectionsInUse waits for all connections of db to be returned; with max open lowered to 1 no more than one can be taken
+// afterwards
+func waitForConnectionsInUse(ctx context.Context, db *sql.DB) error {
+	for db.Stats().InUse > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(BackupStepInterval):
+		}
+	}
+	return nil
+}
+
+// copySQLite copies the main DB of srcDB into the main DB of destDB
+func copySQLite(ctx context.Context, destDB, srcDB *sql.DB) error {
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			destSQLiteConn, destOk := getSQLiteConn(destDriverConn)
+			srcSQLiteConn, srcOk := getSQLiteConn(srcDriverConn)
+			if !destOk || !srcOk {
+				return ErrNotSQLiteConnection
+			}
+			backup, err := destSQLiteConn.Backup("main", srcSQLiteConn, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := backup.Step(BackupPagesPerStep)
+				if err != nil || done {
+					finishErr := backup.Finish()
+					if err == nil {
+						err = finishErr
+					}
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					backup.Finish()
+					return ctx.Err()
+				case <-time.After(BackupStepInterval):
+				}
+			}
+		})
+	})
+}
+
+func getSQLiteConn(driverConn interface{}) (*sqlite3.SQLiteConn, bool) {
+	if instrumented, ok := driverConn.(*instrumentedConn); ok {
+		driverConn = instrumented.Conn
+	}
+	sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+	return sqliteConn, ok
+}
+
+// ExecuteBackupCLIMode performs the backup or restore requested with the `-backup` or `-restore` CLI flags; ran is false if neither
+// was requested, else the application is expected to exit after it
+func ExecuteBackupCLIMode(ctx context.Context, cliConfig *config.CLIConfig, db *sql.DB, dialect config.DBDialect) (ran bool, err error) {
+	if !cliConfig.IsBackupMode() && !cliConfig.IsRestoreMode() {
+		return false, nil
+	}
+	if dialect != config.SQLite3Dialect {
+		return true, ErrBackupNotSupported
+	}
+	if cliConfig.IsBackupMode() {
+		err = BackupSQLite(ctx, db, cliConfig.BackupPath)
+		log.Info().Err(err).Str("destination", cliConfig.BackupPath).Msg("db backup")
+	} else {
+		err = RestoreSQLite(ctx, db, cliConfig.RestorePath)
+		log.Info().Err(err).Str("source", cliConfig.RestorePath).Msg("db restore")
+	}
+	return true, err
+}
+
+// backupBeforeMigration backs the DB up in backupDir if migration has migrations yet to be applied
+func backupBeforeMigration(db *sql.DB, migration *migrate.Migrate, migrationSource, backupDir string) error {
+	version, _, err := migration.Version()
+	noVersion := err == migrate.ErrNilVersion
+	if err != nil && !noVersion {
+		return err
+	}
+	pending, err := hasPendingMigration(migrationSource, version, noVersion)
+	if err != nil || !pending {
+		return err
+	}
+	destination := filepath.Join(backupDir, fmt.Sprintf("pre-migration-v%d-%s.sqlite3", version, time.Now().UTC().Format(preMigrationBackupTimeFormat)))
+	log.Info().Str("destination", destination).Msg("backing up db before migration")
+	return BackupSQLite(context.Background(), db, destination)
+}
+
+func hasPendingMigration(migrationSource string, version uint, noVersion bool) (bool, error) {
+	sourceDriver, err := source.Open(migrationSource)
+	if err != nil {
+		return false, err
+	}
+	defer sourceDriver.Close()
+	if noVersion {
+		_, err = sourceDriver.First()
+	} else {
+		_, err = sourceDriver.Next(version)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
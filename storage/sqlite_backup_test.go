@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	var count int
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&count))
+	return count
+}
+
+func TestBackupSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	destination := filepath.Join(dir, "backup.sqlite3")
+	assert.Nil(t, BackupSQLite(context.Background(), testDB, destination))
+	backupDB, err := sql.Open("sqlite3", destination)
+	assert.Nil(t, err)
+	defer backupDB.Close()
+	assert.Equal(t, countRows(t, testDB, "test"), countRows(t, backupDB, "test"))
+	_, err = os.Stat(destination + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, BackupSQLite(ctx, testDB, filepath.Join(dir, "cancelled.sqlite3")))
+}
+
+func TestRestoreSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "live.sqlite3"), DBMaxOpenConnections: 4,
+		DBMaxIdleConnections: 3, SQLiteSerializeWrites: true}
+	db, err := CreateDBConnectionPool(dbConfig)
+	assert.Nil(t, err)
+	defer db.Close()
+	defer DisableWriteSerialization(db)
+	insert := func(id int) {
+		assert.Nil(t, ExecuteOpsInTransaction(db, func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO restore_test (id) VALUES (?)", id)
+			return err
+		}))
+	}
+	_, err = db.Exec("CREATE TABLE restore_test (id INTEGER PRIMARY KEY)")
+	assert.Nil(t, err)
+	insert(1)
+	backup := filepath.Join(dir, "backup.sqlite3")
+	assert.Nil(t, BackupSQLite(context.Background(), db, backup))
+	insert(2)
+	assert.Equal(t, 2, countRows(t, db, "restore_test"))
+	inFlight, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = inFlight.Exec("INSERT INTO restore_test (id) VALUES (?)", 4)
+	assert.Nil(t, err)
+	restored := make(chan error, 1)
+	go func() { restored <- RestoreSQLite(context.Background(), db, backup) }()
+	select {
+	case <-restored:
+		assert.Fail(t, "restore did not wait for the transaction in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Nil(t, inFlight.Commit())
+	assert.Nil(t, <-restored)
+	assert.Equal(t, 1, countRows(t, db, "restore_test"))
+	assert.True(t, IsWriteSerializationEnabled(db))
+	assert.Equal(t, 4, db.Stats().MaxOpenConnections)
+	conns := make([]*sql.Conn, 0, 4)
+	for index := 0; index < 4; index++ {
+		conn, err := db.Conn(context.Background())
+		assert.Nil(t, err)
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	assert.Equal(t, 3, db.Stats().Idle)
+	insert(3)
+	assert.Equal(t, 2, countRows(t, db, "restore_test"))
+	corrupt := filepath.Join(dir, "corrupt.sqlite3")
+	assert.Nil(t, ioutil.WriteFile(corrupt, []byte("not a sqlite database, not a sqlite database, not a sqlite database"), 0600))
+	assert.Equal(t, ErrBackupCorrupt, RestoreSQLite(context.Background(), db, corrupt))
+	assert.NotNil(t, RestoreSQLite(context.Background(), db, filepath.Join(dir, "missing.sqlite3")))
+	assert.Equal(t, 2, countRows(t, db, "restore_test"))
+}
+
+func TestExecuteBackupCLIMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup-cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ran, err := ExecuteBackupCLIMode(context.Background(), &config.CLIConfig{}, testDB, config.SQLite3Dialect)
+	assert.False(t, ran)
+	assert.Nil(t, err)
+	backupConfig := &config.CLIConfig{BackupPath: filepath.Join(dir, "cli.sqlite3")}
+	ran, err = ExecuteBackupCLIMode(context.Background(), backupConfig, testDB, config.MySQLDialect)
+	assert.True(t, ran)
+	assert.Equal(t, ErrBackupNotSupported, err)
+	ran, err = ExecuteBackupCLIMode(context.Background(), backupConfig, testDB, config.SQLite3Dialect)
+	assert.True(t, ran)
+	assert.Nil(t, err)
+	_, err = os.Stat(backupConfig.BackupPath)
+	assert.Nil(t, err)
+}
+
+func TestBackupBeforeMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pre-migration")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	backupDir := filepath.Join(dir, "backups")
+	assert.Nil(t, os.Mkdir(backupDir, 0700))
+	dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: filepath.Join(dir, "migrated.sqlite3")}
+	db, err := CreateDBConnectionPool(dbConfig)
+	assert.Nil(t, err)
+	defer db.Close()
+	migrationConf := NewMigrationConfig(&config.CLIConfig{MigrationSource: defaultMigrationConf.MigrationSource, PreMigrationBackupDir: backupDir})
+	assert.Nil(t, runMigration(db, dbConfig, migrationConf))
+	assert.Nil(t, runMigration(db, dbConfig, migrationConf))
+	backups, err := ioutil.ReadDir(backupDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(backups))
+	assert.Regexp(t, "^pre-migration-v0-.*\\.sqlite3$", backups[0].Name())
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imyousuf/appcommons/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSQLiteConnectionURL(t *testing.T) {
+	tuning := &config.Config{SQLiteJournalMode: "WAL", SQLiteSynchronous: "NORMAL", SQLiteBusyTimeout: 5 * time.Second, SQLiteCacheSize: -2000}
+	assert.Equal(t, "database.sqlite3", GetSQLiteConnectionURL("database.sqlite3", &config.Config{}))
+	assert.Equal(t, "database.sqlite3?_busy_timeout=5000&_cache_size=-2000&_journal_mode=WAL&_synchronous=NORMAL",
+		GetSQLiteConnectionURL("database.sqlite3", tuning))
+	assert.Equal(t, "database.sqlite3?_foreign_keys=on&_sync=FULL&_timeout=100&_cache_size=-2000&_journal_mode=WAL",
+		GetSQLiteConnectionURL("database.sqlite3?_foreign_keys=on&_sync=FULL&_timeout=100", tuning))
+}
+
+func TestSQLiteTuningAndWriteSerialization(t *testing.T) {
+	defer os.Remove("sqlite-tuning.sqlite3")
+	defer os.Remove("sqlite-tuning.sqlite3-wal")
+	defer os.Remove("sqlite-tuning.sqlite3-shm")
+	dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: "sqlite-tuning.sqlite3", DBMaxOpenConnections: 5,
+		SQLiteJournalMode: "WAL", SQLiteSynchronous: "NORMAL", SQLiteBusyTimeout: 2 * time.Second, SQLiteSerializeWrites: true}
+	db, err := CreateDBConnectionPool(dbConfig)
+	assert.Nil(t, err)
+	defer db.Close()
+	defer DisableWriteSerialization(db)
+	var journalMode string
+	var busyTimeout, synchronous int
+	assert.Nil(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.Nil(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.Nil(t, db.QueryRow("PRAGMA synchronous").Scan(&synchronous))
+	assert.Equal(t, "wal", journalMode)
+	assert.Equal(t, 2000, busyTimeout)
+	assert.Equal(t, 1, synchronous)
+	assert.True(t, IsWriteSerializationEnabled(db))
+	_, err = db.Exec("CREATE TABLE counter (id INTEGER PRIMARY KEY, value INTEGER)")
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	for index := 0; index < 20; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			assert.Nil(t, ExecuteOpsInTransaction(db, func(tx *sql.Tx) error {
+				var count int
+				if err := tx.QueryRow("SELECT COUNT(*) FROM counter").Scan(&count); err != nil {
+					return err
+				}
+				_, err := tx.Exec("INSERT INTO counter (id, value) VALUES (?, ?)", index, strconv.Itoa(count))
+				return err
+			}))
+		}(index)
+	}
+	wg.Wait()
+	var total, distinct int
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*), COUNT(DISTINCT value) FROM counter").Scan(&total, &distinct))
+	assert.Equal(t, 20, total)
+	assert.Equal(t, 20, distinct)
+	DisableWriteSerialization(db)
+	assert.False(t, IsWriteSerializationEnabled(db))
+	assert.Nil(t, ExecuteOpsInTransaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM counter")
+		return err
+	}))
+	t.Run("SingleConnection", func(t *testing.T) {
+		dbConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBConnectionURL: "sqlite-tuning.sqlite3", DBMaxOpenConnections: 1,
+			SQLiteBusyTimeout: 2 * time.Second, SQLiteSerializeWrites: true}
+		singleDB, err := CreateDBConnectionPool(dbConfig)
+		assert.Nil(t, err)
+		assert.True(t, IsWriteSerializationEnabled(singleDB))
+		var count int
+		assert.Nil(t, ExecuteOpsInTransaction(singleDB, func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO counter (id, value) VALUES (?, ?)", 1, "1")
+			return err
+		}))
+		assert.Nil(t, singleDB.QueryRow("SELECT COUNT(*) FROM counter").Scan(&count))
+		assert.Equal(t, 1, count)
+		assert.Nil(t, singleDB.Close())
+		assert.False(t, IsWriteSerializationEnabled(singleDB))
+	})
+}
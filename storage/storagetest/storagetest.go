@@ -0,0 +1,161 @@
+// Package storagetest provides isolated SQLite pools, fixtures and rolled back transactions for testing storage-backed code.
+//
+// A test, or every parallel test, gets its own migrated DB from NewSQLiteDB. Tests that share a DB can instead each work in their own
+// transaction from NewTx, which is rolled back when the test ends. SQLite allows a single writer, so writing transactions of parallel
+// tests sharing a file DB wait for each other up to the busy timeout, while a shared-cache in-memory DB fails them right away; give
+// parallel writers their own DB.
+package storagetest
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	migrate_sqlite3 "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/storage"
+	"github.com/rs/xid"
+
+	// File as a source for migration
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+const (
+	fileMigrationSourcePrefix = "file://"
+	// BusyTimeout is how long a transaction waits for another writer of the same file DB
+	BusyTimeout = 5 * time.Second
+	// maxConnections caps the pool; an in-memory DB lives only as long as one of its connections
+	maxConnections = 8
+)
+
+var (
+	// ErrInvalidFixture is returned when a fixture file is not a mapping of table names to lists of rows
+	ErrInvalidFixture = errors.New("fixture must map table names to lists of rows")
+)
+
+// Options configures the DB created by NewSQLiteDB
+type Options struct {
+	// MigrationSource is applied to the DB if set, either a `file://` URL or a directory relative to the working directory
+	MigrationSource string
+	// InMemory creates a shared-cache in-memory DB instead of a file in a temp dir
+	InMemory bool
+	// Fixtures are YAML or JSON files loaded into the DB after migration
+	Fixtures []string
+}
+
+// dbConfig hides the slow query log config of config.Config so that creating a pool does not reconfigure the global slow query log
+type dbConfig struct {
+	config.RelationalDatabaseConfig
+	config.SQLiteConfig
+}
+
+// NewSQLiteDB creates an isolated SQLite pool for t, migrated and loaded with fixtures as per options. The pool is closed, and its
+// files removed, when t ends.
+func NewSQLiteDB(t testing.TB, options Options) *sql.DB {
+	t.Helper()
+	sqliteConfig := &config.Config{DBDialect: config.SQLite3Dialect, DBMaxIdleConnections: maxConnections, DBMaxOpenConnections: maxConnections,
+		SQLiteBusyTimeout: BusyTimeout}
+	if options.InMemory {
+		sqliteConfig.DBConnectionURL = "file:storagetest-" + xid.New().String() + "?mode=memory&cache=shared"
+	} else {
+		sqliteConfig.DBConnectionURL = filepath.Join(t.TempDir(), "storagetest.sqlite3")
+		sqliteConfig.SQLiteJournalMode = "WAL"
+	}
+	db, err := storage.CreateDBConnectionPool(&dbConfig{RelationalDatabaseConfig: sqliteConfig, SQLiteConfig: sqliteConfig})
+	if err != nil {
+		t.Fatalf("could not create db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if len(options.MigrationSource) > 0 {
+		if err = Migrate(db, options.MigrationSource); err != nil {
+			t.Fatalf("could not migrate db: %v", err)
+		}
+	}
+	if len(options.Fixtures) > 0 {
+		err = storage.ExecuteOpsInTransaction(db, func(tx *sql.Tx) error {
+			return LoadFixtures(tx, options.Fixtures...)
+		})
+		if err != nil {
+			t.Fatalf("could not load fixtures: %v", err)
+		}
+	}
+	return db
+}
+
+// Migrate applies all up migrations of migrationSource, a `file://` URL or a directory, to the SQLite db
+func Migrate(db *sql.DB, migrationSource string) error {
+	if !strings.HasPrefix(migrationSource, fileMigrationSourcePrefix) {
+		dir, err := filepath.Abs(migrationSource)
+		if err != nil {
+			return err
+		}
+		migrationSource = fileMigrationSourcePrefix + dir
+	}
+	driver, err := migrate_sqlite3.WithInstance(db, &migrate_sqlite3.Config{})
+	if err != nil {
+		return err
+	}
+	// not closed as closing the driver closes db
+	migration, err := migrate.NewWithDatabaseInstance(migrationSource, string(config.SQLite3Dialect), driver)
+	if err != nil {
+		return err
+	}
+	if err = migration.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+// NewTx begins a transaction on db, loads fixtures in it and rolls it back when t ends
+func NewTx(t testing.TB, db *sql.DB, fixtures ...string) *sql.Tx {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("could not begin transaction: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	if err = LoadFixtures(tx, fixtures...); err != nil {
+		t.Fatalf("could not load fixtures: %v", err)
+	}
+	return tx
+}
+
+// LoadFixtures inserts the rows of the fixture files into their tables, in order of the files and of the tables and rows within them
+func LoadFixtures(tx *sql.Tx, paths ...string) error {
+	for _, path := range paths {
+		batches, err := ReadFixture(path)
+		if err != nil {
+			return err
+		}
+		for _, batch := range batches {
+			if _, err = storage.BatchInsertInTransaction(tx, config.SQLite3Dialect, batch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFixture reads a YAML or JSON fixture file mapping table names to lists of rows, each a mapping of column names to values, e.g.
+//
+//	users:
+//	  - id: 1
+//	    name: Alice
+//
+// Consecutive rows of a table with the same columns are grouped in a batch.
+func ReadFixture(path string) ([]*storage.Batch, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := storage.ReadBatches(content, false)
+	if err == storage.ErrInvalidBatchRows {
+		return nil, ErrInvalidFixture
+	}
+	return batches, err
+}
@@ -0,0 +1,79 @@
+package storagetest
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	migrationSource = "../test-migration"
+	yamlFixture     = "testdata/fixtures.yaml"
+	jsonFixture     = "testdata/fixtures.json"
+)
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func countTestRows(t *testing.T, db queryer) int {
+	var count int
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM test").Scan(&count))
+	return count
+}
+
+func TestNewSQLiteDB(t *testing.T) {
+	for name, inMemory := range map[string]bool{"File": false, "InMemory": true} {
+		inMemory := inMemory
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			db := NewSQLiteDB(t, Options{MigrationSource: migrationSource, InMemory: inMemory, Fixtures: []string{yamlFixture, jsonFixture}})
+			assert.Equal(t, 3, countTestRows(t, db))
+			var note string
+			var createdAt time.Time
+			assert.Nil(t, db.QueryRow("SELECT note, createdAt FROM test WHERE id = ?", "fixture-1").Scan(&note, &createdAt))
+			assert.Equal(t, "loaded from yaml", note)
+			assert.Equal(t, time.Date(2022, 3, 28, 12, 0, 0, 0, time.UTC), createdAt.UTC())
+			var fencingToken int64
+			assert.Nil(t, db.QueryRow("SELECT fencingToken FROM lock_test WHERE name = ?", "fixture-lock").Scan(&fencingToken))
+			assert.Equal(t, int64(1), fencingToken)
+		})
+	}
+	t.Run("Isolated", func(t *testing.T) {
+		t.Parallel()
+		db := NewSQLiteDB(t, Options{MigrationSource: "file://" + migrationSource, InMemory: true})
+		assert.Equal(t, 0, countTestRows(t, db))
+	})
+}
+
+func TestNewTx(t *testing.T) {
+	db := NewSQLiteDB(t, Options{MigrationSource: migrationSource})
+	t.Run("Fixtures", func(t *testing.T) {
+		tx := NewTx(t, db, yamlFixture)
+		assert.Equal(t, 2, countTestRows(t, tx))
+		_, err := tx.Exec("DELETE FROM test WHERE id = ?", "fixture-1")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, countTestRows(t, tx))
+	})
+	t.Run("RolledBack", func(t *testing.T) {
+		tx := NewTx(t, db, jsonFixture)
+		assert.Equal(t, 1, countTestRows(t, tx))
+	})
+	assert.Equal(t, 0, countTestRows(t, db))
+}
+
+func TestReadFixture(t *testing.T) {
+	batches, err := ReadFixture(jsonFixture)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(batches))
+	assert.Equal(t, "test", batches[0].Table)
+	assert.Equal(t, []string{"id", "name", "note", "createdAt", "updatedAt"}, batches[0].Columns)
+	assert.Equal(t, "lock_test", batches[1].Table)
+	assert.Equal(t, []interface{}{"fixture-lock", "fixture", 1, "2022-03-28 12:00:00"}, batches[1].Rows[0])
+	_, err = ReadFixture("testdata/invalid.yaml")
+	assert.Equal(t, ErrInvalidFixture, err)
+	_, err = ReadFixture("testdata/missing.yaml")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/imyousuf/appcommons/data"
+)
+
+var (
+	// ErrStopIteration is returned by a row callback to stop streaming early; streaming helpers do not return it as an error
+	ErrStopIteration = errors.New("stop row iteration")
+)
+
+// KeysetWalk describes a traversal of all rows of a query, newest first, one page per query so no long running transaction is held
+type KeysetWalk struct {
+	// BaseQuery is the `SELECT ... FROM table` query, optionally with a WHERE clause, to which the pagination fragment is appended
+	BaseQuery string
+	// HasWhereClause must be true when BaseQuery already has a WHERE clause
+	HasWhereClause bool
+	// QueryArgs are positional args for BaseQuery; pagination args are appended to them
+	QueryArgs func() []interface{}
+	// PageSize determines rows read per query
+	PageSize PageSizeEnum
+	// NewRow returns a fresh pointer to a struct embedding data.BasePaginateable that a row is mapped into
+	NewRow func() data.Paginateable
+	// PauseBetweenPages throttles the walk to reduce load on the DB
+	PauseBetweenPages time.Duration
+}
+
+var (
+	// StreamRows streams rows of the query, calling onRow after each row is scanned into scanArgs. The callback can return ErrStopIteration
+	// to stop without error or any other error to abort with it; context cancellation aborts with the context's error.
+	StreamRows = func(ctx context.Context, db *sql.DB, query string, queryArgs func() []interface{}, scanArgs func() []interface{}, onRow func() error) error {
+		rows, err := db.QueryContext(ctx, query, queryArgs()...)
+		if err != nil {
+			return ClassifyError(err)
+		}
+		defer func() { rows.Close() }()
+		for rows.Next() {
+			if err = rows.Scan(scanArgs()...); err != nil {
+				return ClassifyError(err)
+			}
+			if err = onRow(); err != nil {
+				if err == ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+		}
+		return ClassifyError(rows.Err())
+	}
+
+	// StreamStructs is same as StreamRows but maps each row into a new struct from newRow using `db` tags before passing it to onRow
+	StreamStructs = func(ctx context.Context, db *sql.DB, query string, queryArgs func() []interface{}, newRow func() interface{}, onRow func(row interface{}) error) error {
+		rows, err := db.QueryContext(ctx, query, queryArgs()...)
+		if err != nil {
+			return ClassifyError(err)
+		}
+		defer func() { rows.Close() }()
+		columns, err := rows.Columns()
+		if err != nil {
+			return ClassifyError(err)
+		}
+		for rows.Next() {
+			row := newRow()
+			pointers, err := GetFieldPointers(row, columns...)
+			if err != nil {
+				return err
+			}
+			if err = rows.Scan(pointers...); err != nil {
+				return ClassifyError(err)
+			}
+			if err = onRow(row); err != nil {
+				if err == ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+		}
+		return ClassifyError(rows.Err())
+	}
+
+	// WalkByKeyset calls onRow for every row of the walk's query, re-querying page by page for the rows after the last row's createdAt
+	// and id, compared as a tuple so that rows whose id order differs from their createdAt order are not skipped. It returns the number of rows passed to onRow; ErrStopIteration from onRow ends the walk without error.
+	WalkByKeyset = func(ctx context.Context, db *sql.DB, walk *KeysetWalk, onRow func(row data.Paginateable) error) (rowCount int64, err error) {
+		queryArgs := walk.QueryArgs
+		if queryArgs == nil {
+			queryArgs = NilArgs
+		}
+		page := &data.Pagination{}
+		for {
+			pageRowCount := 0
+			var lastRow data.Paginateable
+			stopped := false
+			query := walk.BaseQuery + getKeysetQueryFragment(page, walk.HasWhereClause, walk.PageSize)
+			args := appendKeysetQueryArgs(page, queryArgs()...)
+			err = StreamStructs(ctx, db, query, Args2SliceFnWrapper(args...), func() interface{} { return walk.NewRow() }, func(row interface{}) error {
+				pageRowCount++
+				rowCount++
+				lastRow = row.(data.Paginateable)
+				rowErr := onRow(lastRow)
+				if rowErr == ErrStopIteration {
+					stopped = true
+				}
+				return rowErr
+			})
+			if err != nil || stopped || pageRowCount < getExpectedMaxRowCount(walk.PageSize) {
+				return rowCount, err
+			}
+			page = data.NewPagination(lastRow, nil)
+			if page.Next == nil {
+				return rowCount, errInvalidWalkCursor
+			}
+			if walk.PauseBetweenPages > 0 {
+				select {
+				case <-ctx.Done():
+					return rowCount, ctx.Err()
+				case <-time.After(walk.PauseBetweenPages):
+				}
+			}
+		}
+	}
+
+	errInvalidWalkCursor = errors.New("could not get cursor of the last row")
+)
+
+// getKeysetQueryFragment is same as GetPaginationQueryFragmentWithConfigurablePageSize except that the cursor's createdAt and id are
+// compared as a tuple, matching the order of the rows, instead of each on its own
+func getKeysetQueryFragment(page *data.Pagination, append bool, pageSize PageSizeEnum) string {
+	query := " "
+	condition := ""
+	ascending := false
+	if page.Next != nil {
+		condition = "(createdAt < ? OR (createdAt = ? AND id < ?)) "
+	} else if page.Previous != nil {
+		condition = "(createdAt > ? OR (createdAt = ? AND id > ?)) "
+		ascending = true
+	}
+	if len(condition) > 0 {
+		if append {
+			query = query + "AND "
+		} else {
+			query = query + "WHERE "
+		}
+		query = query + condition
+	}
+	return query + string(getOrderByClause(pageSize, ascending))
+}
+
+// appendKeysetQueryArgs appends the cursor args of getKeysetQueryFragment to args
+func appendKeysetQueryArgs(page *data.Pagination, args ...interface{}) []interface{} {
+	cursor := page.Next
+	if cursor == nil {
+		cursor = page.Previous
+	}
+	if cursor == nil {
+		return args
+	}
+	return append(args, cursor.Timestamp, cursor.Timestamp, cursor.ID)
+}
+
+func getExpectedMaxRowCount(pageSize PageSizeEnum) int {
+	if count, ok := ExpectedMaxRowCount[pageSize]; ok {
+		return count
+	}
+	return ExpectedMaxRowCount[RegularPageSize]
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/imyousuf/appcommons/config"
+	"github.com/imyousuf/appcommons/data"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+)
+
+const streamRowCount = 120
+
+type streamTestModel struct {
+	data.BasePaginateable
+	Name string `db:"name"`
+}
+
+func TestStreaming(t *testing.T) {
+	rows := make([][]interface{}, 0, streamRowCount)
+	baseTime := time.Now().Add(-1 * time.Hour)
+	for index := 0; index < streamRowCount; index++ {
+		p := &data.BasePaginateable{}
+		p.QuickFix()
+		p.CreatedAt = baseTime.Add(time.Duration(index) * time.Millisecond)
+		rows = append(rows, []interface{}{p.ID, strconv.Itoa(index), p.CreatedAt, p.UpdatedAt})
+	}
+	_, err := ExecuteBatchInsert(testDB, config.SQLite3Dialect, &Batch{Table: "stream_test", Columns: []string{"id", "name", "createdAt", "updatedAt"}, Rows: rows})
+	assert.Nil(t, err)
+	t.Run("StreamRowsStop", func(t *testing.T) {
+		t.Parallel()
+		var name string
+		read := 0
+		err := StreamRows(context.Background(), testDB, "SELECT name FROM stream_test", NilArgs, Args2SliceFnWrapper(&name), func() error {
+			read++
+			if read == 10 {
+				return ErrStopIteration
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 10, read)
+	})
+	t.Run("StreamRowsCallbackErr", func(t *testing.T) {
+		t.Parallel()
+		var name string
+		callbackErr := errors.New("row error")
+		err := StreamRows(context.Background(), testDB, "SELECT name FROM stream_test", NilArgs, Args2SliceFnWrapper(&name), func() error {
+			return callbackErr
+		})
+		assert.Equal(t, callbackErr, err)
+	})
+	t.Run("StreamStructsCancelled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		read := 0
+		err := StreamStructs(ctx, testDB, "SELECT id, name, createdAt, updatedAt FROM stream_test", NilArgs, func() interface{} { return &streamTestModel{} }, func(row interface{}) error {
+			read++
+			assert.False(t, row.(*streamTestModel).ID.IsNil())
+			cancel()
+			return nil
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 1, read)
+	})
+	t.Run("WalkByKeyset", func(t *testing.T) {
+		t.Parallel()
+		seen := make(map[string]bool)
+		walk := &KeysetWalk{BaseQuery: "SELECT id, name, createdAt, updatedAt FROM stream_test", PageSize: RegularPageSize, NewRow: func() data.Paginateable { return &streamTestModel{} }}
+		count, err := WalkByKeyset(context.Background(), testDB, walk, func(row data.Paginateable) error {
+			seen[row.(*streamTestModel).ID.String()] = true
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(streamRowCount), count)
+		assert.Equal(t, streamRowCount, len(seen))
+	})
+	t.Run("WalkByKeysetWithWhereAndStop", func(t *testing.T) {
+		t.Parallel()
+		walk := &KeysetWalk{BaseQuery: "SELECT id, name, createdAt, updatedAt FROM stream_test WHERE name != ?", HasWhereClause: true, QueryArgs: Args2SliceFnWrapper("0"),
+			PageSize: RegularPageSize, NewRow: func() data.Paginateable { return &streamTestModel{} }, PauseBetweenPages: time.Millisecond}
+		count, err := WalkByKeyset(context.Background(), testDB, walk, func(row data.Paginateable) error {
+			if row.(*streamTestModel).Name == "50" {
+				return ErrStopIteration
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(streamRowCount-50), count)
+	})
+	t.Run("WalkByKeysetBindsCursor", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		firstPage := sqlmock.NewRows([]string{"id", "name", "createdAt", "updatedAt"})
+		lastID, lastCreatedAt := xid.New(), time.Now().UTC()
+		for index := 0; index < getExpectedMaxRowCount(RegularPageSize); index++ {
+			firstPage.AddRow(lastID.String(), strconv.Itoa(index), lastCreatedAt, lastCreatedAt)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("FROM stream_test WHERE name != ? ORDER BY")).WithArgs("0").WillReturnRows(firstPage)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM stream_test WHERE name != ? AND (createdAt < ? OR (createdAt = ? AND id < ?)) ORDER BY")).
+			WithArgs("0", lastCreatedAt, lastCreatedAt, lastID.String()).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "createdAt", "updatedAt"}))
+		walk := &KeysetWalk{BaseQuery: "SELECT id, name, createdAt, updatedAt FROM stream_test WHERE name != ?", HasWhereClause: true, QueryArgs: Args2SliceFnWrapper("0"),
+			PageSize: RegularPageSize, NewRow: func() data.Paginateable { return &streamTestModel{} }}
+		count, err := WalkByKeyset(context.Background(), db, walk, func(row data.Paginateable) error { return nil })
+		assert.Nil(t, err)
+		assert.Equal(t, int64(getExpectedMaxRowCount(RegularPageSize)), count)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWalkByKeysetIDAndCreatedAtOrderDisagree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyset-walk")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db, _ := getMigratedSQLiteDB(t, dir)
+	defer db.Close()
+	rowCount := getExpectedMaxRowCount(RegularPageSize)*2 + 5
+	rows := make([][]interface{}, 0, rowCount)
+	baseTime := time.Now().UTC().Truncate(time.Second)
+	for index := 0; index < rowCount; index++ {
+		// later ids are older, several sharing a second as with backfilled rows
+		createdAt := baseTime.Add(-time.Duration(index/3) * time.Second)
+		rows = append(rows, []interface{}{xid.New(), strconv.Itoa(index), createdAt, createdAt})
+	}
+	_, err = ExecuteBatchInsert(db, config.SQLite3Dialect, &Batch{Table: "stream_test", Columns: []string{"id", "name", "createdAt", "updatedAt"}, Rows: rows})
+	assert.Nil(t, err)
+	seen := make(map[string]bool)
+	walk := &KeysetWalk{BaseQuery: "SELECT id, name, createdAt, updatedAt FROM stream_test", PageSize: RegularPageSize, NewRow: func() data.Paginateable { return &streamTestModel{} }}
+	count, err := WalkByKeyset(context.Background(), db, walk, func(row data.Paginateable) error {
+		seen[row.(*streamTestModel).Name] = true
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(rowCount), count)
+	assert.Equal(t, rowCount, len(seen))
+}
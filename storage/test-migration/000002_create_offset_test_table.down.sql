@@ -0,0 +1 @@
+DROP TABLE IF EXISTS offset_test;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mapper_test;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS repository_test;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS conditional_update_test;
\ No newline at end of file
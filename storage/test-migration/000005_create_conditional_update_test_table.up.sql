@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `conditional_update_test` (
+    `id` VARCHAR(255) NOT NULL PRIMARY KEY,
+    `name` VARCHAR(255) NOT NULL,
+    `createdAt` DATETIME NOT NULL,
+    `updatedAt` DATETIME NOT NULL
+);
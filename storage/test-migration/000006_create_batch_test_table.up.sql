@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `batch_test` (
+    `id` VARCHAR(255) NOT NULL PRIMARY KEY,
+    `code` VARCHAR(255) NOT NULL UNIQUE,
+    `name` VARCHAR(255) NOT NULL,
+    `createdAt` DATETIME NOT NULL,
+    `updatedAt` DATETIME NOT NULL
+);
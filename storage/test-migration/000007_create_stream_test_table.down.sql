@@ -0,0 +1 @@
+DROP TABLE IF EXISTS stream_test;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS soft_delete_test;
\ No newline at end of file
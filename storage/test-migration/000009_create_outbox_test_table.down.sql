@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `outbox_test`;
\ No newline at end of file
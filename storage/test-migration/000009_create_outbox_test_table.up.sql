@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `outbox_test` (
+    `id` VARCHAR(255) NOT NULL PRIMARY KEY,
+    `topic` VARCHAR(255) NOT NULL,
+    `payload` BLOB NOT NULL,
+    `attempts` INT NOT NULL DEFAULT 0,
+    `lastError` VARCHAR(1024) NOT NULL DEFAULT '',
+    `nextAttemptAt` DATETIME NOT NULL,
+    `deliveredAt` DATETIME NULL,
+    `createdAt` DATETIME NOT NULL,
+    `updatedAt` DATETIME NOT NULL
+);
+CREATE INDEX `outbox_test_pending_idx` ON `outbox_test` (`deliveredAt`, `nextAttemptAt`);
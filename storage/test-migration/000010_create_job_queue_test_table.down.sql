@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `job_queue_test`;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `job_queue_test` (
+    `id` VARCHAR(255) NOT NULL PRIMARY KEY,
+    `queue` VARCHAR(255) NOT NULL,
+    `payload` BLOB NOT NULL,
+    `priority` INT NOT NULL DEFAULT 0,
+    `runAt` DATETIME NOT NULL,
+    `attempts` INT NOT NULL DEFAULT 0,
+    `maxAttempts` INT NOT NULL,
+    `leaseToken` VARCHAR(255) NOT NULL DEFAULT '',
+    `leaseExpiresAt` DATETIME NULL,
+    `lastError` VARCHAR(1024) NOT NULL DEFAULT '',
+    `deadAt` DATETIME NULL,
+    `createdAt` DATETIME NOT NULL,
+    `updatedAt` DATETIME NOT NULL
+);
+CREATE INDEX `job_queue_test_lease_idx` ON `job_queue_test` (`queue`, `deadAt`, `runAt`, `priority`);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `lock_test`;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `lock_test` (
+    `name` VARCHAR(64) NOT NULL PRIMARY KEY,
+    `owner` VARCHAR(255) NOT NULL,
+    `fencingToken` BIGINT NOT NULL,
+    `expiresAt` DATETIME NOT NULL
+);
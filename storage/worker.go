@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	errWorkerAlreadyStarted = errors.New("worker already started")
+)
+
+// periodicWorker runs a task every interval in a background goroutine until stopped
+type periodicWorker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	mutex  sync.Mutex
+}
+
+func (worker *periodicWorker) start(interval time.Duration, task func(ctx context.Context)) error {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+	if worker.cancel != nil {
+		return errWorkerAlreadyStarted
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.cancel = cancel
+	worker.done = make(chan struct{})
+	go func() {
+		defer close(worker.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				task(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// stop cancels the task's context and waits for the goroutine to exit; it is a no-op if not started
+func (worker *periodicWorker) stop() {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+	if worker.cancel == nil {
+		return
+	}
+	worker.cancel()
+	<-worker.done
+	worker.cancel = nil
+}